@@ -0,0 +1,224 @@
+// Package audit keeps an append-only record of who changed which coin and
+// when. Entries are written by repository.Audited, so every caller of the
+// repository is covered, not only HTTP handlers.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"cryptoserver/config"
+)
+
+// Actions recorded in the log.
+const (
+	ActionCreate  = "create"
+	ActionDelete  = "delete"
+	ActionRefresh = "refresh"
+	ActionRestore = "restore"
+	// ActionUpdate is an edit of a coin's user metadata.
+	ActionUpdate = "update"
+	// ActionPurge is the removal of a deleted coin once its purge delay
+	// has passed.
+	ActionPurge = "purge"
+)
+
+// SystemActor is recorded for changes made without a request, e.g. by
+// background jobs.
+const SystemActor = "system"
+
+// Actor is who made a change.
+type Actor struct {
+	// Subject is the API key name or token subject; empty for
+	// unauthenticated requests and SystemActor for background callers.
+	Subject string `json:"actor"`
+	// Method is how the actor authenticated: "api_key", "jwt" or empty.
+	Method    string `json:"auth_method,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// Client is the remote address of the request.
+	Client string `json:"client,omitempty"`
+}
+
+// Entry is one recorded change. PriceBefore is unset for creations and
+// restores, PriceAfter for deletions and purges, both for updates.
+type Entry struct {
+	ID     int64     `json:"id"`
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Tenant string    `json:"tenant"`
+	Symbol string    `json:"symbol"`
+	Actor
+	PriceBefore *float64 `json:"price_before,omitempty"`
+	PriceAfter  *float64 `json:"price_after,omitempty"`
+}
+
+// Query selects entries of one tenant. Empty Symbol and zero From/To do
+// not filter; To is exclusive. Limit keeps the newest matches.
+type Query struct {
+	Tenant string
+	Symbol string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+func (q Query) matches(e Entry) bool {
+	return e.Tenant == q.Tenant &&
+		(q.Symbol == "" || e.Symbol == q.Symbol) &&
+		(q.From.IsZero() || !e.Time.Before(q.From)) &&
+		(q.To.IsZero() || e.Time.Before(q.To))
+}
+
+// Store is an append-only audit log.
+type Store interface {
+	// Append records e, assigning its ID.
+	Append(e Entry) (Entry, error)
+	// Find returns the entries matching q, oldest first.
+	Find(q Query) ([]Entry, error)
+}
+
+// MemoryStore keeps the newest entries in memory; with a file it also
+// appends every entry to it as a JSON line, so the full log survives
+// restarts and trimming. It is safe for concurrent use.
+type MemoryStore struct {
+	limit int
+
+	mu      sync.Mutex
+	entries []Entry
+	nextID  int64
+	file    *os.File
+	w       *bufio.Writer
+}
+
+// NewMemoryStore keeps up to limit entries in memory only.
+func NewMemoryStore(limit int) *MemoryStore {
+	return &MemoryStore{limit: max(limit, 1), nextID: 1}
+}
+
+// Open builds the store cfg describes: in memory, or backed by cfg.File,
+// whose existing entries are loaded first.
+func Open(cfg config.AuditConfig) (*MemoryStore, error) {
+	s := NewMemoryStore(cfg.MemoryLimit)
+	if cfg.File == "" {
+		return s, nil
+	}
+	f, err := os.OpenFile(cfg.File, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("audit log: %w", err)
+	}
+	if err := s.load(f, cfg.File); err != nil {
+		f.Close()
+		return nil, err
+	}
+	s.file, s.w = f, bufio.NewWriter(f)
+	return s, nil
+}
+
+// load reads the entries of f. A crash during Append can leave the last
+// line partly written; it is cut off with a warning, or just finished
+// when only its newline is missing, so the next entry starts on a line
+// of its own. A corrupt line before the last is an error.
+func (s *MemoryStore) load(f *os.File, name string) error {
+	r := bufio.NewReader(f)
+	var good int64 // bytes up to the end of the last complete entry
+	for line := 1; ; line++ {
+		b, err := r.ReadBytes('\n')
+		if len(b) == 0 && err == io.EOF {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("audit log %s: %w", name, err)
+		}
+		var e Entry
+		jerr := json.Unmarshal(b, &e)
+		if jerr == nil && err == io.EOF {
+			// Only the newline is missing: keep the entry, finish its line.
+			if _, err := f.Write([]byte{'\n'}); err != nil {
+				return fmt.Errorf("audit log %s: %w", name, err)
+			}
+		}
+		if jerr != nil {
+			if _, perr := r.Peek(1); perr != io.EOF {
+				return fmt.Errorf("audit log %s:%d: corrupt entry: %v", name, line, jerr)
+			}
+			slog.Warn("audit log: dropping partly written last entry", "file", name, "line", line, "bytes", len(b))
+			if err := f.Truncate(good); err != nil {
+				return fmt.Errorf("audit log %s: %w", name, err)
+			}
+			return nil
+		}
+		s.keep(e)
+		s.nextID = max(s.nextID, e.ID+1)
+		good += int64(len(b))
+	}
+}
+
+// keep adds e to the in-memory window. Callers hold s.mu or own s.
+func (s *MemoryStore) keep(e Entry) {
+	s.entries = append(s.entries, e)
+	if len(s.entries) > s.limit {
+		s.entries = slices.Clone(s.entries[len(s.entries)-s.limit:])
+	}
+}
+
+func (s *MemoryStore) Append(e Entry) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.ID = s.nextID
+	if s.w != nil {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return Entry{}, err
+		}
+		// Flush per entry: a crash must not lose changes already made.
+		if _, err := s.w.Write(append(b, '\n')); err != nil {
+			return Entry{}, fmt.Errorf("audit log: %w", err)
+		}
+		if err := s.w.Flush(); err != nil {
+			return Entry{}, fmt.Errorf("audit log: %w", err)
+		}
+	}
+	s.nextID++
+	s.keep(e)
+	return e, nil
+}
+
+func (s *MemoryStore) Find(q Query) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Entry{}
+	for _, e := range s.entries {
+		if q.matches(e) {
+			out = append(out, e)
+		}
+	}
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[len(out)-q.Limit:]
+	}
+	return out, nil
+}
+
+// Close syncs and closes the backing file, if any.
+func (s *MemoryStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.w.Flush()
+	if serr := s.file.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	s.file, s.w = nil, nil
+	return err
+}
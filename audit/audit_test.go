@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cryptoserver/config"
+)
+
+func TestFileStoreSurvivesReopen(t *testing.T) {
+	cfg := config.AuditConfig{File: filepath.Join(t.TempDir(), "audit.jsonl"), MemoryLimit: 2}
+	s, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	price := 100.0
+	for i, action := range []string{ActionCreate, ActionRefresh, ActionDelete} {
+		e, err := s.Append(Entry{Time: t0.Add(time.Duration(i) * time.Hour), Action: action, Tenant: "default", Symbol: "btc", Actor: Actor{Subject: "ci"}, PriceAfter: &price})
+		if err != nil || e.ID != int64(i+1) {
+			t.Fatalf("append %d: id %d, %v", i, e.ID, err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	got, _ := s.Find(Query{Tenant: "default"})
+	if len(got) != 2 || got[0].ID != 2 || got[1].Action != ActionDelete || got[1].Subject != "ci" || *got[1].PriceAfter != price {
+		t.Fatalf("reopened entries = %+v, want the newest two", got)
+	}
+	e, err := s.Append(Entry{Time: t0, Action: ActionCreate, Tenant: "default", Symbol: "eth"})
+	if err != nil || e.ID != 4 {
+		t.Errorf("append after reopen: id %d, %v; want 4", e.ID, err)
+	}
+}
+
+func TestOpenRecoversPartialLastLine(t *testing.T) {
+	full := `{"id":1,"time":"2026-01-01T00:00:00Z","action":"create","tenant":"default","symbol":"btc"}`
+	for _, tc := range []struct {
+		name, content string
+		entries       int
+		ok            bool
+	}{
+		{"truncated", full + "\n" + `{"id":2,"time":"2026-01-01T01:00`, 1, true},
+		{"no newline", full + "\n" + strings.Replace(full, `"id":1`, `"id":2`, 1), 2, true},
+		{"corrupt middle", full + "\n{oops\n" + full + "\n", 0, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.AuditConfig{File: filepath.Join(t.TempDir(), "audit.jsonl"), MemoryLimit: 10}
+			if err := os.WriteFile(cfg.File, []byte(tc.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			s, err := Open(cfg)
+			if !tc.ok {
+				if err == nil {
+					s.Close()
+					t.Fatal("Open accepted a corrupt entry before the last line")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Append(Entry{Action: ActionDelete, Tenant: "default", Symbol: "btc"}); err != nil {
+				t.Fatal(err)
+			}
+			s.Close()
+
+			// The next entry went on a line of its own.
+			s, err = Open(cfg)
+			if err != nil {
+				t.Fatalf("reopen: %v", err)
+			}
+			defer s.Close()
+			got, _ := s.Find(Query{Tenant: "default"})
+			if len(got) != tc.entries+1 || got[len(got)-1].ID != int64(tc.entries+1) {
+				t.Errorf("entries after recovery = %+v", got)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	s := NewMemoryStore(100)
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, symbol := range []string{"btc", "eth", "btc", "btc"} {
+		_, _ = s.Append(Entry{Time: t0.Add(time.Duration(i) * time.Hour), Action: ActionRefresh, Tenant: "default", Symbol: symbol})
+	}
+	_, _ = s.Append(Entry{Time: t0, Action: ActionCreate, Tenant: "team-a", Symbol: "btc"})
+
+	tests := []struct {
+		name string
+		q    Query
+		want []int64
+	}{
+		{"tenant", Query{Tenant: "default"}, []int64{1, 2, 3, 4}},
+		{"other tenant", Query{Tenant: "team-a"}, []int64{5}},
+		{"unknown tenant", Query{Tenant: "team-b"}, []int64{}},
+		{"symbol", Query{Tenant: "default", Symbol: "btc"}, []int64{1, 3, 4}},
+		{"from inclusive, to exclusive", Query{Tenant: "default", From: t0.Add(time.Hour), To: t0.Add(3 * time.Hour)}, []int64{2, 3}},
+		{"limit keeps newest", Query{Tenant: "default", Symbol: "btc", Limit: 2}, []int64{3, 4}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := s.Find(tc.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []int64{}
+			for _, e := range got {
+				ids = append(ids, e.ID)
+			}
+			if len(ids) != len(tc.want) {
+				t.Fatalf("ids = %v, want %v", ids, tc.want)
+			}
+			for i := range ids {
+				if ids[i] != tc.want[i] {
+					t.Fatalf("ids = %v, want %v", ids, tc.want)
+				}
+			}
+		})
+	}
+}
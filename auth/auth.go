@@ -0,0 +1,196 @@
+// Package auth keeps the API keys the server accepts and the identity of
+// the caller a request was authenticated as.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"cryptoserver/config"
+)
+
+// Scope is what a caller may do; see config.ScopeRead and friends. The
+// empty Scope is needed by public endpoints.
+type Scope string
+
+const (
+	Public Scope = ""
+	Read   Scope = config.ScopeRead
+	Write  Scope = config.ScopeWrite
+	Admin  Scope = config.ScopeAdmin
+)
+
+func (s Scope) rank() int {
+	switch s {
+	case Read:
+		return 1
+	case Write:
+		return 2
+	case Admin:
+		return 3
+	}
+	return 0
+}
+
+// Allows reports whether a caller with scope s may use an endpoint that
+// needs scope need.
+func (s Scope) Allows(need Scope) bool { return s.rank() >= need.rank() }
+
+var (
+	ErrKeyExists   = errors.New("api key already exists")
+	ErrKeyNotFound = errors.New("api key not found")
+	ErrInvalidKey  = errors.New("invalid api key request")
+)
+
+// Key describes an API key; the secret itself is never kept.
+type Key struct {
+	Name      string    `json:"name"`
+	Scope     Scope     `json:"scope"`
+	CreatedAt time.Time `json:"created_at"`
+	// Source is "config" for keys loaded at startup and "api" for keys
+	// created through the admin endpoint, which do not survive a restart.
+	Source string `json:"source"`
+	// Tenant, when set, is the only tenant the key may act for.
+	Tenant string `json:"tenant,omitempty"`
+
+	hash [sha256.Size]byte
+}
+
+// Key sources.
+const (
+	SourceConfig = "config"
+	SourceAPI    = "api"
+)
+
+// KeyStore holds the accepted API keys. It is safe for concurrent use.
+type KeyStore struct {
+	enabled bool
+
+	mu   sync.RWMutex
+	keys []Key
+}
+
+// NewKeyStore loads the keys of a validated cfg.
+func NewKeyStore(cfg config.AuthConfig) *KeyStore {
+	s := &KeyStore{enabled: cfg.Enabled}
+	now := time.Now()
+	for _, k := range cfg.Keys {
+		h, _ := k.Hash()
+		s.keys = append(s.keys, Key{Name: k.Name, Scope: Scope(k.Scope), CreatedAt: now, Source: SourceConfig, Tenant: k.Tenant, hash: h})
+	}
+	return s
+}
+
+// Enabled reports whether requests must authenticate. It does not change
+// when keys are revoked, so removing the last key locks the API rather
+// than opening it.
+func (s *KeyStore) Enabled() bool { return s != nil && s.enabled }
+
+// Authenticate returns the key whose secret is presented. Every stored
+// hash is compared in constant time so timing does not reveal how close
+// a guess was or which key matched.
+func (s *KeyStore) Authenticate(presented string) (Key, bool) {
+	h := sha256.Sum256([]byte(presented))
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var found Key
+	match := 0
+	for _, k := range s.keys {
+		if subtle.ConstantTimeCompare(h[:], k.hash[:]) == 1 {
+			found, match = k, 1
+		}
+	}
+	return found, match == 1
+}
+
+// List returns the keys sorted by name.
+func (s *KeyStore) List() []Key {
+	s.mu.RLock()
+	out := slices.Clone(s.keys)
+	s.mu.RUnlock()
+	slices.SortFunc(out, func(a, b Key) int { return strings.Compare(a.Name, b.Name) })
+	return out
+}
+
+// Create adds a key with a fresh random secret, which is returned once
+// and cannot be recovered later. A non-empty tenant binds the key to it.
+func (s *KeyStore) Create(name string, scope Scope, tenant string) (Key, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Key{}, "", fmt.Errorf("%w: name required", ErrInvalidKey)
+	}
+	if !config.ValidScope(string(scope)) {
+		return Key{}, "", fmt.Errorf("%w: scope %q is not %s, %s or %s", ErrInvalidKey, scope, Read, Write, Admin)
+	}
+	if tenant != "" && !config.ValidTenant(tenant) {
+		return Key{}, "", fmt.Errorf("%w: tenant %q must be lowercase letters, digits, - or _", ErrInvalidKey, tenant)
+	}
+	var b [32]byte
+	_, _ = rand.Read(b[:])
+	secret := hex.EncodeToString(b[:])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if slices.ContainsFunc(s.keys, func(k Key) bool { return k.Name == name }) {
+		return Key{}, "", ErrKeyExists
+	}
+	k := Key{Name: name, Scope: scope, CreatedAt: time.Now(), Source: SourceAPI, Tenant: tenant, hash: sha256.Sum256([]byte(secret))}
+	s.keys = append(s.keys, k)
+	return k, secret, nil
+}
+
+// Revoke removes the named key; requests using it fail from then on.
+func (s *KeyStore) Revoke(name string) error {
+	return s.RevokeFor(name, "")
+}
+
+// RevokeFor removes the named key if it is bound to tenant; an empty
+// tenant may revoke any key. Keys outside tenant are reported as
+// ErrKeyNotFound, so their names do not leak.
+func (s *KeyStore) RevokeFor(name, tenant string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.keys, func(k Key) bool { return k.Name == name })
+	if i < 0 || (tenant != "" && s.keys[i].Tenant != tenant) {
+		return ErrKeyNotFound
+	}
+	s.keys = slices.Delete(s.keys, i, i+1)
+	return nil
+}
+
+// Identity is the authenticated caller of a request.
+type Identity struct {
+	// Subject names the caller: the API key name or the token's sub.
+	Subject string `json:"subject"`
+	Scope   Scope  `json:"scope"`
+	// Method is how the caller authenticated: "api_key" or "jwt".
+	Method string `json:"method"`
+	// Roles are the token's role claim values; empty for API keys.
+	Roles []string `json:"roles,omitempty"`
+	// Tenant is the tenant the caller is bound to; empty lets the caller
+	// choose one per request.
+	Tenant string `json:"tenant,omitempty"`
+}
+
+type identityKey struct{}
+
+// WithIdentity stores id in ctx.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext returns the caller stored by WithIdentity; ok is
+// false for unauthenticated requests.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"cryptoserver/config"
+)
+
+func TestScopeAllows(t *testing.T) {
+	cases := []struct {
+		have, need Scope
+		want       bool
+	}{
+		{Read, Public, true},
+		{Read, Read, true},
+		{Read, Write, false},
+		{Write, Read, true},
+		{Write, Admin, false},
+		{Admin, Write, true},
+		{Public, Read, false},
+	}
+	for _, tc := range cases {
+		if got := tc.have.Allows(tc.need); got != tc.want {
+			t.Errorf("%q.Allows(%q) = %v, want %v", tc.have, tc.need, got, tc.want)
+		}
+	}
+}
+
+func TestKeyStore(t *testing.T) {
+	// sha256("hashed-key-0123456789")
+	const hashed = "62c5559717da6012427d84b732fdf7292e3426e5a620fd08af73ebf6300f6d91"
+	plain := config.APIKeyConfig{Name: "plain", Scope: config.ScopeRead, Key: "plain-key-0123456789"}
+	s := NewKeyStore(config.AuthConfig{Enabled: true, Keys: []config.APIKeyConfig{
+		plain,
+		{Name: "hashed", Scope: config.ScopeAdmin, KeySHA256: hashed},
+	}})
+	if !s.Enabled() {
+		t.Fatal("Enabled() = false")
+	}
+	if k, ok := s.Authenticate("plain-key-0123456789"); !ok || k.Name != "plain" || k.Source != SourceConfig {
+		t.Errorf("Authenticate(plain) = %+v, %v", k, ok)
+	}
+	if k, ok := s.Authenticate("hashed-key-0123456789"); !ok || k.Scope != Admin {
+		t.Errorf("Authenticate(hashed) = %+v, %v", k, ok)
+	}
+	if _, ok := s.Authenticate("plain-key-012345678"); ok {
+		t.Error("prefix of a key authenticated")
+	}
+
+	k, secret, err := s.Create(" ci ", Write, "team-a")
+	if err != nil || k.Name != "ci" || k.Source != SourceAPI || len(secret) != 64 {
+		t.Fatalf("Create = %+v, %q, %v", k, secret, err)
+	}
+	if got, ok := s.Authenticate(secret); !ok || got.Scope != Write || got.Tenant != "team-a" {
+		t.Errorf("Authenticate(created) = %+v, %v", got, ok)
+	}
+	if _, _, err := s.Create("ci", Read, ""); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("duplicate Create error = %v", err)
+	}
+	if _, _, err := s.Create("x", "root", ""); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("bad scope Create error = %v", err)
+	}
+	if _, _, err := s.Create("x", Read, "Team A"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("bad tenant Create error = %v", err)
+	}
+	if names := s.List(); len(names) != 3 || names[0].Name != "ci" || names[2].Name != "plain" {
+		t.Errorf("List() = %+v, want sorted by name", names)
+	}
+
+	if err := s.RevokeFor("ci", "team-b"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("RevokeFor another tenant error = %v", err)
+	}
+	if err := s.RevokeFor("plain", "team-a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("RevokeFor an unbound key error = %v", err)
+	}
+	if err := s.RevokeFor("ci", "team-a"); err != nil {
+		t.Fatalf("RevokeFor: %v", err)
+	}
+	if _, ok := s.Authenticate(secret); ok {
+		t.Error("revoked key still authenticates")
+	}
+	if err := s.Revoke("ci"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("second Revoke error = %v", err)
+	}
+	_ = s.Revoke("plain")
+	_ = s.Revoke("hashed")
+	if !s.Enabled() {
+		t.Error("revoking every key disabled authentication")
+	}
+}
@@ -0,0 +1,332 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"cryptoserver/config"
+)
+
+var (
+	// ErrInvalidToken covers malformed tokens, bad signatures and failed
+	// issuer or audience checks.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenExpired is returned for tokens past exp or before nbf.
+	ErrTokenExpired = errors.New("token expired or not yet valid")
+)
+
+// minRSABits rejects JWKS keys too short to trust.
+const minRSABits = 2048
+
+// JWTVerifier checks bearer tokens signed with HS256, RS256 or ES256 and
+// maps their role claim to a Scope.
+type JWTVerifier struct {
+	secret      []byte
+	keys        []jwk
+	issuer      string
+	audience    string
+	roleClaim   string
+	roleScopes  map[string]Scope
+	tenantClaim string
+	leeway      time.Duration
+}
+
+// jwk is one verification key from a JWKS file.
+type jwk struct {
+	kid string
+	alg string // empty: any algorithm matching the key type
+	key any    // []byte, *rsa.PublicKey or *ecdsa.PublicKey
+}
+
+// NewJWTVerifier builds a verifier from a validated cfg, reading the JWKS
+// file if one is configured. It returns nil, nil when JWT is not set up.
+func NewJWTVerifier(cfg config.JWTConfig) (*JWTVerifier, error) {
+	if !cfg.Configured() {
+		return nil, nil
+	}
+	v := &JWTVerifier{
+		secret:      []byte(cfg.HS256Secret),
+		issuer:      cfg.Issuer,
+		audience:    cfg.Audience,
+		roleClaim:   cfg.RoleClaim,
+		roleScopes:  make(map[string]Scope, len(cfg.RoleScopes)),
+		tenantClaim: cfg.TenantClaim,
+		leeway:      time.Duration(cfg.Leeway),
+	}
+	for role, scope := range cfg.RoleScopes {
+		v.roleScopes[role] = Scope(scope)
+	}
+	if cfg.JWKSFile != "" {
+		b, err := os.ReadFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("jwks: %w", err)
+		}
+		if v.keys, err = parseJWKS(b); err != nil {
+			return nil, fmt.Errorf("jwks %s: %w", cfg.JWKSFile, err)
+		}
+	}
+	return v, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks token's signature and validity window at now and returns
+// the caller it identifies. Errors wrap ErrInvalidToken or ErrTokenExpired.
+func (v *JWTVerifier) Verify(token string, now time.Time) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, fmt.Errorf("%w: want 3 segments, got %d", ErrInvalidToken, len(parts))
+	}
+	var hdr jwtHeader
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return Identity{}, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+	if err := v.verifySignature(hdr, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return Identity{}, err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Identity{}, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	if err := v.checkClaims(claims, now); err != nil {
+		return Identity{}, err
+	}
+
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return Identity{}, fmt.Errorf("%w: sub claim missing", ErrInvalidToken)
+	}
+	id := Identity{Subject: sub, Method: "jwt", Roles: stringList(claims[v.roleClaim])}
+	for _, role := range id.Roles {
+		if s := v.roleScopes[role]; s.rank() > id.Scope.rank() {
+			id.Scope = s
+		}
+	}
+	if v.tenantClaim != "" {
+		if t, ok := claims[v.tenantClaim].(string); ok && t != "" {
+			if t = strings.ToLower(t); !config.ValidTenant(t) {
+				return Identity{}, fmt.Errorf("%w: %s claim %q is not a tenant name", ErrInvalidToken, v.tenantClaim, t)
+			}
+			id.Tenant = t
+		}
+	}
+	return id, nil
+}
+
+// verifySignature picks the key for hdr and checks sig over signed. The
+// algorithm must fit the key type, so an RSA public key can never be used
+// as an HMAC secret.
+func (v *JWTVerifier) verifySignature(hdr jwtHeader, signed, sig []byte) error {
+	var candidates []any
+	if hdr.Alg == "HS256" && len(v.secret) > 0 && hdr.Kid == "" {
+		candidates = append(candidates, v.secret)
+	}
+	for _, k := range v.keys {
+		if (hdr.Kid == "" || k.kid == hdr.Kid) && (k.alg == "" || k.alg == hdr.Alg) {
+			candidates = append(candidates, k.key)
+		}
+	}
+	digest := sha256.Sum256(signed)
+	for _, key := range candidates {
+		switch key := key.(type) {
+		case []byte:
+			if hdr.Alg != "HS256" {
+				continue
+			}
+			mac := hmac.New(sha256.New, key)
+			mac.Write(signed)
+			if hmac.Equal(mac.Sum(nil), sig) {
+				return nil
+			}
+		case *rsa.PublicKey:
+			if hdr.Alg == "RS256" && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			if hdr.Alg == "ES256" && len(sig) == 64 {
+				r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+				if ecdsa.Verify(key, digest[:], r, s) {
+					return nil
+				}
+			}
+		}
+	}
+	switch hdr.Alg {
+	case "HS256", "RS256", "ES256":
+		return fmt.Errorf("%w: bad signature or unknown key %q", ErrInvalidToken, hdr.Kid)
+	}
+	return fmt.Errorf("%w: unsupported alg %q", ErrInvalidToken, hdr.Alg)
+}
+
+// checkClaims enforces exp (required), nbf, iss and aud.
+func (v *JWTVerifier) checkClaims(claims map[string]any, now time.Time) error {
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return fmt.Errorf("%w: exp claim missing", ErrInvalidToken)
+	}
+	if !now.Before(exp.Add(v.leeway)) {
+		return fmt.Errorf("%w: expired at %s", ErrTokenExpired, exp.UTC().Format(time.RFC3339))
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(v.leeway).Before(nbf) {
+		return fmt.Errorf("%w: valid from %s", ErrTokenExpired, nbf.UTC().Format(time.RFC3339))
+	}
+	if v.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.issuer {
+			return fmt.Errorf("%w: issuer %q", ErrInvalidToken, iss)
+		}
+	}
+	if v.audience != "" {
+		aud := stringList(claims["aud"])
+		found := false
+		for _, a := range aud {
+			found = found || a == v.audience
+		}
+		if !found {
+			return fmt.Errorf("%w: audience %v", ErrInvalidToken, aud)
+		}
+	}
+	return nil
+}
+
+func decodeSegment(seg string, dst any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
+
+// numericDate reads a JWT NumericDate (seconds since the epoch).
+func numericDate(v any) (time.Time, bool) {
+	f, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*1e9)), true
+}
+
+// stringList reads a claim that is a string, a space-separated string
+// (as in OAuth "scope") or an array of strings.
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// parseJWKS reads the RSA, P-256 EC and oct keys of a JWK set. Keys with
+// "use" other than "sig" and unsupported key types are skipped.
+func parseJWKS(b []byte) ([]jwk, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, err
+	}
+	var out []jwk
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var key any
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = rsaKey(k.N, k.E)
+		case "EC":
+			key, err = ecKey(k.Crv, k.X, k.Y)
+		case "oct":
+			key, err = base64.RawURLEncoding.DecodeString(k.K)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %d (%s %q): %w", i, k.Kty, k.Kid, err)
+		}
+		out = append(out, jwk{kid: k.Kid, alg: k.Alg, key: key})
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no usable signing keys")
+	}
+	return out, nil
+}
+
+func rsaKey(n, e string) (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, fmt.Errorf("n: %w", err)
+	}
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, fmt.Errorf("e: %w", err)
+	}
+	pub := &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: int(new(big.Int).SetBytes(eb).Int64())}
+	if pub.N.BitLen() < minRSABits || pub.E < 3 {
+		return nil, fmt.Errorf("rsa key is weaker than %d bits", minRSABits)
+	}
+	return pub, nil
+}
+
+func ecKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	if crv != "P-256" {
+		return nil, fmt.Errorf("curve %q is not supported (want P-256)", crv)
+	}
+	xb, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, fmt.Errorf("x: %w", err)
+	}
+	yb, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, fmt.Errorf("y: %w", err)
+	}
+	if len(xb) != 32 || len(yb) != 32 {
+		return nil, errors.New("x and y must be 32 bytes")
+	}
+	// ecdh validates that the point is on the curve.
+	if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, xb...), yb...)); err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(xb), Y: new(big.Int).SetBytes(yb)}, nil
+}
@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"cryptoserver/config"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+var b64 = base64.RawURLEncoding
+
+// signToken builds a compact JWT; key is a []byte secret, *rsa.PrivateKey
+// or *ecdsa.PrivateKey matching alg.
+func signToken(t *testing.T, alg, kid string, claims map[string]any, key any) string {
+	t.Helper()
+	hdr := map[string]any{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		hdr["kid"] = kid
+	}
+	hb, _ := json.Marshal(hdr)
+	cb, _ := json.Marshal(claims)
+	signed := b64.EncodeToString(hb) + "." + b64.EncodeToString(cb)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case nil:
+	}
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+// testKeys writes a JWKS holding an RSA and an EC key and returns their
+// private halves.
+func testKeys(t *testing.T) (string, *rsa.PrivateKey, *ecdsa.PrivateKey) {
+	t.Helper()
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ek, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := map[string]any{"keys": []map[string]any{
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "alg": "RS256",
+			"n": b64.EncodeToString(rk.N.Bytes()), "e": b64.EncodeToString(big.NewInt(int64(rk.E)).Bytes())},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256",
+			"x": b64.EncodeToString(ek.X.FillBytes(make([]byte, 32))), "y": b64.EncodeToString(ek.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}}
+	b, _ := json.Marshal(set)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path, rk, ek
+}
+
+func newTestVerifier(t *testing.T, jwks string) *JWTVerifier {
+	t.Helper()
+	cfg := config.Default().Auth.JWT
+	cfg.HS256Secret = testSecret
+	cfg.JWKSFile = jwks
+	cfg.Issuer = "https://idp.example"
+	cfg.Audience = "cryptoserver"
+	cfg.RoleScopes = map[string]string{"viewer": config.ScopeRead, "editor": config.ScopeWrite, "ops": config.ScopeAdmin}
+	v, err := NewJWTVerifier(cfg)
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	return v
+}
+
+func TestJWTVerify(t *testing.T) {
+	jwks, rk, ek := testKeys(t)
+	v := newTestVerifier(t, jwks)
+	now := time.Unix(1_700_000_000, 0)
+	claims := func(extra map[string]any) map[string]any {
+		c := map[string]any{
+			"sub": "alice", "iss": "https://idp.example", "aud": []string{"other", "cryptoserver"},
+			"exp": now.Add(time.Hour).Unix(), "roles": []string{"viewer", "editor"},
+		}
+		for k, val := range extra {
+			if val == nil {
+				delete(c, k)
+			} else {
+				c[k] = val
+			}
+		}
+		return c
+	}
+	otherRSA, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	cases := []struct {
+		name   string
+		token  string
+		want   error
+		wantID Identity
+	}{
+		{name: "hs256", token: signToken(t, "HS256", "", claims(nil), []byte(testSecret)),
+			wantID: Identity{Subject: "alice", Scope: Write, Method: "jwt", Roles: []string{"viewer", "editor"}}},
+		{name: "rs256", token: signToken(t, "RS256", "rsa-1", claims(map[string]any{"roles": "ops"}), rk),
+			wantID: Identity{Subject: "alice", Scope: Admin, Method: "jwt", Roles: []string{"ops"}}},
+		{name: "es256 without kid", token: signToken(t, "ES256", "", claims(map[string]any{"roles": "viewer unknown"}), ek),
+			wantID: Identity{Subject: "alice", Scope: Read, Method: "jwt", Roles: []string{"viewer", "unknown"}}},
+		{name: "tenant claim", token: signToken(t, "HS256", "", claims(map[string]any{"tenant": "Team-A"}), []byte(testSecret)),
+			wantID: Identity{Subject: "alice", Scope: Write, Method: "jwt", Roles: []string{"viewer", "editor"}, Tenant: "team-a"}},
+		{name: "bad tenant claim", token: signToken(t, "HS256", "", claims(map[string]any{"tenant": "team a"}), []byte(testSecret)), want: ErrInvalidToken},
+		{name: "no mapped role", token: signToken(t, "HS256", "", claims(map[string]any{"roles": nil}), []byte(testSecret)),
+			wantID: Identity{Subject: "alice", Method: "jwt", Roles: nil}},
+		{name: "expired", token: signToken(t, "HS256", "", claims(map[string]any{"exp": now.Add(-time.Minute).Unix()}), []byte(testSecret)), want: ErrTokenExpired},
+		{name: "expired within leeway", token: signToken(t, "HS256", "", claims(map[string]any{"exp": now.Add(-10 * time.Second).Unix()}), []byte(testSecret)),
+			wantID: Identity{Subject: "alice", Scope: Write, Method: "jwt", Roles: []string{"viewer", "editor"}}},
+		{name: "not yet valid", token: signToken(t, "HS256", "", claims(map[string]any{"nbf": now.Add(time.Minute).Unix()}), []byte(testSecret)), want: ErrTokenExpired},
+		{name: "no exp", token: signToken(t, "HS256", "", claims(map[string]any{"exp": nil}), []byte(testSecret)), want: ErrInvalidToken},
+		{name: "no sub", token: signToken(t, "HS256", "", claims(map[string]any{"sub": nil}), []byte(testSecret)), want: ErrInvalidToken},
+		{name: "wrong issuer", token: signToken(t, "HS256", "", claims(map[string]any{"iss": "evil"}), []byte(testSecret)), want: ErrInvalidToken},
+		{name: "wrong audience", token: signToken(t, "HS256", "", claims(map[string]any{"aud": "other"}), []byte(testSecret)), want: ErrInvalidToken},
+		{name: "wrong secret", token: signToken(t, "HS256", "", claims(nil), []byte("not-the-secret-not-the-secret-!!")), want: ErrInvalidToken},
+		{name: "unknown rsa key", token: signToken(t, "RS256", "rsa-1", claims(nil), otherRSA), want: ErrInvalidToken},
+		{name: "unknown kid", token: signToken(t, "RS256", "rsa-2", claims(nil), rk), want: ErrInvalidToken},
+		{name: "alg none", token: signToken(t, "none", "", claims(nil), nil), want: ErrInvalidToken},
+		{name: "alg confusion", token: signToken(t, "HS256", "rsa-1", claims(nil), rk.N.Bytes()), want: ErrInvalidToken},
+		{name: "garbage", token: "not.a.jwt", want: ErrInvalidToken},
+		{name: "two segments", token: "a.b", want: ErrInvalidToken},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			id, err := v.Verify(tc.token, now)
+			if tc.want != nil {
+				if !errors.Is(err, tc.want) {
+					t.Fatalf("Verify error = %v, want %v", err, tc.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if id.Subject != tc.wantID.Subject || id.Scope != tc.wantID.Scope || id.Method != tc.wantID.Method || id.Tenant != tc.wantID.Tenant || !slices.Equal(id.Roles, tc.wantID.Roles) {
+				t.Errorf("identity = %+v, want %+v", id, tc.wantID)
+			}
+		})
+	}
+}
+
+func TestNewJWTVerifier(t *testing.T) {
+	if v, err := NewJWTVerifier(config.Default().Auth.JWT); v != nil || err != nil {
+		t.Errorf("unconfigured: %v, %v; want nil, nil", v, err)
+	}
+	cfg := config.Default().Auth.JWT
+	cfg.JWKSFile = filepath.Join(t.TempDir(), "missing.json")
+	if _, err := NewJWTVerifier(cfg); err == nil {
+		t.Error("missing JWKS file: want error")
+	}
+	weak, _ := json.Marshal(map[string]any{"keys": []map[string]any{{"kty": "RSA", "n": b64.EncodeToString([]byte{0xff, 0xff}), "e": "AQAB"}}})
+	cfg.JWKSFile = filepath.Join(t.TempDir(), "weak.json")
+	_ = os.WriteFile(cfg.JWKSFile, weak, 0o600)
+	if _, err := NewJWTVerifier(cfg); err == nil {
+		t.Error("weak RSA key: want error")
+	}
+}
@@ -0,0 +1,117 @@
+// Package binanceclient fetches spot prices from a Binance-compatible
+// ticker API (GET /api/v3/ticker/price?symbol=BTCUSDT). Errors wrap the
+// geckoclient sentinels so the repository maps them like CoinGecko ones.
+package binanceclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"cryptoserver/config"
+	"cryptoserver/gecko/geckoclient"
+)
+
+// maxBodyBytes bounds ticker responses, which are a few dozen bytes.
+const maxBodyBytes = 64 << 10
+
+// codeInvalidSymbol is Binance's error code for an unknown market.
+const codeInvalidSymbol = -1121
+
+// Client is a Binance price provider.
+type Client struct {
+	baseURL string
+	quote   string
+	http    *http.Client
+}
+
+// New builds a client from cfg; it does not touch the network.
+func New(cfg config.BinanceConfig) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(cfg.BaseURL, "/"),
+		quote:   strings.ToUpper(cfg.QuoteAsset),
+		http:    &http.Client{Timeout: time.Duration(cfg.Timeout)},
+	}
+}
+
+// Name identifies the provider in PriceRecord.Provider.
+func (c *Client) Name() string { return config.ProviderBinance }
+
+// market is the Binance pair for symbol, e.g. btc → BTCUSDT.
+func (c *Client) market(symbol string) string {
+	return strings.ToUpper(strings.TrimSpace(symbol)) + c.quote
+}
+
+type tickerPrice struct {
+	Symbol string `json:"symbol"`
+	Price  string `json:"price"`
+}
+
+type apiError struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+// GetPrice returns the last traded price of symbol in the quote asset.
+func (c *Client) GetPrice(symbol string) (float64, error) {
+	market := c.market(symbol)
+	resp, err := c.http.Get(c.baseURL + "/api/v3/ticker/price?symbol=" + url.QueryEscape(market))
+	if err != nil {
+		return 0, fmt.Errorf("%w: binance: %v", geckoclient.ErrServiceUnavailable, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes+1))
+	if err != nil {
+		return 0, fmt.Errorf("%w: binance: %v", geckoclient.ErrServiceUnavailable, err)
+	}
+	if len(body) > maxBodyBytes {
+		return 0, fmt.Errorf("%w: binance: response exceeds %d bytes", geckoclient.ErrBadResponse, maxBodyBytes)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, statusError(resp.StatusCode, body, market)
+	}
+
+	var t tickerPrice
+	if err := json.Unmarshal(body, &t); err != nil {
+		return 0, fmt.Errorf("%w: binance: ticker is not JSON: %v", geckoclient.ErrBadResponse, err)
+	}
+	price, err := strconv.ParseFloat(t.Price, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: binance: price %q of %s is not a number", geckoclient.ErrBadResponse, t.Price, market)
+	}
+	return price, nil
+}
+
+// statusError classifies a non-200 answer. Binance reports unknown
+// markets as 400 with code -1121, and throttling as 429 or 418 (banned).
+func statusError(status int, body []byte, market string) error {
+	var e apiError
+	_ = json.Unmarshal(body, &e)
+	var sentinel error
+	switch {
+	case e.Code == codeInvalidSymbol, status == http.StatusNotFound:
+		sentinel = geckoclient.ErrNotFound
+	case status == http.StatusTooManyRequests, status == http.StatusTeapot:
+		sentinel = geckoclient.ErrRateLimited
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		sentinel = geckoclient.ErrUnauthorized
+	case status >= 500:
+		sentinel = geckoclient.ErrServiceUnavailable
+	default:
+		sentinel = geckoclient.ErrBadResponse
+	}
+	return &geckoclient.UpstreamError{StatusCode: status, Message: shorten(e.Msg), Err: fmt.Errorf("%w: binance %s", sentinel, market)}
+}
+
+func shorten(s string) string {
+	const limit = 200
+	if len(s) > limit {
+		return s[:limit] + "…"
+	}
+	return s
+}
@@ -0,0 +1,89 @@
+package binanceclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cryptoserver/config"
+	"cryptoserver/gecko/geckoclient"
+)
+
+func newTestClient(t *testing.T, h http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return New(config.BinanceConfig{BaseURL: srv.URL + "/", QuoteAsset: "usdt", Timeout: config.Duration(time.Second)})
+}
+
+func TestGetPriceParsesTicker(t *testing.T) {
+	var gotSymbol string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/ticker/price" {
+			http.NotFound(w, r)
+			return
+		}
+		gotSymbol = r.URL.Query().Get("symbol")
+		_, _ = w.Write([]byte(`{"symbol":"BTCUSDT","price":"64123.45000000"}`))
+	})
+
+	price, err := c.GetPrice(" btc ")
+	if err != nil {
+		t.Fatalf("GetPrice: %v", err)
+	}
+	if price != 64123.45 {
+		t.Errorf("price = %v, want 64123.45", price)
+	}
+	if gotSymbol != "BTCUSDT" {
+		t.Errorf("symbol query = %q, want BTCUSDT", gotSymbol)
+	}
+	if c.Name() != config.ProviderBinance {
+		t.Errorf("Name() = %q", c.Name())
+	}
+}
+
+func TestGetPriceClassifiesErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+	}{
+		{"invalid symbol", http.StatusBadRequest, `{"code":-1121,"msg":"Invalid symbol."}`, geckoclient.ErrNotFound},
+		{"other bad request", http.StatusBadRequest, `{"code":-1102,"msg":"Mandatory parameter"}`, geckoclient.ErrBadResponse},
+		{"rate limited", http.StatusTooManyRequests, `{"code":-1003,"msg":"Too many requests"}`, geckoclient.ErrRateLimited},
+		{"banned", http.StatusTeapot, `{"code":-1003,"msg":"IP banned"}`, geckoclient.ErrRateLimited},
+		{"forbidden", http.StatusForbidden, ``, geckoclient.ErrUnauthorized},
+		{"server error", http.StatusBadGateway, `<html>`, geckoclient.ErrServiceUnavailable},
+		{"not json", http.StatusOK, `<html>`, geckoclient.ErrBadResponse},
+		{"bad price", http.StatusOK, `{"symbol":"BTCUSDT","price":"n/a"}`, geckoclient.ErrBadResponse},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			})
+			_, err := c.GetPrice("btc")
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("GetPrice error = %v, want %v", err, tc.want)
+			}
+			var ue *geckoclient.UpstreamError
+			if tc.status != http.StatusOK && (!errors.As(err, &ue) || ue.StatusCode != tc.status) {
+				t.Errorf("error %v is not an UpstreamError with status %d", err, tc.status)
+			}
+		})
+	}
+}
+
+func TestGetPriceUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+	c := New(config.BinanceConfig{BaseURL: url, QuoteAsset: "USDT", Timeout: config.Duration(time.Second)})
+	if _, err := c.GetPrice("btc"); !errors.Is(err, geckoclient.ErrServiceUnavailable) {
+		t.Errorf("GetPrice error = %v, want ErrServiceUnavailable", err)
+	}
+}
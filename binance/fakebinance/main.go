@@ -0,0 +1,81 @@
+// Command fakebinance serves a Binance-compatible ticker API for local
+// runs and tests: GET /api/v3/ticker/price?symbol=BTCUSDT answers a
+// geckocoins.FakePrice for every symbol in the CoinGecko coin list.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"cryptoserver/gecko/geckocoins"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:5060", "listen address")
+	listPath := flag.String("list", "crypto_list.json", "CoinGecko-format coin list the markets are built from")
+	quote := flag.String("quote", "USDT", "quote asset of every market")
+	flag.Parse()
+
+	markets := loadMarkets(*listPath, strings.ToUpper(*quote))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/ping", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{})
+	})
+	mux.HandleFunc("GET /api/v3/ticker/price", func(w http.ResponseWriter, r *http.Request) {
+		symbol := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("symbol")))
+		if symbol == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]any{
+				"code": -1102, "msg": "Mandatory parameter 'symbol' was not sent, was empty/null, or malformed.",
+			})
+			return
+		}
+		coin, ok := markets[symbol]
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"code": -1121, "msg": "Invalid symbol."})
+			return
+		}
+		// Binance sends prices as decimal strings.
+		price := geckocoins.FakePrice(coin)
+		writeJSON(w, http.StatusOK, map[string]string{
+			"symbol": symbol,
+			"price":  strconv.FormatFloat(price, 'f', 8, 64),
+		})
+	})
+
+	log.Printf("Fake Binance server: http://%s (%d markets)", *addr, len(markets))
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// loadMarkets maps SYMBOL+QUOTE markets built from a coin list to the
+// coin symbol.
+func loadMarkets(path, quote string) map[string]string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("read coins list: %v", err)
+	}
+	var coins []geckocoins.CoinInfo
+	if err := json.Unmarshal(b, &coins); err != nil {
+		log.Fatalf("parse coins list JSON: %v", err)
+	}
+	markets := make(map[string]string, len(coins))
+	for _, c := range coins {
+		if s := strings.ToUpper(strings.TrimSpace(c.Symbol)); s != "" {
+			markets[s+quote] = s
+		}
+	}
+	return markets
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
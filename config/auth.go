@@ -0,0 +1,214 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// API key scopes, from least to most privileged; each includes the ones
+// before it.
+const (
+	// ScopeRead allows GET requests.
+	ScopeRead = "read"
+	// ScopeWrite also allows POST, PUT and DELETE.
+	ScopeWrite = "write"
+	// ScopeAdmin also allows /admin endpoints, including key management.
+	ScopeAdmin = "admin"
+)
+
+// DefaultTenant owns the coins of callers that name no tenant.
+const DefaultTenant = "default"
+
+// tenantRe is what tenant names look like: lowercase, URL- and
+// label-safe.
+var tenantRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// ValidTenant reports whether s can name a tenant.
+func ValidTenant(s string) bool { return tenantRe.MatchString(s) }
+
+// minAPIKeyLen keeps guessable keys out of the config.
+const minAPIKeyLen = 16
+
+// AuthConfig controls API authentication.
+type AuthConfig struct {
+	// Enabled requires a valid API key or bearer token on every endpoint
+	// except health, readiness and API docs.
+	Enabled bool           `json:"enabled" yaml:"enabled"`
+	Keys    []APIKeyConfig `json:"keys" yaml:"keys"`
+	JWT     JWTConfig      `json:"jwt" yaml:"jwt"`
+}
+
+// JWTConfig configures verification of "Authorization: Bearer" tokens.
+// Tokens are accepted when HS256Secret or JWKSFile is set.
+type JWTConfig struct {
+	// HS256Secret verifies HS256 tokens that carry no kid.
+	HS256Secret string `json:"hs256_secret,omitempty" yaml:"hs256_secret,omitempty"`
+	// JWKSFile is a local JWK set with RSA (RS256), P-256 (ES256) or oct
+	// (HS256) keys, read at startup.
+	JWKSFile string `json:"jwks_file" yaml:"jwks_file"`
+	// Issuer and Audience, when set, must match the iss and aud claims.
+	Issuer   string `json:"issuer" yaml:"issuer"`
+	Audience string `json:"audience" yaml:"audience"`
+	// RoleClaim names the claim holding the caller's roles, as an array
+	// or a space-separated string; RoleScopes maps roles to scopes and
+	// the caller gets the widest one.
+	RoleClaim  string            `json:"role_claim" yaml:"role_claim"`
+	RoleScopes map[string]string `json:"role_scopes" yaml:"role_scopes"`
+	// TenantClaim names the claim binding the caller to a tenant; tokens
+	// without it may pick a tenant with the X-Tenant header.
+	TenantClaim string `json:"tenant_claim" yaml:"tenant_claim"`
+	// Leeway tolerates clock skew when checking exp and nbf.
+	Leeway Duration `json:"leeway" yaml:"leeway"`
+}
+
+// minHS256SecretLen is the HS256 key size RFC 7518 asks for.
+const minHS256SecretLen = 32
+
+// Configured reports whether bearer tokens can be verified.
+func (j JWTConfig) Configured() bool { return j.HS256Secret != "" || j.JWKSFile != "" }
+
+// APIKeyConfig is one key accepted at startup. Exactly one of Key and
+// KeySHA256 is set; the hash keeps the secret itself out of config files.
+// A key with a Tenant only sees that tenant's coins.
+type APIKeyConfig struct {
+	Name      string `json:"name" yaml:"name"`
+	Scope     string `json:"scope" yaml:"scope"`
+	Tenant    string `json:"tenant,omitempty" yaml:"tenant,omitempty"`
+	Key       string `json:"key,omitempty" yaml:"key,omitempty"`
+	KeySHA256 string `json:"key_sha256,omitempty" yaml:"key_sha256,omitempty"`
+}
+
+// Hash returns the SHA-256 digest of the key.
+func (k APIKeyConfig) Hash() ([sha256.Size]byte, error) {
+	if k.Key != "" {
+		return sha256.Sum256([]byte(k.Key)), nil
+	}
+	var h [sha256.Size]byte
+	b, err := hex.DecodeString(k.KeySHA256)
+	if err != nil || len(b) != len(h) {
+		return h, errors.New("key_sha256 must be 64 hex digits")
+	}
+	copy(h[:], b)
+	return h, nil
+}
+
+// ValidScope reports whether s names a scope.
+func ValidScope(s string) bool {
+	return s == ScopeRead || s == ScopeWrite || s == ScopeAdmin
+}
+
+// redacted returns a copy of a with plaintext keys replaced by their hash,
+// which loads back as the same keys. The HS256 secret cannot be hashed
+// and is left out; pass it through JWT_HS256_SECRET instead.
+func (a AuthConfig) redacted() AuthConfig {
+	out := a
+	out.JWT.HS256Secret = ""
+	out.Keys = make([]APIKeyConfig, len(a.Keys))
+	for i, k := range a.Keys {
+		if k.Key != "" {
+			h := sha256.Sum256([]byte(k.Key))
+			k.Key, k.KeySHA256 = "", hex.EncodeToString(h[:])
+		}
+		out.Keys[i] = k
+	}
+	return out
+}
+
+func (a AuthConfig) validate() []error {
+	var errs []error
+	if a.Enabled && len(a.Keys) == 0 && !a.JWT.Configured() {
+		errs = append(errs, errors.New("auth.keys: at least one key or auth.jwt is required when auth is enabled"))
+	}
+	errs = append(errs, a.JWT.validate()...)
+	seen := make(map[string]bool, len(a.Keys))
+	for i, k := range a.Keys {
+		at := fmt.Sprintf("auth.keys[%d]", i)
+		switch {
+		case k.Name == "":
+			errs = append(errs, fmt.Errorf("%s.name: must not be empty", at))
+		case seen[k.Name]:
+			errs = append(errs, fmt.Errorf("%s.name: %q listed twice", at, k.Name))
+		}
+		seen[k.Name] = true
+		if !ValidScope(k.Scope) {
+			errs = append(errs, fmt.Errorf("%s.scope: %q is not %s, %s or %s", at, k.Scope, ScopeRead, ScopeWrite, ScopeAdmin))
+		}
+		if k.Tenant != "" && !ValidTenant(k.Tenant) {
+			errs = append(errs, fmt.Errorf("%s.tenant: %q must be lowercase letters, digits, - or _", at, k.Tenant))
+		}
+		switch {
+		case (k.Key == "") == (k.KeySHA256 == ""):
+			errs = append(errs, fmt.Errorf("%s: set exactly one of key and key_sha256", at))
+		case k.Key != "" && len(k.Key) < minAPIKeyLen:
+			errs = append(errs, fmt.Errorf("%s.key: must be at least %d characters", at, minAPIKeyLen))
+		case k.KeySHA256 != "":
+			if _, err := k.Hash(); err != nil {
+				errs = append(errs, fmt.Errorf("%s.%v", at, err))
+			}
+		}
+	}
+	return errs
+}
+
+func (j JWTConfig) validate() []error {
+	var errs []error
+	if j.HS256Secret != "" && len(j.HS256Secret) < minHS256SecretLen {
+		errs = append(errs, fmt.Errorf("auth.jwt.hs256_secret: must be at least %d bytes", minHS256SecretLen))
+	}
+	if j.Configured() && j.RoleClaim == "" {
+		errs = append(errs, errors.New("auth.jwt.role_claim: must not be empty"))
+	}
+	for role, scope := range j.RoleScopes {
+		if !ValidScope(scope) {
+			errs = append(errs, fmt.Errorf("auth.jwt.role_scopes[%s]: %q is not %s, %s or %s", role, scope, ScopeRead, ScopeWrite, ScopeAdmin))
+		}
+	}
+	if j.Leeway < 0 {
+		errs = append(errs, fmt.Errorf("auth.jwt.leeway: must not be negative, got %s", j.Leeway))
+	}
+	return errs
+}
+
+// apiKeysSetter parses "name:scope:key" entries separated by commas; a
+// name written as "name@tenant" binds the key to a tenant.
+func apiKeysSetter(dst *[]APIKeyConfig) func(string) error {
+	return func(s string) error {
+		var out []APIKeyConfig
+		for _, v := range strings.Split(s, ",") {
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			parts := strings.SplitN(v, ":", 3)
+			if len(parts) != 3 {
+				return fmt.Errorf("%q is not name:scope:key", v)
+			}
+			name, tenant, _ := strings.Cut(parts[0], "@")
+			out = append(out, APIKeyConfig{Name: name, Scope: parts[1], Key: parts[2], Tenant: tenant})
+		}
+		*dst = out
+		return nil
+	}
+}
+
+// roleScopesSetter parses "role:scope" pairs separated by commas.
+func roleScopesSetter(dst *map[string]string) func(string) error {
+	return func(s string) error {
+		out := make(map[string]string)
+		for _, v := range strings.Split(s, ",") {
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			role, scope, ok := strings.Cut(v, ":")
+			if !ok {
+				return fmt.Errorf("%q is not role:scope", v)
+			}
+			out[strings.TrimSpace(role)] = strings.TrimSpace(scope)
+		}
+		*dst = out
+		return nil
+	}
+}
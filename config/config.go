@@ -0,0 +1,408 @@
+// Package config assembles the server configuration from defaults, an
+// optional YAML or JSON file, environment variables and command-line flags,
+// in that order of increasing precedence, and validates the result.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// Config is the effective configuration handed to every component.
+type Config struct {
+	Server     ServerConfig     `json:"server" yaml:"server"`
+	Upstream   UpstreamConfig   `json:"upstream" yaml:"upstream"`
+	Repository RepositoryConfig `json:"repository" yaml:"repository"`
+	Cache      CacheConfig      `json:"cache" yaml:"cache"`
+	Providers  ProvidersConfig  `json:"providers" yaml:"providers"`
+	Auth       AuthConfig       `json:"auth" yaml:"auth"`
+	RateLimit  RateLimitConfig  `json:"rate_limit" yaml:"rate_limit"`
+	Audit      AuditConfig      `json:"audit" yaml:"audit"`
+}
+
+// ServerConfig covers the HTTP listener and its lifecycle.
+type ServerConfig struct {
+	Port              int      `json:"port" yaml:"port"`
+	ReadHeaderTimeout Duration `json:"read_header_timeout" yaml:"read_header_timeout"`
+	ReadTimeout       Duration `json:"read_timeout" yaml:"read_timeout"`
+	WriteTimeout      Duration `json:"write_timeout" yaml:"write_timeout"`
+	IdleTimeout       Duration `json:"idle_timeout" yaml:"idle_timeout"`
+	// ShutdownTimeout is how long in-flight requests get to drain on exit.
+	ShutdownTimeout Duration `json:"shutdown_timeout" yaml:"shutdown_timeout"`
+	// ReadyTimeout is the budget for all /readyz checks together.
+	ReadyTimeout Duration `json:"ready_timeout" yaml:"ready_timeout"`
+}
+
+// UpstreamConfig configures the CoinGecko client.
+type UpstreamConfig struct {
+	// BaseURL of the CoinGecko API. Empty means auto-detect: the local
+	// fakegecko at 127.0.0.1:5050 if it answers, else the public API.
+	BaseURL string `json:"base_url" yaml:"base_url"`
+	// Timeout bounds each upstream HTTP request.
+	Timeout Duration `json:"timeout" yaml:"timeout"`
+	// RateLimit caps upstream requests per second across all calls, with
+	// bursts of up to RateBurst. Zero disables client-side limiting.
+	RateLimit float64 `json:"rate_limit" yaml:"rate_limit"`
+	RateBurst int     `json:"rate_burst" yaml:"rate_burst"`
+
+	Retry   RetryConfig   `json:"retry" yaml:"retry"`
+	Breaker BreakerConfig `json:"breaker" yaml:"breaker"`
+}
+
+// RetryConfig controls retries of idempotent upstream GETs after
+// transport errors and 5xx answers.
+type RetryConfig struct {
+	// MaxAttempts includes the first try; 1 disables retries.
+	MaxAttempts int `json:"max_attempts" yaml:"max_attempts"`
+	// Backoff doubles from InitialBackoff up to MaxBackoff, with jitter.
+	InitialBackoff Duration `json:"initial_backoff" yaml:"initial_backoff"`
+	MaxBackoff     Duration `json:"max_backoff" yaml:"max_backoff"`
+}
+
+// BreakerConfig controls the circuit breaker around upstream calls.
+type BreakerConfig struct {
+	// FailureThreshold consecutive failed calls open the circuit; 0
+	// disables the breaker.
+	FailureThreshold int `json:"failure_threshold" yaml:"failure_threshold"`
+	// OpenTimeout is how long the circuit stays open before one probe
+	// call is let through.
+	OpenTimeout Duration `json:"open_timeout" yaml:"open_timeout"`
+}
+
+// Repository storage kinds.
+const (
+	// StorageMemory keeps the current state of every coin.
+	StorageMemory = "memory"
+	// StorageEvents derives the state from an event log, so earlier
+	// states can be replayed.
+	StorageEvents = "events"
+)
+
+// RepositoryConfig configures coin storage.
+type RepositoryConfig struct {
+	// Storage is StorageMemory or StorageEvents.
+	Storage string `json:"storage" yaml:"storage"`
+	// HistoryLimit is how many price records are retained per coin.
+	HistoryLimit int `json:"history_limit" yaml:"history_limit"`
+	// EventLimit is how many events StorageEvents retains per tenant;
+	// states before the oldest retained event cannot be replayed.
+	EventLimit int `json:"event_limit" yaml:"event_limit"`
+	// PurgeAfter is how long a deleted coin stays restorable before its
+	// tombstone and history are dropped. Zero deletes at once.
+	PurgeAfter Duration `json:"purge_after" yaml:"purge_after"`
+
+	Sanity SanityConfig `json:"sanity" yaml:"sanity"`
+}
+
+// Outlier actions.
+const (
+	// OutlierFlag keeps an outlying price in history, marked as an outlier.
+	OutlierFlag = "flag"
+	// OutlierQuarantine keeps an outlying price out of history.
+	OutlierQuarantine = "quarantine"
+)
+
+// SanityConfig controls the checks a fetched price passes before it is
+// recorded. Non-finite and non-positive prices are always rejected.
+type SanityConfig struct {
+	// MaxDeviation is the largest accepted relative move from the median
+	// of the last Window recorded prices; 0.5 allows ±50%. Zero disables
+	// the check.
+	MaxDeviation float64 `json:"max_deviation" yaml:"max_deviation"`
+	Window       int     `json:"window" yaml:"window"`
+	// Action is OutlierFlag or OutlierQuarantine.
+	Action string `json:"outlier_action" yaml:"outlier_action"`
+	// ConfirmAfter consecutive quarantined prices that agree with each
+	// other are taken as a genuine move and recorded; 0 never does.
+	ConfirmAfter int `json:"confirm_after" yaml:"confirm_after"`
+	// AnomalyLimit is how many rejected or flagged prices are kept per coin.
+	AnomalyLimit int `json:"anomaly_limit" yaml:"anomaly_limit"`
+}
+
+// CacheConfig configures the price cache in front of the upstream.
+type CacheConfig struct {
+	// TTL is how long a fetched price is served without asking upstream.
+	// Zero disables caching; concurrent lookups are still coalesced.
+	TTL Duration `json:"ttl" yaml:"ttl"`
+	// StaleTTL is how long past TTL a price may still be served when the
+	// upstream is failing. Zero disables stale fallback.
+	StaleTTL Duration `json:"stale_ttl" yaml:"stale_ttl"`
+}
+
+// AuditConfig configures the log of coin creations, deletions and
+// refreshes.
+type AuditConfig struct {
+	// File, when set, receives every entry as a JSON line and is read
+	// back at startup; otherwise the log lives in memory only.
+	File string `json:"file" yaml:"file"`
+	// MemoryLimit is how many of the newest entries GET /audit searches.
+	MemoryLimit int `json:"memory_limit" yaml:"memory_limit"`
+}
+
+// maxAuditMemoryLimit bounds the searchable part of the audit log.
+const maxAuditMemoryLimit = 1_000_000
+
+// Price provider names and aggregation strategies.
+const (
+	ProviderCoinGecko = "coingecko"
+	ProviderBinance   = "binance"
+
+	// StrategyFallback asks providers in order and uses the first price.
+	StrategyFallback = "primary-then-fallback"
+	// StrategyMedian asks all providers and uses the median price.
+	StrategyMedian = "median-of-providers"
+)
+
+// ProvidersConfig selects where prices come from. Coin names always come
+// from the CoinGecko coin list.
+type ProvidersConfig struct {
+	// Enabled lists provider names; for StrategyFallback the first is the
+	// primary and the rest are tried in order.
+	Enabled  []string      `json:"enabled" yaml:"enabled"`
+	Strategy string        `json:"strategy" yaml:"strategy"`
+	Binance  BinanceConfig `json:"binance" yaml:"binance"`
+}
+
+// BinanceConfig configures the Binance-compatible ticker provider.
+type BinanceConfig struct {
+	BaseURL string `json:"base_url" yaml:"base_url"`
+	// QuoteAsset is appended to the coin symbol to form the market, e.g.
+	// BTC + USDT.
+	QuoteAsset string   `json:"quote_asset" yaml:"quote_asset"`
+	Timeout    Duration `json:"timeout" yaml:"timeout"`
+}
+
+// Default returns the configuration used when nothing overrides it.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:              8080,
+			ReadHeaderTimeout: Duration(5 * time.Second),
+			ReadTimeout:       Duration(10 * time.Second),
+			WriteTimeout:      Duration(30 * time.Second),
+			IdleTimeout:       Duration(120 * time.Second),
+			ShutdownTimeout:   Duration(20 * time.Second),
+			ReadyTimeout:      Duration(2 * time.Second),
+		},
+		Upstream: UpstreamConfig{
+			Timeout:   Duration(10 * time.Second),
+			RateBurst: 10,
+			Retry: RetryConfig{
+				MaxAttempts:    3,
+				InitialBackoff: Duration(100 * time.Millisecond),
+				MaxBackoff:     Duration(2 * time.Second),
+			},
+			Breaker: BreakerConfig{
+				FailureThreshold: 5,
+				OpenTimeout:      Duration(30 * time.Second),
+			},
+		},
+		Repository: RepositoryConfig{
+			Storage:      StorageMemory,
+			HistoryLimit: 100,
+			EventLimit:   100_000,
+			PurgeAfter:   Duration(24 * time.Hour),
+			Sanity: SanityConfig{
+				MaxDeviation: 0.5,
+				Window:       10,
+				Action:       OutlierQuarantine,
+				ConfirmAfter: 3,
+				AnomalyLimit: 100,
+			},
+		},
+		Cache: CacheConfig{
+			TTL:      Duration(5 * time.Second),
+			StaleTTL: Duration(10 * time.Minute),
+		},
+		Providers: ProvidersConfig{
+			Enabled:  []string{ProviderCoinGecko},
+			Strategy: StrategyFallback,
+			Binance: BinanceConfig{
+				BaseURL:    "https://api.binance.com",
+				QuoteAsset: "USDT",
+				Timeout:    Duration(10 * time.Second),
+			},
+		},
+		Auth: AuthConfig{
+			Keys: []APIKeyConfig{},
+			JWT: JWTConfig{
+				RoleClaim:   "roles",
+				RoleScopes:  map[string]string{ScopeRead: ScopeRead, ScopeWrite: ScopeWrite, ScopeAdmin: ScopeAdmin},
+				TenantClaim: "tenant",
+				Leeway:      Duration(30 * time.Second),
+			},
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Read:    RateBudget{Rate: 20, Burst: 40},
+			Refresh: RateBudget{Rate: 1, Burst: 5},
+			Routes:  map[string]RateBudget{},
+		},
+		Audit: AuditConfig{MemoryLimit: 10_000},
+	}
+}
+
+// maxHistoryLimit keeps a typo from turning into unbounded memory use.
+const maxHistoryLimit = 100_000
+
+// maxEventLimit bounds the event log of StorageEvents likewise.
+const maxEventLimit = 10_000_000
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port: %d is outside 1..65535", c.Server.Port))
+	}
+	for _, d := range []struct {
+		name string
+		v    Duration
+	}{
+		{"server.read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+		{"server.ready_timeout", c.Server.ReadyTimeout},
+		{"upstream.timeout", c.Upstream.Timeout},
+		{"upstream.retry.initial_backoff", c.Upstream.Retry.InitialBackoff},
+		{"upstream.retry.max_backoff", c.Upstream.Retry.MaxBackoff},
+		{"upstream.breaker.open_timeout", c.Upstream.Breaker.OpenTimeout},
+		{"providers.binance.timeout", c.Providers.Binance.Timeout},
+	} {
+		if d.v <= 0 {
+			errs = append(errs, fmt.Errorf("%s: must be positive, got %s", d.name, d.v))
+		}
+	}
+	for _, d := range []struct {
+		name string
+		v    Duration
+	}{
+		{"cache.ttl", c.Cache.TTL},
+		{"cache.stale_ttl", c.Cache.StaleTTL},
+		{"repository.purge_after", c.Repository.PurgeAfter},
+	} {
+		if d.v < 0 {
+			errs = append(errs, fmt.Errorf("%s: must not be negative, got %s", d.name, d.v))
+		}
+	}
+	if c.Upstream.RateLimit < 0 {
+		errs = append(errs, fmt.Errorf("upstream.rate_limit: must not be negative, got %g", c.Upstream.RateLimit))
+	}
+	if c.Upstream.RateBurst < 1 {
+		errs = append(errs, fmt.Errorf("upstream.rate_burst: must be at least 1, got %d", c.Upstream.RateBurst))
+	}
+	if c.Upstream.Retry.MaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("upstream.retry.max_attempts: must be at least 1, got %d", c.Upstream.Retry.MaxAttempts))
+	}
+	if c.Upstream.Retry.MaxBackoff < c.Upstream.Retry.InitialBackoff {
+		errs = append(errs, fmt.Errorf("upstream.retry.max_backoff: %s is below initial_backoff %s", c.Upstream.Retry.MaxBackoff, c.Upstream.Retry.InitialBackoff))
+	}
+	if c.Upstream.Breaker.FailureThreshold < 0 {
+		errs = append(errs, fmt.Errorf("upstream.breaker.failure_threshold: must not be negative, got %d", c.Upstream.Breaker.FailureThreshold))
+	}
+	if c.Upstream.BaseURL != "" {
+		if err := validateURL(c.Upstream.BaseURL); err != nil {
+			errs = append(errs, fmt.Errorf("upstream.base_url: %w", err))
+		}
+	}
+	errs = append(errs, c.Providers.validate()...)
+	if c.Repository.Storage != StorageMemory && c.Repository.Storage != StorageEvents {
+		errs = append(errs, fmt.Errorf("repository.storage: %q is not %s or %s", c.Repository.Storage, StorageMemory, StorageEvents))
+	}
+	if c.Repository.HistoryLimit < 1 || c.Repository.HistoryLimit > maxHistoryLimit {
+		errs = append(errs, fmt.Errorf("repository.history_limit: %d is outside 1..%d", c.Repository.HistoryLimit, maxHistoryLimit))
+	}
+	if c.Repository.EventLimit < 1 || c.Repository.EventLimit > maxEventLimit {
+		errs = append(errs, fmt.Errorf("repository.event_limit: %d is outside 1..%d", c.Repository.EventLimit, maxEventLimit))
+	}
+	errs = append(errs, c.Repository.Sanity.validate()...)
+	errs = append(errs, c.Auth.validate()...)
+	errs = append(errs, c.RateLimit.validate()...)
+	if c.Audit.MemoryLimit < 1 || c.Audit.MemoryLimit > maxAuditMemoryLimit {
+		errs = append(errs, fmt.Errorf("audit.memory_limit: %d is outside 1..%d", c.Audit.MemoryLimit, maxAuditMemoryLimit))
+	}
+	return errors.Join(errs...)
+}
+
+func (s SanityConfig) validate() []error {
+	var errs []error
+	if s.MaxDeviation < 0 || math.IsNaN(s.MaxDeviation) || math.IsInf(s.MaxDeviation, 0) {
+		errs = append(errs, fmt.Errorf("repository.sanity.max_deviation: must be a non-negative number, got %v", s.MaxDeviation))
+	}
+	if s.Window < 1 || s.Window > maxHistoryLimit {
+		errs = append(errs, fmt.Errorf("repository.sanity.window: %d is outside 1..%d", s.Window, maxHistoryLimit))
+	}
+	if s.Action != OutlierFlag && s.Action != OutlierQuarantine {
+		errs = append(errs, fmt.Errorf("repository.sanity.outlier_action: %q is not %s or %s", s.Action, OutlierFlag, OutlierQuarantine))
+	}
+	if s.ConfirmAfter < 0 {
+		errs = append(errs, fmt.Errorf("repository.sanity.confirm_after: must not be negative, got %d", s.ConfirmAfter))
+	}
+	if s.AnomalyLimit < 1 || s.AnomalyLimit > maxHistoryLimit {
+		errs = append(errs, fmt.Errorf("repository.sanity.anomaly_limit: %d is outside 1..%d", s.AnomalyLimit, maxHistoryLimit))
+	}
+	return errs
+}
+
+func (p ProvidersConfig) validate() []error {
+	var errs []error
+	if len(p.Enabled) == 0 {
+		errs = append(errs, errors.New("providers.enabled: at least one provider is required"))
+	}
+	for i, name := range p.Enabled {
+		if name != ProviderCoinGecko && name != ProviderBinance {
+			errs = append(errs, fmt.Errorf("providers.enabled: unknown provider %q (want %s or %s)", name, ProviderCoinGecko, ProviderBinance))
+		}
+		if slices.Index(p.Enabled, name) != i {
+			errs = append(errs, fmt.Errorf("providers.enabled: %q listed twice", name))
+		}
+	}
+	if p.Strategy != StrategyFallback && p.Strategy != StrategyMedian {
+		errs = append(errs, fmt.Errorf("providers.strategy: %q is not %s or %s", p.Strategy, StrategyFallback, StrategyMedian))
+	}
+	if slices.Contains(p.Enabled, ProviderBinance) {
+		if err := validateURL(p.Binance.BaseURL); err != nil {
+			errs = append(errs, fmt.Errorf("providers.binance.base_url: %w", err))
+		}
+		if p.Binance.QuoteAsset == "" {
+			errs = append(errs, errors.New("providers.binance.quote_asset: must not be empty"))
+		}
+	}
+	return errs
+}
+
+func validateURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%q: scheme must be http or https", s)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q: missing host", s)
+	}
+	return nil
+}
+
+// Duration is a time.Duration written as a Go duration string ("15s")
+// in files, env vars and flags.
+type Duration time.Duration
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+func (d Duration) MarshalText() ([]byte, error) { return []byte(d.String()), nil }
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
@@ -0,0 +1,271 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func envMap(m map[string]string) func(string) string {
+	return func(k string) string { return m[k] }
+}
+
+func writeFile(t *testing.T, name, body string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(body), 0o600); err != nil {
+		t.Fatalf("write %s: %v", p, err)
+	}
+	return p
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, opts, err := Load(nil, envMap(nil))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("Load() = %+v, want defaults %+v", cfg, Default())
+	}
+	if opts.File != "" || opts.PrintConfig {
+		t.Errorf("opts = %+v, want zero", opts)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "cfg.yaml", `
+server:
+  port: 9000
+  read_timeout: 3s
+upstream:
+  base_url: http://file.example
+repository:
+  history_limit: 50
+`)
+	env := envMap(map[string]string{
+		"PORT":               "9100",
+		"COINGECKO_BASE_URL": "http://env.example",
+	})
+	cfg, opts, err := Load([]string{"--config", file, "--port", "9200"}, env)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if opts.File != file {
+		t.Errorf("opts.File = %q, want %q", opts.File, file)
+	}
+	if cfg.Server.Port != 9200 {
+		t.Errorf("port = %d, want flag value 9200", cfg.Server.Port)
+	}
+	if cfg.Upstream.BaseURL != "http://env.example" {
+		t.Errorf("base_url = %q, want env value", cfg.Upstream.BaseURL)
+	}
+	if cfg.Server.ReadTimeout != Duration(3*time.Second) || cfg.Repository.HistoryLimit != 50 {
+		t.Errorf("file values not applied: %+v", cfg)
+	}
+	if cfg.Server.WriteTimeout != Default().Server.WriteTimeout {
+		t.Errorf("write_timeout = %s, want default", cfg.Server.WriteTimeout)
+	}
+}
+
+func TestLoadFileFromEnvAndJSON(t *testing.T) {
+	file := writeFile(t, "cfg.json", `{"server": {"port": 7000, "shutdown_timeout": "1m"}}`)
+	cfg, _, err := Load(nil, envMap(map[string]string{FileEnv: file}))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Server.Port != 7000 || cfg.Server.ShutdownTimeout != Duration(time.Minute) {
+		t.Errorf("JSON file not applied: %+v", cfg.Server)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want []string
+	}{
+		{name: "port range", env: map[string]string{"PORT": "70000"}, want: []string{"server.port"}},
+		{name: "port not int", env: map[string]string{"PORT": "http"}, want: []string{"env PORT"}},
+		{name: "bad duration flag", args: []string{"--http-idle-timeout", "forever"}, want: []string{"flag -http-idle-timeout"}},
+		{name: "negative duration", args: []string{"--ready-timeout", "-1s"}, want: []string{"server.ready_timeout"}},
+		{name: "negative rate limit", env: map[string]string{"COINGECKO_RATE_LIMIT": "-1"}, want: []string{"upstream.rate_limit"}},
+		{name: "zero retry attempts", env: map[string]string{"COINGECKO_RETRY_ATTEMPTS": "0"}, want: []string{"upstream.retry.max_attempts"}},
+		{
+			name: "backoff bounds inverted",
+			env:  map[string]string{"COINGECKO_RETRY_INITIAL_BACKOFF": "5s", "COINGECKO_RETRY_MAX_BACKOFF": "1s"},
+			want: []string{"upstream.retry.max_backoff"},
+		},
+		{name: "unknown provider", env: map[string]string{"PRICE_PROVIDERS": "coingecko,kraken"}, want: []string{`unknown provider "kraken"`}},
+		{name: "unknown strategy", env: map[string]string{"PRICE_STRATEGY": "average"}, want: []string{"providers.strategy"}},
+		{name: "outlier action", env: map[string]string{"PRICE_OUTLIER_ACTION": "drop"}, want: []string{"repository.sanity.outlier_action"}},
+		{name: "negative deviation", args: []string{"--price-max-deviation", "-0.1"}, want: []string{"repository.sanity.max_deviation"}},
+		{name: "auth without keys", env: map[string]string{"AUTH_ENABLED": "true"}, want: []string{"auth.keys: at least one key"}},
+		{name: "short api key", env: map[string]string{"API_KEYS": "ci:write:short"}, want: []string{"auth.keys[0].key"}},
+		{name: "api key scope", env: map[string]string{"API_KEYS": "ci:root:0123456789abcdef"}, want: []string{"auth.keys[0].scope"}},
+		{name: "api key tenant", env: map[string]string{"API_KEYS": "ci@Team A:read:0123456789abcdef"}, want: []string{"auth.keys[0].tenant"}},
+		{name: "api key format", env: map[string]string{"API_KEYS": "ci-write"}, want: []string{"env API_KEYS"}},
+		{name: "short hs256 secret", env: map[string]string{"JWT_HS256_SECRET": "too-short"}, want: []string{"auth.jwt.hs256_secret"}},
+		{name: "jwt role scope", env: map[string]string{"JWT_ROLE_SCOPES": "ops:root"}, want: []string{"auth.jwt.role_scopes[ops]"}},
+		{name: "jwt role scopes format", env: map[string]string{"JWT_ROLE_SCOPES": "ops"}, want: []string{"env JWT_ROLE_SCOPES"}},
+		{name: "negative jwt leeway", args: []string{"--jwt-leeway", "-1s"}, want: []string{"auth.jwt.leeway"}},
+		{name: "zero rate burst", env: map[string]string{"RATE_LIMIT_REFRESH_BURST": "0"}, want: []string{"rate_limit.refresh.burst"}},
+		{name: "negative rate", args: []string{"--rate-limit-read", "-1"}, want: []string{"rate_limit.read.rate"}},
+		{name: "rate route pattern", env: map[string]string{"RATE_LIMIT_ROUTES": "/crypto=1/1"}, want: []string{"rate_limit.routes[/crypto]"}},
+		{name: "rate route format", env: map[string]string{"RATE_LIMIT_ROUTES": "GET /crypto=1"}, want: []string{"env RATE_LIMIT_ROUTES"}},
+		{name: "audit memory limit", env: map[string]string{"AUDIT_MEMORY_LIMIT": "0"}, want: []string{"audit.memory_limit"}},
+		{name: "repository storage", env: map[string]string{"REPOSITORY_STORAGE": "disk"}, want: []string{"repository.storage"}},
+		{name: "event limit", args: []string{"--event-limit", "0"}, want: []string{"repository.event_limit"}},
+		{name: "negative purge delay", env: map[string]string{"PURGE_AFTER": "-1h"}, want: []string{"repository.purge_after"}},
+		{name: "negative cache ttl", env: map[string]string{"PRICE_CACHE_TTL": "-5s"}, want: []string{"cache.ttl"}},
+		{name: "url scheme", env: map[string]string{"COINGECKO_BASE_URL": "ftp://x"}, want: []string{"upstream.base_url"}},
+		{name: "url host", args: []string{"--coingecko-base-url", "http://"}, want: []string{"upstream.base_url"}},
+		{
+			name: "several at once",
+			args: []string{"--history-limit", "0", "--port", "0"},
+			want: []string{"repository.history_limit", "server.port"},
+		},
+		{name: "stray args", args: []string{"serve"}, want: []string{"unexpected arguments"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := Load(tc.args, envMap(tc.env))
+			if err == nil {
+				t.Fatal("Load succeeded, want error")
+			}
+			for _, w := range tc.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("error %q does not mention %q", err, w)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadProviderList(t *testing.T) {
+	cfg, _, err := Load([]string{"--price-strategy", "median-of-providers"}, envMap(map[string]string{
+		"PRICE_PROVIDERS":  " binance, coingecko ,",
+		"BINANCE_BASE_URL": "http://127.0.0.1:5060",
+	}))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	p := cfg.Providers
+	if !reflect.DeepEqual(p.Enabled, []string{"binance", "coingecko"}) || p.Strategy != StrategyMedian || p.Binance.BaseURL != "http://127.0.0.1:5060" {
+		t.Errorf("providers = %+v", p)
+	}
+}
+
+func TestLoadAPIKeyTenants(t *testing.T) {
+	cfg, _, err := Load(nil, envMap(map[string]string{
+		"API_KEYS": "ci@team-a:write:0123456789abcdef, ops:admin:fedcba9876543210",
+	}))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	want := []APIKeyConfig{
+		{Name: "ci", Scope: ScopeWrite, Key: "0123456789abcdef", Tenant: "team-a"},
+		{Name: "ops", Scope: ScopeAdmin, Key: "fedcba9876543210"},
+	}
+	if !reflect.DeepEqual(cfg.Auth.Keys, want) {
+		t.Errorf("keys = %+v, want %+v", cfg.Auth.Keys, want)
+	}
+}
+
+func TestLoadRateLimitRoutes(t *testing.T) {
+	cfg, _, err := Load(nil, envMap(map[string]string{
+		"RATE_LIMIT_ROUTES": "PUT /crypto/{symbol}/refresh=0.2/2, GET /crypto = 5 / 10",
+	}))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	want := map[string]RateBudget{
+		"PUT /crypto/{symbol}/refresh": {Rate: 0.2, Burst: 2},
+		"GET /crypto":                  {Rate: 5, Burst: 10},
+	}
+	if !reflect.DeepEqual(cfg.RateLimit.Routes, want) {
+		t.Errorf("routes = %+v, want %+v", cfg.RateLimit.Routes, want)
+	}
+}
+
+func TestLoadJWT(t *testing.T) {
+	cfg, _, err := Load(nil, envMap(map[string]string{
+		"AUTH_ENABLED":     "true",
+		"JWT_HS256_SECRET": "0123456789abcdef0123456789abcdef",
+		"JWT_ROLE_SCOPES":  "viewer:read, ops:admin",
+	}))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	j := cfg.Auth.JWT
+	if !j.Configured() || !reflect.DeepEqual(j.RoleScopes, map[string]string{"viewer": ScopeRead, "ops": ScopeAdmin}) {
+		t.Errorf("jwt = %+v", j)
+	}
+	var buf bytes.Buffer
+	if err := Print(&buf, cfg); err != nil {
+		t.Fatalf("Print: %v", err)
+	}
+	if strings.Contains(buf.String(), j.HS256Secret) {
+		t.Errorf("printed config leaks the HS256 secret:\n%s", buf.String())
+	}
+}
+
+func TestLoadFileRejectsUnknownKeys(t *testing.T) {
+	for name, body := range map[string]string{
+		"typo.yaml": "server:\n  prot: 1\n",
+		"typo.json": `{"server": {"prot": 1}}`,
+		"cfg.toml":  "port = 1",
+	} {
+		if _, _, err := Load([]string{"-config", writeFile(t, name, body)}, envMap(nil)); err == nil {
+			t.Errorf("%s: Load succeeded, want error", name)
+		}
+	}
+}
+
+func TestPrintRoundTrips(t *testing.T) {
+	want := Default()
+	want.Server.Port = 1234
+	want.Upstream.BaseURL = "https://example.com/api"
+	var buf bytes.Buffer
+	if err := Print(&buf, want); err != nil {
+		t.Fatalf("Print: %v", err)
+	}
+	got, _, err := Load([]string{"-config", writeFile(t, "printed.yaml", buf.String())}, envMap(nil))
+	if err != nil {
+		t.Fatalf("Load printed config: %v\n%s", err, buf.String())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip = %+v, want %+v", got, want)
+	}
+}
+
+func TestPrintHashesAPIKeys(t *testing.T) {
+	cfg, _, err := Load(nil, envMap(map[string]string{
+		"AUTH_ENABLED": "1",
+		"API_KEYS":     "ops:admin:secret-secret-secret, ro:read:another-secret-123",
+	}))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := Print(&buf, cfg); err != nil {
+		t.Fatalf("Print: %v", err)
+	}
+	if strings.Contains(buf.String(), "secret-secret") {
+		t.Fatalf("printed config leaks a key:\n%s", buf.String())
+	}
+	got, _, err := Load([]string{"-config", writeFile(t, "printed.yaml", buf.String())}, envMap(nil))
+	if err != nil {
+		t.Fatalf("Load printed config: %v\n%s", err, buf.String())
+	}
+	for i, k := range cfg.Auth.Keys {
+		want, _ := k.Hash()
+		if h, err := got.Auth.Keys[i].Hash(); err != nil || h != want || got.Auth.Keys[i].Scope != k.Scope {
+			t.Errorf("key %s did not round trip: %+v", k.Name, got.Auth.Keys[i])
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the environment variable that points at a config file
+// when --config is not given.
+const FileEnv = "CRYPTOSERVER_CONFIG"
+
+// Options are command-line switches that steer loading rather than
+// being part of Config.
+type Options struct {
+	// File is the config file that was read, if any.
+	File string
+	// PrintConfig asks the caller to print the effective config and exit.
+	PrintConfig bool
+}
+
+// setting binds one Config field to its env var and flag.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	set   func(string) error
+}
+
+func settings(c *Config) []setting {
+	return []setting{
+		{"port", "PORT", "HTTP listen port", intSetter(&c.Server.Port)},
+		{"http-read-header-timeout", "HTTP_READ_HEADER_TIMEOUT", "time allowed to read request headers", durationSetter(&c.Server.ReadHeaderTimeout)},
+		{"http-read-timeout", "HTTP_READ_TIMEOUT", "time allowed to read a whole request", durationSetter(&c.Server.ReadTimeout)},
+		{"http-write-timeout", "HTTP_WRITE_TIMEOUT", "time allowed to write a response", durationSetter(&c.Server.WriteTimeout)},
+		{"http-idle-timeout", "HTTP_IDLE_TIMEOUT", "keep-alive idle timeout", durationSetter(&c.Server.IdleTimeout)},
+		{"shutdown-timeout", "SHUTDOWN_TIMEOUT", "drain deadline for in-flight requests on exit", durationSetter(&c.Server.ShutdownTimeout)},
+		{"ready-timeout", "READY_TIMEOUT", "budget for /readyz checks", durationSetter(&c.Server.ReadyTimeout)},
+		{"coingecko-base-url", "COINGECKO_BASE_URL", "CoinGecko API base URL (empty: auto-detect)", stringSetter(&c.Upstream.BaseURL)},
+		{"coingecko-timeout", "COINGECKO_TIMEOUT", "timeout of each CoinGecko request", durationSetter(&c.Upstream.Timeout)},
+		{"coingecko-rate-limit", "COINGECKO_RATE_LIMIT", "max CoinGecko requests per second (0: unlimited)", floatSetter(&c.Upstream.RateLimit)},
+		{"coingecko-rate-burst", "COINGECKO_RATE_BURST", "CoinGecko requests allowed in a burst", intSetter(&c.Upstream.RateBurst)},
+		{"coingecko-retry-attempts", "COINGECKO_RETRY_ATTEMPTS", "tries per CoinGecko GET, including the first (1: no retries)", intSetter(&c.Upstream.Retry.MaxAttempts)},
+		{"coingecko-retry-initial-backoff", "COINGECKO_RETRY_INITIAL_BACKOFF", "delay before the first retry; doubles per retry", durationSetter(&c.Upstream.Retry.InitialBackoff)},
+		{"coingecko-retry-max-backoff", "COINGECKO_RETRY_MAX_BACKOFF", "upper bound of the retry delay", durationSetter(&c.Upstream.Retry.MaxBackoff)},
+		{"coingecko-breaker-threshold", "COINGECKO_BREAKER_THRESHOLD", "consecutive failed CoinGecko calls that open the circuit (0: no breaker)", intSetter(&c.Upstream.Breaker.FailureThreshold)},
+		{"coingecko-breaker-open-timeout", "COINGECKO_BREAKER_OPEN_TIMEOUT", "how long the circuit stays open before probing", durationSetter(&c.Upstream.Breaker.OpenTimeout)},
+		{"price-providers", "PRICE_PROVIDERS", "comma-separated price providers in priority order (coingecko, binance)", listSetter(&c.Providers.Enabled)},
+		{"price-strategy", "PRICE_STRATEGY", "how provider prices combine: primary-then-fallback or median-of-providers", stringSetter(&c.Providers.Strategy)},
+		{"binance-base-url", "BINANCE_BASE_URL", "Binance-compatible ticker API base URL", stringSetter(&c.Providers.Binance.BaseURL)},
+		{"binance-quote-asset", "BINANCE_QUOTE_ASSET", "quote asset of Binance markets (BTC+USDT)", stringSetter(&c.Providers.Binance.QuoteAsset)},
+		{"binance-timeout", "BINANCE_TIMEOUT", "timeout of each Binance request", durationSetter(&c.Providers.Binance.Timeout)},
+		{"repository-storage", "REPOSITORY_STORAGE", "coin storage: memory or events (replayable event log)", stringSetter(&c.Repository.Storage)},
+		{"history-limit", "HISTORY_LIMIT", "price records retained per coin", intSetter(&c.Repository.HistoryLimit)},
+		{"event-limit", "EVENT_LIMIT", "events retained per tenant with events storage", intSetter(&c.Repository.EventLimit)},
+		{"purge-after", "PURGE_AFTER", "how long a deleted coin can be restored before it is purged (0: delete at once)", durationSetter(&c.Repository.PurgeAfter)},
+		{"price-max-deviation", "PRICE_MAX_DEVIATION", "largest accepted relative move from recent prices, e.g. 0.5 (0: no check)", floatSetter(&c.Repository.Sanity.MaxDeviation)},
+		{"price-deviation-window", "PRICE_DEVIATION_WINDOW", "recent prices whose median a new price is compared to", intSetter(&c.Repository.Sanity.Window)},
+		{"price-outlier-action", "PRICE_OUTLIER_ACTION", "what to do with an outlying price: flag or quarantine", stringSetter(&c.Repository.Sanity.Action)},
+		{"price-confirm-after", "PRICE_CONFIRM_AFTER", "consecutive agreeing quarantined prices accepted as a real move (0: never)", intSetter(&c.Repository.Sanity.ConfirmAfter)},
+		{"anomaly-limit", "ANOMALY_LIMIT", "rejected or flagged prices retained per coin", intSetter(&c.Repository.Sanity.AnomalyLimit)},
+		{"auth-enabled", "AUTH_ENABLED", "require an API key on all but health and docs endpoints", boolSetter(&c.Auth.Enabled)},
+		{"api-keys", "API_KEYS", "comma-separated API keys as name[@tenant]:scope:key (scope: read, write, admin)", apiKeysSetter(&c.Auth.Keys)},
+		{"jwt-hs256-secret", "JWT_HS256_SECRET", "secret verifying HS256 bearer tokens (at least 32 bytes)", stringSetter(&c.Auth.JWT.HS256Secret)},
+		{"jwt-jwks-file", "JWT_JWKS_FILE", "local JWKS file with keys verifying bearer tokens", stringSetter(&c.Auth.JWT.JWKSFile)},
+		{"jwt-issuer", "JWT_ISSUER", "required iss claim of bearer tokens", stringSetter(&c.Auth.JWT.Issuer)},
+		{"jwt-audience", "JWT_AUDIENCE", "required aud claim of bearer tokens", stringSetter(&c.Auth.JWT.Audience)},
+		{"jwt-role-claim", "JWT_ROLE_CLAIM", "claim listing the caller's roles", stringSetter(&c.Auth.JWT.RoleClaim)},
+		{"jwt-role-scopes", "JWT_ROLE_SCOPES", "comma-separated role:scope pairs mapping token roles to scopes", roleScopesSetter(&c.Auth.JWT.RoleScopes)},
+		{"jwt-tenant-claim", "JWT_TENANT_CLAIM", "claim binding the caller to a tenant", stringSetter(&c.Auth.JWT.TenantClaim)},
+		{"jwt-leeway", "JWT_LEEWAY", "clock skew tolerated when checking exp and nbf", durationSetter(&c.Auth.JWT.Leeway)},
+		{"rate-limit-enabled", "RATE_LIMIT_ENABLED", "limit inbound requests per API key or client IP", boolSetter(&c.RateLimit.Enabled)},
+		{"rate-limit-read", "RATE_LIMIT_READ", "requests per second per client on routes that do not fetch prices (0: unlimited)", floatSetter(&c.RateLimit.Read.Rate)},
+		{"rate-limit-read-burst", "RATE_LIMIT_READ_BURST", "burst of requests per client on routes that do not fetch prices", intSetter(&c.RateLimit.Read.Burst)},
+		{"rate-limit-refresh", "RATE_LIMIT_REFRESH", "requests per second per client on routes that fetch prices (0: unlimited)", floatSetter(&c.RateLimit.Refresh.Rate)},
+		{"rate-limit-refresh-burst", "RATE_LIMIT_REFRESH_BURST", "burst of requests per client on routes that fetch prices", intSetter(&c.RateLimit.Refresh.Burst)},
+		{"rate-limit-routes", "RATE_LIMIT_ROUTES", "per-route budgets as comma-separated METHOD /path=rate/burst", rateRoutesSetter(&c.RateLimit.Routes)},
+		{"rate-limit-trust-proxy", "RATE_LIMIT_TRUST_PROXY", "take the client IP from the last X-Forwarded-For entry", boolSetter(&c.RateLimit.TrustProxy)},
+		{"audit-file", "AUDIT_FILE", "append the audit log to this JSON-lines file (empty: memory only)", stringSetter(&c.Audit.File)},
+		{"audit-memory-limit", "AUDIT_MEMORY_LIMIT", "newest audit entries kept searchable in memory", intSetter(&c.Audit.MemoryLimit)},
+		{"price-cache-ttl", "PRICE_CACHE_TTL", "how long a fetched price is reused (0 disables caching)", durationSetter(&c.Cache.TTL)},
+		{"price-cache-stale-ttl", "PRICE_CACHE_STALE_TTL", "how long past TTL a price may be served while upstream fails", durationSetter(&c.Cache.StaleTTL)},
+	}
+}
+
+func intSetter(dst *int) func(string) error {
+	return func(s string) error {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", s)
+		}
+		*dst = n
+		return nil
+	}
+}
+
+func boolSetter(dst *bool) func(string) error {
+	return func(s string) error {
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", s)
+		}
+		*dst = b
+		return nil
+	}
+}
+
+func floatSetter(dst *float64) func(string) error {
+	return func(s string) error {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		*dst = f
+		return nil
+	}
+}
+
+func durationSetter(dst *Duration) func(string) error {
+	return func(s string) error {
+		if err := dst.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+			return fmt.Errorf("%q is not a duration (e.g. 15s)", s)
+		}
+		return nil
+	}
+}
+
+func listSetter(dst *[]string) func(string) error {
+	return func(s string) error {
+		var out []string
+		for _, v := range strings.Split(s, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				out = append(out, v)
+			}
+		}
+		*dst = out
+		return nil
+	}
+}
+
+func stringSetter(dst *string) func(string) error {
+	return func(s string) error {
+		*dst = strings.TrimSpace(s)
+		return nil
+	}
+}
+
+// Load builds the effective configuration:
+// defaults < config file < environment < flags.
+// args excludes the program name. getenv is usually os.Getenv.
+func Load(args []string, getenv func(string) string) (Config, Options, error) {
+	var opts Options
+	fs := flag.NewFlagSet("cryptoserver", flag.ContinueOnError)
+	fs.StringVar(&opts.File, "config", "", "path to a YAML or JSON config file (env "+FileEnv+")")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the effective configuration and exit")
+
+	// Flags are parsed into raw strings first and applied last so they
+	// win over the file and environment.
+	cfg := Default()
+	table := settings(&cfg)
+	raw := make(map[string]*string, len(table))
+	for _, s := range table {
+		raw[s.flag] = fs.String(s.flag, "", s.usage+" (env "+s.env+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, opts, err
+	}
+	if fs.NArg() > 0 {
+		return cfg, opts, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	if opts.File == "" {
+		opts.File = getenv(FileEnv)
+	}
+	if opts.File != "" {
+		if err := loadFile(opts.File, &cfg); err != nil {
+			return cfg, opts, err
+		}
+	}
+
+	for _, s := range table {
+		if v := getenv(s.env); v != "" {
+			if err := s.set(v); err != nil {
+				return cfg, opts, fmt.Errorf("env %s: %w", s.env, err)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range table {
+			if s.flag == f.Name && flagErr == nil {
+				if err := s.set(*raw[s.flag]); err != nil {
+					flagErr = fmt.Errorf("flag -%s: %w", s.flag, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return cfg, opts, flagErr
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, opts, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, opts, nil
+}
+
+// loadFile overlays the file onto cfg. Unknown keys are errors so typos
+// don't silently fall back to defaults.
+func loadFile(path string, cfg *Config) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err = dec.Decode(cfg); err == io.EOF {
+			err = nil // empty file
+		}
+	default:
+		return fmt.Errorf("config file %s: unsupported extension (want .yaml, .yml or .json)", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Print writes c as YAML, in a form Load accepts back as a config file.
+// API keys are printed as their SHA-256 hash.
+func Print(w io.Writer, c Config) error {
+	c.Auth = c.Auth.redacted()
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	return enc.Close()
+}
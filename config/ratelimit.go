@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RateLimitConfig limits inbound requests per client: per API key or
+// token subject when the caller authenticated, else per client IP.
+type RateLimitConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// Read is the budget of API routes that do not fetch prices; Refresh
+	// that of routes that do (POST /crypto, PUT /crypto/{symbol}/refresh).
+	// Health, readiness and docs are never limited.
+	Read    RateBudget `json:"read" yaml:"read"`
+	Refresh RateBudget `json:"refresh" yaml:"refresh"`
+	// Routes gives single routes, keyed by their pattern such as
+	// "PUT /crypto/{symbol}/refresh", a budget of their own.
+	Routes map[string]RateBudget `json:"routes" yaml:"routes"`
+	// TrustProxy takes the client IP from the last X-Forwarded-For entry,
+	// for deployments behind a reverse proxy that appends it.
+	TrustProxy bool `json:"trust_proxy" yaml:"trust_proxy"`
+}
+
+// RateBudget is a token bucket: Rate requests per second on average with
+// bursts of up to Burst. A zero Rate means unlimited.
+type RateBudget struct {
+	Rate  float64 `json:"rate" yaml:"rate"`
+	Burst int     `json:"burst" yaml:"burst"`
+}
+
+// routePatternRe matches ServeMux patterns with a method.
+var routePatternRe = regexp.MustCompile(`^[A-Z]+ /\S*$`)
+
+func (r RateLimitConfig) validate() []error {
+	errs := append(r.Read.validate("rate_limit.read"), r.Refresh.validate("rate_limit.refresh")...)
+	for pattern, b := range r.Routes {
+		at := fmt.Sprintf("rate_limit.routes[%s]", pattern)
+		if !routePatternRe.MatchString(pattern) {
+			errs = append(errs, fmt.Errorf("%s: want a route pattern like \"PUT /crypto/{symbol}/refresh\"", at))
+		}
+		errs = append(errs, b.validate(at)...)
+	}
+	return errs
+}
+
+func (b RateBudget) validate(at string) []error {
+	var errs []error
+	if b.Rate < 0 || math.IsNaN(b.Rate) || math.IsInf(b.Rate, 0) {
+		errs = append(errs, fmt.Errorf("%s.rate: must be a non-negative number, got %v", at, b.Rate))
+	}
+	if b.Burst < 1 {
+		errs = append(errs, fmt.Errorf("%s.burst: must be at least 1, got %d", at, b.Burst))
+	}
+	return errs
+}
+
+// rateRoutesSetter parses "METHOD /path=rate/burst" entries separated by
+// commas, e.g. "PUT /crypto/{symbol}/refresh=0.2/2".
+func rateRoutesSetter(dst *map[string]RateBudget) func(string) error {
+	return func(s string) error {
+		out := make(map[string]RateBudget)
+		for _, v := range strings.Split(s, ",") {
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			pattern, budget, ok := strings.Cut(v, "=")
+			rate, burst, ok2 := strings.Cut(budget, "/")
+			if !ok || !ok2 {
+				return fmt.Errorf("%q is not METHOD /path=rate/burst", v)
+			}
+			var b RateBudget
+			var err error
+			if b.Rate, err = strconv.ParseFloat(strings.TrimSpace(rate), 64); err != nil {
+				return fmt.Errorf("%q: rate: %w", v, err)
+			}
+			if b.Burst, err = strconv.Atoi(strings.TrimSpace(burst)); err != nil {
+				return fmt.Errorf("%q: burst: %w", v, err)
+			}
+			out[strings.TrimSpace(pattern)] = b
+		}
+		*dst = out
+		return nil
+	}
+}
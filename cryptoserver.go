@@ -1,37 +1,191 @@
 package main
 
 import (
-    "errors"
-    "fmt"
-    "cryptoserver/repository"
-    "cryptoserver/server"
-    "log"
-    "net/http"
-    "os"
-    "strconv"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"cryptoserver/audit"
+	"cryptoserver/auth"
+	"cryptoserver/config"
+	"cryptoserver/gecko/geckoclient"
+	"cryptoserver/pricecache"
+	"cryptoserver/providers"
+	"cryptoserver/repository"
+	"cryptoserver/server"
 )
 
-func envPort() (int, error) {
-    p := os.Getenv("PORT")
-    if p == "" {
-        return 8080, nil
-    }
-    n, err := strconv.Atoi(p)
-	if err != nil || n <= 0 || n > 65535 {
-		return 0, errors.New("invalid PORT")
+// purgeEvery is how often deleted coins past repository.purge_after are
+// purged.
+const purgeEvery = time.Minute
+
+// refreshCheckEvery is how often coins are checked against their refresh
+// policies; it bounds how late an automatic refresh can run.
+const refreshCheckEvery = 5 * time.Second
+
+// stopFunc releases one component on shutdown.
+type stopFunc struct {
+	name string
+	stop func(context.Context) error
+}
+
+// shutdown stops components in order, sharing the remaining drain budget.
+func shutdown(ctx context.Context, logger *slog.Logger, steps []stopFunc) {
+	for _, s := range steps {
+		start := time.Now()
+		if err := s.stop(ctx); err != nil {
+			logger.Error("shutdown step failed", "step", s.name, "err", err)
+			continue
+		}
+		logger.Info("shutdown step done", "step", s.name, "duration", time.Since(start))
 	}
-	return n, nil
 }
 
 func main() {
-    s := server.New(repository.NewMemoryCryptoRepo())
-    p, err := envPort()
-    if err != nil {
-        log.Fatal(err)
-    }
-    addr := fmt.Sprintf(":%d", p)
-    log.Printf("listening on %s", addr)
-    if err := http.ListenAndServe(addr, s); err != nil {
-        log.Fatal(err)
-    }
+	logger := slog.Default()
+
+	cfg, opts, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if opts.PrintConfig {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if opts.File != "" {
+		logger.Info("loaded config file", "path", opts.File)
+	}
+
+	gecko := geckoclient.New(cfg.Upstream)
+	loadCtx, cancelLoad := context.WithTimeout(context.Background(), time.Duration(cfg.Upstream.Timeout))
+	err = gecko.LoadCoins(loadCtx)
+	cancelLoad()
+	if err != nil {
+		log.Fatalf("geckoclient initialization failed: %v", err)
+	}
+	logger.Info("upstream ready", "base_url", gecko.BaseURL(), "coins", gecko.CoinCount())
+
+	prices := providers.FromConfig(cfg.Providers, gecko)
+	logger.Info("price providers", "providers", prices.Names(), "strategy", cfg.Providers.Strategy)
+	cache := pricecache.New(cfg.Cache, prices)
+	auditLog, err := audit.Open(cfg.Audit)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	// Every tenant fetches through the same cache, so tenants tracking the
+	// same coin share upstream calls, and records its changes in the
+	// shared audit log.
+	tenants := repository.NewTenants(func(tenant string) repository.CryptoRepository {
+		return repository.NewAudited(repository.FromConfig(cfg.Repository, cache), auditLog, tenant)
+	})
+	var repo repository.CryptoRepository = tenants.For(config.DefaultTenant)
+	purgeCtx, stopPurger := context.WithCancel(context.Background())
+	purgerDone := make(chan struct{})
+	go func() {
+		defer close(purgerDone)
+		tenants.RunPurger(purgeCtx, purgeEvery)
+	}()
+	refreshCtx, stopRefresher := context.WithCancel(context.Background())
+	refresherDone := make(chan struct{})
+	go func() {
+		defer close(refresherDone)
+		tenants.RunRefresher(refreshCtx, refreshCheckEvery)
+	}()
+	keys := auth.NewKeyStore(cfg.Auth)
+	jwt, err := auth.NewJWTVerifier(cfg.Auth.JWT)
+	if err != nil {
+		log.Fatalf("auth: %v", err)
+	}
+	logger.Info("authentication", "enabled", keys.Enabled(), "keys", len(keys.List()), "jwt", jwt != nil)
+	s := server.NewWithConfig(cfg.Server, repo, gecko,
+		server.WithPriceCache(cache),
+		server.WithKeyStore(keys),
+		server.WithJWTVerifier(jwt),
+		server.WithTenants(tenants),
+		server.WithRateLimit(cfg.RateLimit),
+		server.WithAuditLog(auditLog),
+	)
+
+	httpSrv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler:           s.Handler(logger),
+		ReadHeaderTimeout: time.Duration(cfg.Server.ReadHeaderTimeout),
+		ReadTimeout:       time.Duration(cfg.Server.ReadTimeout),
+		WriteTimeout:      time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.Server.IdleTimeout),
+		MaxHeaderBytes:    1 << 20,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Info("listening", "addr", httpSrv.Addr)
+		serveErr <- httpSrv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	// A second signal now terminates immediately.
+	stop()
+	s.Drain()
+	logger.Info("shutting down", "drain_timeout", cfg.Server.ShutdownTimeout)
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout))
+	defer cancel()
+
+	steps := []stopFunc{
+		{"http", func(ctx context.Context) error {
+			if err := httpSrv.Shutdown(ctx); err != nil {
+				_ = httpSrv.Close()
+				return err
+			}
+			return nil
+		}},
+	}
+	// Background workers stop after HTTP so in-flight requests still see them,
+	// and the audit log is closed last so nothing writes after it.
+	steps = append(steps, stopFunc{"refresher", func(ctx context.Context) error {
+		stopRefresher()
+		select {
+		case <-refresherDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}})
+	steps = append(steps, stopFunc{"purger", func(ctx context.Context) error {
+		stopPurger()
+		select {
+		case <-purgerDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}})
+	steps = append(steps, stopFunc{"audit", func(context.Context) error { return auditLog.Close() }})
+	shutdown(drainCtx, logger, steps)
+
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("server error", "err", err)
+	}
+	logger.Info("stopped")
 }
@@ -3,24 +3,29 @@ package main
 import (
 	"encoding/json"
 	"cryptoserver/gecko/geckocoins"
+	"flag"
 	"log"
 	"math"
-	"math/rand"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 // Coin is the minimal shape expected from /api/v3/coins/list
 // We only need ID to filter unknown ids later.
 func main() {
-	addr := "127.0.0.1:5050"
+	addr := flag.String("addr", "127.0.0.1:5050", "listen address")
 	listPath := "crypto_list.json"
+	rateLimit := flag.Int("rate-limit", 0, "requests allowed per window before answering 429 (0: unlimited)")
+	rateWindow := flag.Duration("rate-window", time.Minute, "rate limit window")
+	flag.Parse()
 
-	// Load and cache coins list bytes. Also build a set of known ids (lowercase).
-	coinsBytes, idSet := loadCoins(listPath)
+	// Load and cache coins list bytes. Also map known ids (lowercase) to symbols.
+	coinsBytes, idSymbols := loadCoins(listPath)
 
 	mux := http.NewServeMux()
 
@@ -30,6 +35,12 @@ func main() {
 		_, _ = w.Write(coinsBytes)
 	})
 
+	// GET /ping — liveness probe, same shape as CoinGecko
+	mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_, _ = w.Write([]byte(`{"gecko_says":"(V3) To the Moon!"}`))
+	})
+
 	// GET /simple/price?ids=...&vs_currencies=...
 	mux.HandleFunc("/simple/price", func(w http.ResponseWriter, r *http.Request) {
 		q := r.URL.Query()
@@ -55,12 +66,13 @@ func main() {
 		// Build response: omit unknown ids; include requested currencies.
 		resp := make(map[string]map[string]float64, len(ids))
 		for _, id := range ids {
-			if _, ok := idSet[id]; !ok {
+			symbol, ok := idSymbols[id]
+			if !ok {
 				continue
 			}
 			inner := make(map[string]float64, len(vcs))
 			for _, c := range vcs {
-				inner[c] = randomPrice(0.000001, 1_000_000)
+				inner[c] = geckocoins.FakePrice(symbol)
 			}
 			resp[id] = inner
 		}
@@ -71,13 +83,54 @@ func main() {
 		_ = enc.Encode(resp)
 	})
 
-	log.Printf("Fake CoinGecko server: http://%s", addr)
-	if err := http.ListenAndServe(addr, mux); err != nil {
+	var handler http.Handler = mux
+	if *rateLimit > 0 {
+		handler = limitRate(mux, *rateLimit, *rateWindow)
+		log.Printf("Rate limit: %d requests per %s", *rateLimit, *rateWindow)
+	}
+
+	log.Printf("Fake CoinGecko server: http://%s", *addr)
+	if err := http.ListenAndServe(*addr, handler); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func loadCoins(path string) ([]byte, map[string]struct{}) {
+// limitRate answers 429 with Retry-After once more than limit requests
+// arrive within a fixed window, like the public API's throttling.
+func limitRate(next http.Handler, limit int, window time.Duration) http.Handler {
+	var (
+		mu    sync.Mutex
+		start = time.Now()
+		count int
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		now := time.Now()
+		if now.Sub(start) >= window {
+			start, count = now, 0
+		}
+		count++
+		over := count > limit
+		retry := start.Add(window).Sub(now)
+		mu.Unlock()
+
+		if over {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"status": map[string]any{
+					"error_code":    http.StatusTooManyRequests,
+					"error_message": "You've exceeded the Rate Limit.",
+				},
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func loadCoins(path string) ([]byte, map[string]string) {
 	if path == "" {
 		log.Fatal("-list path must not be empty")
 	}
@@ -90,11 +143,11 @@ func loadCoins(path string) ([]byte, map[string]struct{}) {
 	if err := json.Unmarshal(b, &coins); err != nil {
 		log.Fatalf("parse coins list JSON: %v", err)
 	}
-	ids := make(map[string]struct{}, len(coins))
+	ids := make(map[string]string, len(coins))
 	for _, c := range coins {
 		id := strings.ToLower(strings.TrimSpace(c.ID))
 		if id != "" {
-			ids[id] = struct{}{}
+			ids[id] = c.Symbol
 		}
 	}
 	return b, ids
@@ -115,15 +168,6 @@ func splitCSV(s string) []string {
 	return out
 }
 
-// randomPrice returns a uniform random float64 in [min,max] rounded to 6 decimals.
-func randomPrice(min, max float64) float64 {
-	if max <= min {
-		return min
-	}
-	u := rand.New(rand.NewSource(time.Now().UnixNano())).Float64() // [0,1)
-	return math.Round((min+u*(max-min))*1e6) / 1e6
-}
-
 func writeJSONError(w http.ResponseWriter, status int, msg string) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(status)
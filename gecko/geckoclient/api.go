@@ -2,47 +2,97 @@ package geckoclient
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"cryptoserver/config"
 	"cryptoserver/gecko/geckocoins"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
-var tickerMap map[string]geckocoins.CoinInfo
-
-// Base URL is configurable via env COINGECKO_BASE_URL.
-// If not set, auto-detects local fake server, else falls back to real API.
-var baseUrl string
+const (
+	localFakeURL = "http://127.0.0.1:5050"
+	publicURL    = "https://api.coingecko.com/api/v3"
+)
 
 var (
     ErrNotFound          = errors.New("not found")
     ErrServiceUnavailable = errors.New("service unavailable")
     ErrBadResponse       = errors.New("bad response")
+    ErrRateLimited       = errors.New("rate limited")
+    ErrUnauthorized      = errors.New("upstream rejected credentials")
 )
 
-func init() {
-	baseUrl = os.Getenv("COINGECKO_BASE_URL")
-	if baseUrl == "" {
+// Client talks to a CoinGecko-compatible API. The symbol→id map from
+// /coins/list is loaded once and reused for name and price lookups.
+type Client struct {
+	baseURL string
+	http    *http.Client
+
+	loadMu    sync.Mutex // serializes LoadCoins
+	mu        sync.RWMutex
+	tickerMap map[string]geckocoins.CoinInfo
+
+	retry   config.RetryConfig
+	limiter *limiter
+	breaker *breaker
+	status  statusTracker
+}
+
+// New builds a client from cfg. An empty BaseURL auto-detects the local
+// fake server, else falls back to the real API. It does not touch the
+// network beyond that probe; call LoadCoins to fail fast at startup.
+func New(cfg config.UpstreamConfig) *Client {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
 		if isLocalFakeAlive() {
-			baseUrl = "http://127.0.0.1:5050"
+			baseURL = localFakeURL
 		} else {
-			baseUrl = "https://api.coingecko.com/api/v3"
+			baseURL = publicURL
 		}
 	}
-	if err := loadAllCryptoNames(); err != nil {
-		log.Fatalf("geckoclient initialization failed: %v", err)
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{Timeout: time.Duration(cfg.Timeout)},
+		retry:   cfg.Retry,
+		limiter: newLimiter(cfg.RateLimit, cfg.RateBurst),
+		breaker: newBreaker(cfg.Breaker),
+		status:  statusTracker{calls: make(map[string]*callTracker)},
 	}
 }
 
+var (
+	defaultOnce   sync.Once
+	defaultClient *Client
+)
+
+// Default returns the process-wide client used by the package-level
+// functions, configured from the environment (see config.Load).
+func Default() *Client {
+	defaultOnce.Do(func() {
+		cfg, _, err := config.Load(nil, os.Getenv)
+		if err != nil {
+			log.Printf("geckoclient: %v; using defaults", err)
+			cfg = config.Default()
+		}
+		defaultClient = New(cfg.Upstream)
+	})
+	return defaultClient
+}
+
+// BaseURL is the resolved upstream base URL.
+func (c *Client) BaseURL() string { return c.baseURL }
+
 func isLocalFakeAlive() bool {
 	client := &http.Client{Timeout: 500 * time.Millisecond}
-	resp, err := client.Get("http://127.0.0.1:5050/coins/list")
+	resp, err := client.Get(localFakeURL + "/coins/list")
 	if err != nil {
 		return false
 	}
@@ -58,21 +108,27 @@ func isLocalFakeAlive() bool {
 	return len(trimmed) > 0 && trimmed[0] == '['
 }
 
-func loadAllCryptoNames() error {
-	//log.Println("LoadAllCryptoNames: starting")
-	url := baseUrl + "/coins/list"
-	//log.Printf("LoadAllCryptoNames: GET %s", url)
-	resp, err := http.Get(url)
+// LoadCoins (re)loads the symbol→coin map from /coins/list.
+func (c *Client) LoadCoins(ctx context.Context) (err error) {
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+	start := time.Now()
+	defer func() { c.observe(callCoinsList, start, err) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/coins/list", nil)
 	if err != nil {
 		return fmt.Errorf("%w: %v", ErrServiceUnavailable, err)
 	}
+	resp, err := c.send(callCoinsList, req)
+	if err != nil {
+		return err
+	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := readBody(resp)
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrServiceUnavailable, err)
+		return err
 	}
-	//log.Printf("LoadAllCryptoNames: received %d bytes", len(body))
 
 	// ensure response is JSON array
 	trimmed := bytes.TrimLeft(body, " \t\r\n")
@@ -84,65 +140,112 @@ func loadAllCryptoNames() error {
 	if err := json.Unmarshal(body, &coins); err != nil {
 		return fmt.Errorf("%w: %v", ErrBadResponse, err)
 	}
-	// detect symbol collisions
-	symbolCount := make(map[string]int)
-	// reset tickerMap and use lowercase keys
-	tickerMap = make(map[string]geckocoins.CoinInfo)
+	// first id wins on symbol collisions; keys are lowercase
+	tickers := make(map[string]geckocoins.CoinInfo, len(coins))
 	for _, coin := range coins {
 		key := strings.ToLower(coin.Symbol)
-		symbolCount[key]++
-		if symbolCount[key] > 1 {
-			//log.Printf("LoadAllCryptoNames: collision for symbol %q: duplicate id %q (first id %q)", key, coin.ID, tickerMap[key].ID)
+		if _, dup := tickers[key]; dup {
 			continue
 		}
-		tickerMap[key] = coin
+		tickers[key] = coin
 	}
-	//log.Printf("LoadAllCryptoNames: mapped %d symbols", len(tickerMap))
+	c.mu.Lock()
+	c.tickerMap = tickers
+	c.mu.Unlock()
 	return nil
 }
 
-func GetPrice(symbol string) (float64, error) {
-	//log.Printf("GetPrice: called with symbol %q", symbol)
+// coins returns the symbol map, loading it on first use.
+func (c *Client) coins() (map[string]geckocoins.CoinInfo, error) {
+	c.mu.RLock()
+	m := c.tickerMap
+	c.mu.RUnlock()
+	if m != nil {
+		return m, nil
+	}
+	if err := c.LoadCoins(context.Background()); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tickerMap, nil
+}
+
+func (c *Client) GetPrice(symbol string) (price float64, err error) {
 	key := strings.ToLower(symbol)
-	info, ok := tickerMap[key]
-	var id string
-	if ok {
-		id = info.ID
-	} else {
-		id = key
-	}
-	url := fmt.Sprintf(baseUrl+"/simple/price?ids=%s&vs_currencies=usd", id)
-	//log.Printf("GetPrice: requesting URL %s", url)
-	resp, err := http.Get(url)
+	id := key
+	if m, err := c.coins(); err == nil {
+		if info, ok := m[key]; ok {
+			id = info.ID
+		}
+	}
+	start := time.Now()
+	defer func() { c.observe(callPrice, start, err) }()
+
+	url := fmt.Sprintf(c.baseURL+"/simple/price?ids=%s&vs_currencies=usd", id)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return 0, fmt.Errorf("%w: %v", ErrServiceUnavailable, err)
 	}
+	resp, err := c.send(callPrice, req)
+	if err != nil {
+		return 0, err
+	}
 	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	body, err := readBody(resp)
 	if err != nil {
-		return 0, fmt.Errorf("%w: %v", ErrServiceUnavailable, err)
+		return 0, err
 	}
-	//log.Printf("GetPrice: response body length %d bytes", len(body))
 	var data map[string]map[string]float64
 	if err := json.Unmarshal(body, &data); err != nil {
-		log.Printf("%s", body)
-		return 0, fmt.Errorf("%w: %v", ErrBadResponse, err)
+		return 0, fmt.Errorf("%w: price response is not JSON: %v", ErrBadResponse, err)
 	}
 	if priceData, ok := data[id]; ok {
 		if price, ok := priceData["usd"]; ok {
-			//log.Printf("GetPrice: price for %q is %f", symbol, price)
 			return price, nil
 		}
 	}
 	return 0, fmt.Errorf("%w: price not found for %s", ErrNotFound, symbol)
 }
 
-func GetName(symbol string) (string, error) {
-	//log.Printf("GetName: called with symbol %q", symbol)
-	key := strings.ToLower(symbol)
-	info, ok := tickerMap[key]
-	if ok {
+func (c *Client) GetName(symbol string) (string, error) {
+	m, err := c.coins()
+	if err != nil {
+		return "", err
+	}
+	if info, ok := m[strings.ToLower(symbol)]; ok {
 		return info.Name, nil
 	}
 	return "", fmt.Errorf("%w: name not found for %s", ErrNotFound, symbol)
 }
+
+// CoinCount is the number of symbols loaded from /coins/list.
+func (c *Client) CoinCount() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.tickerMap)
+}
+
+// Ping checks that the upstream answers /ping with a 2xx within ctx;
+// other answers come back as an *UpstreamError.
+func (c *Client) Ping(ctx context.Context) (err error) {
+	start := time.Now()
+	defer func() { c.observe(callPing, start, err) }()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/ping", nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrServiceUnavailable, err)
+	}
+	resp, err := c.send(callPing, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBytes))
+	return nil
+}
+
+// GetPrice looks up the USD price of symbol with the Default client.
+func GetPrice(symbol string) (float64, error) { return Default().GetPrice(symbol) }
+
+// GetName looks up the display name of symbol with the Default client.
+func GetName(symbol string) (string, error) { return Default().GetName(symbol) }
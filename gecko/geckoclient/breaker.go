@@ -0,0 +1,133 @@
+package geckoclient
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"cryptoserver/config"
+)
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case stateOpen:
+		return "open"
+	case stateHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// outcome is how one call affects the breaker.
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeFailure
+	// outcomeNeutral is a call that says nothing about upstream health,
+	// e.g. one we held back ourselves or one the caller cancelled.
+	outcomeNeutral
+)
+
+// breaker is a consecutive-failure circuit breaker. Closed, calls go
+// through; after threshold failures in a row it opens and calls fail fast
+// until openTimeout passes; then it is half-open and lets a single probe
+// through, closing on success and re-opening on failure.
+type breaker struct {
+	threshold   int
+	openTimeout time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	opens    int64
+}
+
+func newBreaker(cfg config.BreakerConfig) *breaker {
+	return &breaker{threshold: cfg.FailureThreshold, openTimeout: time.Duration(cfg.OpenTimeout)}
+}
+
+// allow reports whether a call may go out now. In the half-open state only
+// the first caller gets through; the rest fail fast until it reports back.
+func (b *breaker) allow(now time.Time) error {
+	if b.threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case stateOpen:
+		if wait := b.openedAt.Add(b.openTimeout).Sub(now); wait > 0 {
+			return &RetryAfterError{Err: fmt.Errorf("%w: circuit open", ErrServiceUnavailable), After: wait}
+		}
+		b.state = stateHalfOpen
+		b.probing = false
+		fallthrough
+	case stateHalfOpen:
+		if b.probing {
+			return fmt.Errorf("%w: circuit half-open, probe in flight", ErrServiceUnavailable)
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record feeds the result of an allowed call back into the breaker.
+func (b *breaker) record(now time.Time, o outcome) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	switch o {
+	case outcomeSuccess:
+		b.state, b.failures = stateClosed, 0
+	case outcomeFailure:
+		b.failures++
+		if b.state == stateHalfOpen || (b.state == stateClosed && b.failures >= b.threshold) {
+			b.state, b.openedAt = stateOpen, now
+			b.opens++
+		}
+	}
+}
+
+// BreakerStatus is the circuit breaker part of Status.
+type BreakerStatus struct {
+	// State is closed, open, half_open, or disabled.
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Opens               int64      `json:"opens"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	// ProbeAt is when an open circuit will let the next call through.
+	ProbeAt *time.Time `json:"probe_at,omitempty"`
+}
+
+func (b *breaker) snapshot() BreakerStatus {
+	if b.threshold <= 0 {
+		return BreakerStatus{State: "disabled"}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := BreakerStatus{State: b.state.String(), ConsecutiveFailures: b.failures, Opens: b.opens}
+	if !b.openedAt.IsZero() {
+		at := b.openedAt
+		s.OpenedAt = &at
+	}
+	if b.state == stateOpen {
+		at := b.openedAt.Add(b.openTimeout)
+		s.ProbeAt = &at
+	}
+	return s
+}
@@ -0,0 +1,60 @@
+package geckoclient
+
+import (
+	"errors"
+	"time"
+
+	"cryptoserver/metrics"
+)
+
+// Upstream call names used as the "call" label.
+const (
+	callCoinsList = "coins_list"
+	callPrice     = "price"
+	callPing      = "ping"
+)
+
+var (
+	upstreamRequests = metrics.Default.NewCounterVec(
+		"cryptoserver_upstream_requests_total",
+		"CoinGecko calls by call and outcome (ok, not_found, rate_limited, auth_error, service_unavailable, bad_response).",
+		"call", "outcome",
+	)
+	upstreamRetries = metrics.Default.NewCounterVec(
+		"cryptoserver_upstream_retries_total",
+		"CoinGecko requests retried after a transport error or 5xx answer.",
+		"call",
+	)
+	upstreamDuration = metrics.Default.NewHistogramVec(
+		"cryptoserver_upstream_request_duration_seconds",
+		"CoinGecko call latency in seconds.",
+		metrics.DefaultBuckets,
+		"call",
+	)
+)
+
+// Outcome classifies an upstream call result by sentinel error.
+func Outcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, ErrUnauthorized):
+		return "auth_error"
+	case errors.Is(err, ErrBadResponse):
+		return "bad_response"
+	default:
+		return "service_unavailable"
+	}
+}
+
+// observe feeds one finished upstream call into metrics and UpstreamStatus.
+func (c *Client) observe(call string, start time.Time, err error) {
+	lat := time.Since(start)
+	upstreamRequests.Inc(call, Outcome(err))
+	upstreamDuration.Observe(lat.Seconds(), call)
+	c.status.track(call, start.Add(lat), lat, err)
+}
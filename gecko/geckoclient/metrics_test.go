@@ -0,0 +1,27 @@
+package geckoclient
+
+import "testing"
+
+// TestGetPriceCountsOutcomes checks upstream calls are counted by outcome.
+func TestGetPriceCountsOutcomes(t *testing.T) {
+	okBefore := upstreamRequests.Value(callPrice, "ok")
+	nfBefore := upstreamRequests.Value(callPrice, "not_found")
+	durBefore := upstreamDuration.Count(callPrice)
+
+	if _, err := GetPrice("btc"); err != nil {
+		t.Fatalf("GetPrice(\"btc\") error = %v", err)
+	}
+	if _, err := GetPrice("unknownsymbol123"); err == nil {
+		t.Fatalf("GetPrice(\"unknownsymbol123\") expected error, got nil")
+	}
+
+	if got := upstreamRequests.Value(callPrice, "ok") - okBefore; got != 1 {
+		t.Errorf("ok outcomes grew by %v, want 1", got)
+	}
+	if got := upstreamRequests.Value(callPrice, "not_found") - nfBefore; got != 1 {
+		t.Errorf("not_found outcomes grew by %v, want 1", got)
+	}
+	if got := upstreamDuration.Count(callPrice) - durBefore; got != 2 {
+		t.Errorf("latency observations grew by %d, want 2", got)
+	}
+}
@@ -0,0 +1,160 @@
+package geckoclient
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultRetryAfter is how long to back off after a 429 that carries no
+// usable Retry-After header.
+const defaultRetryAfter = 30 * time.Second
+
+// RetryAfterError is an upstream refusal with a hint of when to try again:
+// a 429 or a 5xx with Retry-After from CoinGecko, or the client's own
+// limiter holding a call back. It unwraps to ErrRateLimited or
+// ErrServiceUnavailable.
+type RetryAfterError struct {
+	Err   error
+	After time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%v (retry after %s)", e.Err, e.After)
+}
+
+func (e *RetryAfterError) Unwrap() error { return e.Err }
+
+// limiter is a token bucket shared by every call of one Client, plus a
+// pause window set when the upstream asks us to back off.
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second; 0 disables the bucket
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	pausedUntil time.Time
+	pauseErr    error
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	b := float64(max(burst, 1))
+	return &limiter{rate: rate, burst: b, tokens: b}
+}
+
+// reserve takes a token and returns how long the caller must wait before
+// using it. If that wait would exceed maxWait (0 = no bound) no token is
+// taken and ok is false.
+func (l *limiter) reserve(now time.Time, maxWait time.Duration) (wait time.Duration, ok bool) {
+	if l.rate <= 0 {
+		return 0, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.last.IsZero() {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0, true
+	}
+	wait = time.Duration(math.Ceil((1 - l.tokens) / l.rate * float64(time.Second)))
+	if maxWait > 0 && wait > maxWait {
+		return wait, false
+	}
+	l.tokens-- // goes negative: later callers queue behind this one
+	return wait, true
+}
+
+// pause makes every call fail fast with err until the given time.
+func (l *limiter) pause(until time.Time, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until.After(l.pausedUntil) {
+		l.pausedUntil, l.pauseErr = until, err
+	}
+}
+
+// paused returns the remaining pause and its cause, if any.
+func (l *limiter) paused(now time.Time) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now), l.pauseErr
+	}
+	return 0, nil
+}
+
+// acquire blocks until the call may go out, or fails fast with a
+// *RetryAfterError when the upstream told us to back off or the local
+// budget would not free up within the request timeout.
+func (c *Client) acquire() error {
+	now := time.Now()
+	if d, err := c.limiter.paused(now); err != nil {
+		return &RetryAfterError{Err: fmt.Errorf("%w: backing off after upstream refusal", err), After: d}
+	}
+	wait, ok := c.limiter.reserve(now, c.http.Timeout)
+	if !ok {
+		return &RetryAfterError{Err: fmt.Errorf("%w: local request budget exhausted", ErrRateLimited), After: wait}
+	}
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+	return nil
+}
+
+// attempt performs req once under the rate limiter. Transport failures
+// and non-2xx answers become errors, the latter an *UpstreamError (inside
+// a *RetryAfterError for 429, and for 5xx with Retry-After); 2xx responses
+// are returned for the caller to decode.
+func (c *Client) attempt(req *http.Request) (*http.Response, error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrServiceUnavailable, err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return resp, nil
+	}
+	ue := newUpstreamError(resp)
+	switch {
+	case ue.StatusCode == http.StatusTooManyRequests:
+		d, ok := retryAfter(resp.Header, time.Now())
+		if !ok {
+			d = defaultRetryAfter
+		}
+		c.limiter.pause(time.Now().Add(d), ErrRateLimited)
+		return nil, &RetryAfterError{Err: ue, After: d}
+	case ue.StatusCode >= 500:
+		if d, ok := retryAfter(resp.Header, time.Now()); ok {
+			c.limiter.pause(time.Now().Add(d), ErrServiceUnavailable)
+			return nil, &RetryAfterError{Err: ue, After: d}
+		}
+	}
+	return nil, ue
+}
+
+// retryAfter parses a Retry-After header given as seconds or an HTTP date.
+func retryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,157 @@
+package geckoclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cryptoserver/config"
+	"cryptoserver/gecko/geckocoins"
+)
+
+func TestLimiterReserve(t *testing.T) {
+	l := newLimiter(2, 2) // 2 tokens/s, burst 2
+	now := time.Unix(0, 0)
+
+	for i := range 2 {
+		if wait, ok := l.reserve(now, 0); !ok || wait != 0 {
+			t.Fatalf("burst call %d: wait %v ok %v, want immediate", i, wait, ok)
+		}
+	}
+	if wait, ok := l.reserve(now, 0); !ok || wait != 500*time.Millisecond {
+		t.Errorf("third call: wait %v ok %v, want 500ms", wait, ok)
+	}
+	// The queued call above consumed the next token; one more would wait 1s.
+	if wait, ok := l.reserve(now, 700*time.Millisecond); ok || wait != time.Second {
+		t.Errorf("over budget: wait %v ok %v, want refusal after 1s", wait, ok)
+	}
+	if wait, ok := l.reserve(now.Add(2*time.Second), 0); !ok || wait != 0 {
+		t.Errorf("after refill: wait %v ok %v, want immediate", wait, ok)
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		v    string
+		want time.Duration
+		ok   bool
+	}{
+		{"", 0, false},
+		{"7", 7 * time.Second, true},
+		{"-1", 0, false},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{"soon", 0, false},
+	}
+	for _, tc := range cases {
+		h := http.Header{}
+		h.Set("Retry-After", tc.v)
+		if got, ok := retryAfter(h, now); got != tc.want || ok != tc.ok {
+			t.Errorf("retryAfter(%q) = %v, %v; want %v, %v", tc.v, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+// newTestClient points a client with a preloaded coin list at h.
+func newTestClient(t *testing.T, cfg config.UpstreamConfig, h http.HandlerFunc) (*Client, *atomic.Int64) {
+	t.Helper()
+	var hits atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		h(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	cfg.BaseURL = srv.URL
+	if cfg.Timeout == 0 {
+		cfg.Timeout = config.Duration(2 * time.Second)
+	}
+	c := New(cfg)
+	c.tickerMap = map[string]geckocoins.CoinInfo{"btc": {ID: "bitcoin", Symbol: "btc", Name: "Bitcoin"}}
+	return c, &hits
+}
+
+func TestGetPriceRateLimited(t *testing.T) {
+	c, hits := newTestClient(t, config.UpstreamConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"status":{"error_code":429}}`))
+	})
+
+	_, err := c.GetPrice("btc")
+	var ra *RetryAfterError
+	if !errors.Is(err, ErrRateLimited) || !errors.As(err, &ra) || ra.After != 7*time.Second {
+		t.Fatalf("err = %v, want ErrRateLimited retrying after 7s", err)
+	}
+	if Outcome(err) != "rate_limited" {
+		t.Errorf("outcome = %q, want rate_limited", Outcome(err))
+	}
+
+	// The client now backs off without calling upstream.
+	_, err = c.GetPrice("btc")
+	if !errors.Is(err, ErrRateLimited) || !errors.As(err, &ra) || ra.After <= 0 || ra.After > 7*time.Second {
+		t.Fatalf("second call err = %v, want fast-fail ErrRateLimited", err)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("upstream hits = %d, want 1", n)
+	}
+}
+
+func TestGetPriceServerError(t *testing.T) {
+	c, hits := newTestClient(t, config.UpstreamConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<html>bad gateway</html>", http.StatusBadGateway)
+	})
+
+	_, err := c.GetPrice("btc")
+	var ra *RetryAfterError
+	if !errors.Is(err, ErrServiceUnavailable) || errors.As(err, &ra) {
+		t.Fatalf("err = %v, want plain ErrServiceUnavailable", err)
+	}
+	// Without Retry-After there is no back-off: the next call goes out.
+	_, _ = c.GetPrice("btc")
+	if n := hits.Load(); n != 2 {
+		t.Errorf("upstream hits = %d, want 2", n)
+	}
+}
+
+func TestGetPriceUnavailableWithRetryAfter(t *testing.T) {
+	c, hits := newTestClient(t, config.UpstreamConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	for range 2 {
+		_, err := c.GetPrice("btc")
+		var ra *RetryAfterError
+		if !errors.Is(err, ErrServiceUnavailable) || !errors.As(err, &ra) {
+			t.Fatalf("err = %v, want ErrServiceUnavailable with Retry-After", err)
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("upstream hits = %d, want 1", n)
+	}
+}
+
+func TestLocalRateLimit(t *testing.T) {
+	cfg := config.UpstreamConfig{RateLimit: 0.1, RateBurst: 2, Timeout: config.Duration(time.Second)}
+	c, hits := newTestClient(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"bitcoin":{"usd":1}}`))
+	})
+
+	for i := range 2 {
+		if _, err := c.GetPrice("btc"); err != nil {
+			t.Fatalf("call %d within burst: %v", i, err)
+		}
+	}
+	// The next token is 10s away, longer than the request timeout.
+	_, err := c.GetPrice("btc")
+	var ra *RetryAfterError
+	if !errors.Is(err, ErrRateLimited) || !errors.As(err, &ra) || ra.After < 9*time.Second {
+		t.Fatalf("err = %v, want ErrRateLimited retrying after ~10s", err)
+	}
+	if n := hits.Load(); n != 2 {
+		t.Errorf("upstream hits = %d, want 2", n)
+	}
+}
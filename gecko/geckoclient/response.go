@@ -0,0 +1,128 @@
+package geckoclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// Body size limits. The coin list is the largest legitimate answer (a few
+// MB for the public API); error bodies are only read for their message.
+var (
+	maxResponseBytes int64 = 16 << 20
+	maxErrorBytes    int64 = 4 << 10
+)
+
+// maxMessageLen caps the upstream message kept in an UpstreamError.
+const maxMessageLen = 200
+
+// UpstreamError is a non-2xx answer from CoinGecko. Err is the sentinel
+// the status maps to (ErrNotFound, ErrRateLimited, ErrUnauthorized,
+// ErrServiceUnavailable or ErrBadResponse) so errors.Is keeps working.
+type UpstreamError struct {
+	StatusCode int
+	// Message is the upstream's own error text, when it sent one in a
+	// recognizable form; HTML error pages are not copied.
+	Message string
+	Err     error
+}
+
+func (e *UpstreamError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%v: upstream returned %d: %s", e.Err, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%v: upstream returned %d", e.Err, e.StatusCode)
+}
+
+func (e *UpstreamError) Unwrap() error { return e.Err }
+
+// statusError maps a status code to its sentinel.
+func statusError(code int) error {
+	switch {
+	case code == http.StatusNotFound, code == http.StatusGone:
+		return ErrNotFound
+	case code == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case code == http.StatusUnauthorized, code == http.StatusForbidden:
+		return ErrUnauthorized
+	case code >= 500:
+		return ErrServiceUnavailable
+	default:
+		return ErrBadResponse
+	}
+}
+
+// newUpstreamError reads at most maxErrorBytes of a non-2xx response for
+// its message and closes the body.
+func newUpstreamError(resp *http.Response) *UpstreamError {
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBytes))
+	return &UpstreamError{
+		StatusCode: resp.StatusCode,
+		Message:    upstreamMessage(resp.Header.Get("Content-Type"), b),
+		Err:        statusError(resp.StatusCode),
+	}
+}
+
+// upstreamMessage extracts the error text from the shapes CoinGecko and
+// its proxies use: {"error": "..."}, {"status": {"error_message": "..."}},
+// {"message": "..."}, or a short plain-text body.
+func upstreamMessage(contentType string, body []byte) string {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return ""
+	}
+	if body[0] == '{' {
+		var v struct {
+			Error   json.RawMessage `json:"error"`
+			Message string          `json:"message"`
+			Status  struct {
+				ErrorMessage string `json:"error_message"`
+			} `json:"status"`
+		}
+		if json.Unmarshal(body, &v) != nil {
+			return ""
+		}
+		var s string
+		switch {
+		case json.Unmarshal(v.Error, &s) == nil && s != "":
+		case v.Status.ErrorMessage != "":
+			s = v.Status.ErrorMessage
+		default:
+			s = v.Message
+		}
+		return truncate(s)
+	}
+	if strings.HasPrefix(contentType, "text/plain") {
+		line, _, _ := strings.Cut(string(body), "\n")
+		return truncate(strings.TrimSpace(line))
+	}
+	return ""
+}
+
+func truncate(s string) string {
+	if len(s) <= maxMessageLen {
+		return s
+	}
+	s = s[:maxMessageLen]
+	for !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s + "…"
+}
+
+// readBody reads a 2xx body, refusing ones over maxResponseBytes.
+func readBody(resp *http.Response) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrServiceUnavailable, err)
+	}
+	if int64(len(b)) > maxResponseBytes {
+		return nil, fmt.Errorf("%w: response exceeds %d bytes", ErrBadResponse, maxResponseBytes)
+	}
+	return b, nil
+}
@@ -0,0 +1,139 @@
+package geckoclient
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"cryptoserver/config"
+)
+
+func TestGetPriceClassifiesStatus(t *testing.T) {
+	cases := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		want        error
+		wantMsg     string
+	}{
+		{
+			name: "not found", status: http.StatusNotFound,
+			contentType: "application/json", body: `{"error":"coin not found"}`,
+			want: ErrNotFound, wantMsg: "coin not found",
+		},
+		{
+			name: "rate limited", status: http.StatusTooManyRequests,
+			contentType: "application/json",
+			body:        `{"status":{"error_code":429,"error_message":"You've exceeded the Rate Limit."}}`,
+			want:        ErrRateLimited, wantMsg: "You've exceeded the Rate Limit.",
+		},
+		{
+			name: "unauthorized", status: http.StatusUnauthorized,
+			contentType: "application/json", body: `{"status":{"error_code":10002,"error_message":"API key missing"}}`,
+			want: ErrUnauthorized, wantMsg: "API key missing",
+		},
+		{
+			name: "forbidden", status: http.StatusForbidden,
+			contentType: "application/json", body: `{"message":"plan does not include this endpoint"}`,
+			want: ErrUnauthorized, wantMsg: "plan does not include this endpoint",
+		},
+		{
+			name: "server error html", status: http.StatusInternalServerError,
+			contentType: "text/html", body: "<html><body><h1>500 Internal Server Error</h1></body></html>",
+			want: ErrServiceUnavailable, wantMsg: "",
+		},
+		{
+			name: "bad gateway text", status: http.StatusBadGateway,
+			contentType: "text/plain; charset=utf-8", body: "upstream connect error\nretrying later",
+			want: ErrServiceUnavailable, wantMsg: "upstream connect error",
+		},
+		{
+			name: "bad request", status: http.StatusBadRequest,
+			contentType: "application/json", body: `{"error":"missing vs_currencies"}`,
+			want: ErrBadResponse, wantMsg: "missing vs_currencies",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := newTestClient(t, config.UpstreamConfig{}, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tc.contentType)
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			})
+
+			_, err := c.GetPrice("btc")
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("err = %v, want %v", err, tc.want)
+			}
+			var ue *UpstreamError
+			if !errors.As(err, &ue) {
+				t.Fatalf("err = %T %v, want *UpstreamError", err, err)
+			}
+			if ue.StatusCode != tc.status || ue.Message != tc.wantMsg {
+				t.Errorf("UpstreamError = %d %q, want %d %q", ue.StatusCode, ue.Message, tc.status, tc.wantMsg)
+			}
+			if strings.Contains(err.Error(), "<html>") {
+				t.Errorf("error text %q contains the HTML body", err)
+			}
+		})
+	}
+}
+
+func TestUpstreamMessageIsTruncated(t *testing.T) {
+	msg := strings.Repeat("é", maxMessageLen)
+	got := upstreamMessage("application/json", []byte(`{"error":"`+msg+`"}`))
+	if len(got) > maxMessageLen+len("…") || !strings.HasSuffix(got, "…") {
+		t.Errorf("message of %d bytes not truncated to %d: %q", len(got), maxMessageLen, got)
+	}
+}
+
+func TestErrorBodyIsSizeLimited(t *testing.T) {
+	c, _ := newTestClient(t, config.UpstreamConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(strings.Repeat("x", 10*int(maxErrorBytes))))
+	})
+	_, err := c.GetPrice("btc")
+	var ue *UpstreamError
+	if !errors.As(err, &ue) || len(ue.Message) > maxMessageLen+len("…") {
+		t.Fatalf("err = %v, want UpstreamError with a short message", err)
+	}
+}
+
+func TestOversizedResponseIsRejected(t *testing.T) {
+	defer func(n int64) { maxResponseBytes = n }(maxResponseBytes)
+	maxResponseBytes = 64
+
+	c, _ := newTestClient(t, config.UpstreamConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"bitcoin":{"usd":1},"padding":"` + strings.Repeat("x", 100) + `"}`))
+	})
+	if _, err := c.GetPrice("btc"); !errors.Is(err, ErrBadResponse) {
+		t.Fatalf("err = %v, want ErrBadResponse", err)
+	}
+}
+
+func TestGetPriceBadJSON(t *testing.T) {
+	c, _ := newTestClient(t, config.UpstreamConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<html>maintenance</html>"))
+	})
+	_, err := c.GetPrice("btc")
+	if !errors.Is(err, ErrBadResponse) {
+		t.Fatalf("err = %v, want ErrBadResponse", err)
+	}
+	if strings.Contains(err.Error(), "maintenance") {
+		t.Errorf("error text %q repeats the response body", err)
+	}
+}
+
+func TestPingReportsStatus(t *testing.T) {
+	c, _ := newTestClient(t, config.UpstreamConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	err := c.Ping(t.Context())
+	var ue *UpstreamError
+	if !errors.Is(err, ErrServiceUnavailable) || !errors.As(err, &ue) || ue.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("err = %v, want UpstreamError 503", err)
+	}
+}
@@ -0,0 +1,74 @@
+package geckoclient
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// send performs an idempotent GET through the circuit breaker, retrying
+// transport errors and 5xx answers with exponential backoff and jitter.
+// Refusals that carry a Retry-After hint are not retried: the limiter
+// already holds further calls back.
+func (c *Client) send(call string, req *http.Request) (*http.Response, error) {
+	if err := c.breaker.allow(time.Now()); err != nil {
+		return nil, err
+	}
+	resp, err := c.sendWithRetry(call, req)
+	c.breaker.record(time.Now(), classify(req, err))
+	return resp, err
+}
+
+func (c *Client) sendWithRetry(call string, req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := c.attempt(req)
+		if err == nil || attempt >= c.retry.MaxAttempts || !retryable(err) || req.Context().Err() != nil {
+			return resp, err
+		}
+		upstreamRetries.Inc(call)
+		c.status.retried(call)
+		t := time.NewTimer(c.backoff(attempt))
+		select {
+		case <-t.C:
+		case <-req.Context().Done():
+			t.Stop()
+			return nil, err
+		}
+	}
+}
+
+func retryable(err error) bool {
+	var ra *RetryAfterError
+	return errors.Is(err, ErrServiceUnavailable) && !errors.As(err, &ra)
+}
+
+// classify decides how a finished call counts towards opening the circuit.
+func classify(req *http.Request, err error) outcome {
+	var ra *RetryAfterError
+	switch {
+	case err == nil:
+		return outcomeSuccess
+	case req.Context().Err() != nil, errors.As(err, &ra):
+		return outcomeNeutral
+	case errors.Is(err, ErrServiceUnavailable):
+		return outcomeFailure
+	default:
+		return outcomeSuccess
+	}
+}
+
+// backoff is the delay before retry number attempt (1-based): the initial
+// backoff doubled per attempt, capped, then jittered into [d/2, d].
+func (c *Client) backoff(attempt int) time.Duration {
+	d := time.Duration(c.retry.InitialBackoff)
+	limit := time.Duration(c.retry.MaxBackoff)
+	for i := 1; i < attempt && d < limit; i++ {
+		d *= 2
+	}
+	d = min(d, limit)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,196 @@
+package geckoclient
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cryptoserver/config"
+)
+
+var fastRetry = config.RetryConfig{
+	MaxAttempts:    3,
+	InitialBackoff: config.Duration(time.Millisecond),
+	MaxBackoff:     config.Duration(4 * time.Millisecond),
+}
+
+// failFirst answers status to the first n requests, then a BTC price.
+func failFirst(n int64, status int) (http.HandlerFunc, *atomic.Int64) {
+	var seen atomic.Int64
+	return func(w http.ResponseWriter, r *http.Request) {
+		if seen.Add(1) <= n {
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = w.Write([]byte(`{"bitcoin":{"usd":1}}`))
+	}, &seen
+}
+
+func TestRetryRecoversFromTransientErrors(t *testing.T) {
+	h, _ := failFirst(2, http.StatusBadGateway)
+	c, hits := newTestClient(t, config.UpstreamConfig{Retry: fastRetry}, h)
+	before := upstreamRetries.Value(callPrice)
+
+	if p, err := c.GetPrice("btc"); err != nil || p != 1 {
+		t.Fatalf("GetPrice = %v, %v; want 1 after retries", p, err)
+	}
+	if n := hits.Load(); n != 3 {
+		t.Errorf("upstream hits = %d, want 3", n)
+	}
+	if got := c.Status().Calls[callPrice].Retries; got != 2 {
+		t.Errorf("status retries = %d, want 2", got)
+	}
+	if got := upstreamRetries.Value(callPrice) - before; got != 2 {
+		t.Errorf("retries metric grew by %v, want 2", got)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	h, _ := failFirst(100, http.StatusInternalServerError)
+	c, hits := newTestClient(t, config.UpstreamConfig{Retry: fastRetry}, h)
+
+	if _, err := c.GetPrice("btc"); !errors.Is(err, ErrServiceUnavailable) {
+		t.Fatalf("err = %v, want ErrServiceUnavailable", err)
+	}
+	if n := hits.Load(); n != 3 {
+		t.Errorf("upstream hits = %d, want 3", n)
+	}
+}
+
+func TestNoRetryWithoutTransientError(t *testing.T) {
+	cases := []struct {
+		name   string
+		status int
+	}{
+		{"rate limited", http.StatusTooManyRequests},
+		{"client error", http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, _ := failFirst(1, tc.status)
+			c, hits := newTestClient(t, config.UpstreamConfig{Retry: fastRetry}, h)
+			if _, err := c.GetPrice("btc"); err == nil {
+				t.Fatal("GetPrice succeeded, want error")
+			}
+			if n := hits.Load(); n != 1 {
+				t.Errorf("upstream hits = %d, want 1", n)
+			}
+		})
+	}
+}
+
+func TestBackoffGrowsWithinBounds(t *testing.T) {
+	c := &Client{retry: config.RetryConfig{
+		InitialBackoff: config.Duration(100 * time.Millisecond),
+		MaxBackoff:     config.Duration(time.Second),
+	}}
+	for attempt, want := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		5: time.Second,
+		9: time.Second,
+	} {
+		for range 20 {
+			if d := c.backoff(attempt); d < want/2 || d > want {
+				t.Fatalf("backoff(%d) = %v, want within [%v, %v]", attempt, d, want/2, want)
+			}
+		}
+	}
+}
+
+func TestBreakerStates(t *testing.T) {
+	b := newBreaker(config.BreakerConfig{FailureThreshold: 2, OpenTimeout: config.Duration(time.Minute)})
+	now := time.Unix(0, 0)
+
+	for range 2 {
+		if err := b.allow(now); err != nil {
+			t.Fatalf("closed breaker refused: %v", err)
+		}
+		b.record(now, outcomeFailure)
+	}
+	err := b.allow(now.Add(10 * time.Second))
+	var ra *RetryAfterError
+	if !errors.Is(err, ErrServiceUnavailable) || !errors.As(err, &ra) || ra.After != 50*time.Second {
+		t.Fatalf("open breaker: err = %v, want fast-fail retrying after 50s", err)
+	}
+	if s := b.snapshot(); s.State != "open" || s.Opens != 1 || s.ProbeAt == nil {
+		t.Errorf("snapshot = %+v, want open once with probe time", s)
+	}
+
+	// Half-open: one probe goes through, others wait for its result.
+	later := now.Add(time.Minute)
+	if err := b.allow(later); err != nil {
+		t.Fatalf("probe refused: %v", err)
+	}
+	if err := b.allow(later); !errors.Is(err, ErrServiceUnavailable) {
+		t.Fatalf("second caller during probe: err = %v, want fast-fail", err)
+	}
+	b.record(later, outcomeFailure)
+	if s := b.snapshot(); s.State != "open" || s.Opens != 2 {
+		t.Fatalf("failed probe: snapshot = %+v, want re-opened", s)
+	}
+
+	later = later.Add(time.Minute)
+	if err := b.allow(later); err != nil {
+		t.Fatalf("second probe refused: %v", err)
+	}
+	b.record(later, outcomeSuccess)
+	if s := b.snapshot(); s.State != "closed" || s.ConsecutiveFailures != 0 {
+		t.Errorf("successful probe: snapshot = %+v, want closed", s)
+	}
+}
+
+func TestBreakerNeutralOutcomeKeepsState(t *testing.T) {
+	b := newBreaker(config.BreakerConfig{FailureThreshold: 1, OpenTimeout: config.Duration(time.Second)})
+	now := time.Unix(0, 0)
+	b.record(now, outcomeFailure)
+	probe := now.Add(time.Second)
+	if err := b.allow(probe); err != nil {
+		t.Fatal(err)
+	}
+	b.record(probe, outcomeNeutral)
+	if s := b.snapshot(); s.State != "half_open" {
+		t.Fatalf("state = %q, want half_open", s.State)
+	}
+	if err := b.allow(probe); err != nil {
+		t.Errorf("next probe after neutral outcome refused: %v", err)
+	}
+}
+
+func TestClientBreakerFastFails(t *testing.T) {
+	var healthy atomic.Bool
+	cfg := config.UpstreamConfig{
+		Breaker: config.BreakerConfig{FailureThreshold: 2, OpenTimeout: config.Duration(50 * time.Millisecond)},
+	}
+	c, hits := newTestClient(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"bitcoin":{"usd":1}}`))
+	})
+
+	for range 3 {
+		if _, err := c.GetPrice("btc"); !errors.Is(err, ErrServiceUnavailable) {
+			t.Fatalf("err = %v, want ErrServiceUnavailable", err)
+		}
+	}
+	if n := hits.Load(); n != 2 {
+		t.Errorf("upstream hits = %d, want 2 (third call fails fast)", n)
+	}
+	if s := c.Status().Breaker; s.State != "open" {
+		t.Errorf("breaker state = %q, want open", s.State)
+	}
+
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	if _, err := c.GetPrice("btc"); err != nil {
+		t.Fatalf("probe call: %v", err)
+	}
+	if s := c.Status().Breaker; s.State != "closed" {
+		t.Errorf("breaker state = %q, want closed", s.State)
+	}
+}
@@ -0,0 +1,147 @@
+package geckoclient
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// recentWindow is how many of the latest calls feed RecentErrorRate.
+const recentWindow = 100
+
+// CallStatus is a snapshot of one upstream call type.
+// Not-found answers count as successes: the upstream responded.
+type CallStatus struct {
+	Requests        int64      `json:"requests"`
+	Failures        int64      `json:"failures"`
+	Retries         int64      `json:"retries"`
+	ErrorRate       float64    `json:"error_rate"`
+	RecentErrorRate float64    `json:"recent_error_rate"`
+	LastLatencyMs   float64    `json:"last_latency_ms"`
+	AvgLatencyMs    float64    `json:"avg_latency_ms"`
+	LastSuccessAt   *time.Time `json:"last_success_at,omitempty"`
+	LastFailureAt   *time.Time `json:"last_failure_at,omitempty"`
+	// LastError classifies the latest failure as Outcome does, and
+	// LastStatusCode is the HTTP status it came with, if any. The error
+	// text itself is only logged: it can carry URLs and dial errors.
+	LastError      string `json:"last_error,omitempty"`
+	LastStatusCode int    `json:"last_status_code,omitempty"`
+}
+
+type callTracker struct {
+	requests    int64
+	failures    int64
+	retries     int64
+	totalLat    time.Duration
+	lastLat     time.Duration
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastErr     string
+	lastCode    int
+	recent      [recentWindow]bool // true = failure; ring buffer
+	recentN     int
+	recentPos   int
+}
+
+// statusTracker aggregates call outcomes for one Client.
+type statusTracker struct {
+	mu    sync.Mutex
+	calls map[string]*callTracker
+}
+
+// tracker returns the tracker for call; st.mu must be held.
+func (st *statusTracker) tracker(call string) *callTracker {
+	t, ok := st.calls[call]
+	if !ok {
+		t = &callTracker{}
+		st.calls[call] = t
+	}
+	return t
+}
+
+// retried counts one retry of call.
+func (st *statusTracker) retried(call string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.tracker(call).retries++
+}
+
+func (st *statusTracker) track(call string, at time.Time, lat time.Duration, err error) {
+	failed := err != nil && Outcome(err) != "not_found"
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	t := st.tracker(call)
+	t.requests++
+	t.totalLat += lat
+	t.lastLat = lat
+	if failed {
+		t.failures++
+		t.lastFailure = at
+		t.lastErr = Outcome(err)
+		t.lastCode = 0
+		var ue *UpstreamError
+		if errors.As(err, &ue) {
+			t.lastCode = ue.StatusCode
+		}
+		slog.Warn("upstream call failed", "call", call, "outcome", t.lastErr, "err", err)
+	} else {
+		t.lastSuccess = at
+	}
+	t.recent[t.recentPos] = failed
+	t.recentPos = (t.recentPos + 1) % recentWindow
+	t.recentN = min(t.recentN+1, recentWindow)
+}
+
+func (t *callTracker) snapshot() CallStatus {
+	s := CallStatus{
+		Requests:       t.requests,
+		Failures:       t.failures,
+		Retries:        t.retries,
+		LastLatencyMs:  float64(t.lastLat) / float64(time.Millisecond),
+		LastError:      t.lastErr,
+		LastStatusCode: t.lastCode,
+	}
+	if t.requests > 0 {
+		s.ErrorRate = float64(t.failures) / float64(t.requests)
+		s.AvgLatencyMs = float64(t.totalLat) / float64(t.requests) / float64(time.Millisecond)
+	}
+	if t.recentN > 0 {
+		var n int
+		for i := 0; i < t.recentN; i++ {
+			if t.recent[i] {
+				n++
+			}
+		}
+		s.RecentErrorRate = float64(n) / float64(t.recentN)
+	}
+	if !t.lastSuccess.IsZero() {
+		ts := t.lastSuccess
+		s.LastSuccessAt = &ts
+	}
+	if !t.lastFailure.IsZero() {
+		ts := t.lastFailure
+		s.LastFailureAt = &ts
+	}
+	return s
+}
+
+// Status is a snapshot of upstream health as seen by this client.
+type Status struct {
+	BaseURL string                `json:"base_url"`
+	Coins   int                   `json:"coins"`
+	Calls   map[string]CallStatus `json:"calls"`
+	Breaker BreakerStatus         `json:"breaker"`
+}
+
+// Status reports per-call latency, last success/failure, error rates and
+// retries, and the circuit breaker state.
+func (c *Client) Status() Status {
+	c.status.mu.Lock()
+	calls := make(map[string]CallStatus, len(c.status.calls))
+	for name, t := range c.status.calls {
+		calls[name] = t.snapshot()
+	}
+	c.status.mu.Unlock()
+	return Status{BaseURL: c.baseURL, Coins: c.CoinCount(), Calls: calls, Breaker: c.breaker.snapshot()}
+}
@@ -0,0 +1,58 @@
+package geckoclient
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestUpstreamStatusTracksCalls checks counters, timestamps and error rates.
+func TestUpstreamStatusTracksCalls(t *testing.T) {
+	before := Default().Status().Calls[callPrice]
+
+	if _, err := GetPrice("btc"); err != nil {
+		t.Fatalf("GetPrice(\"btc\") error = %v", err)
+	}
+	// Not found means the upstream answered, so it is not a failure.
+	_, _ = GetPrice("unknownsymbol123")
+
+	st := Default().Status()
+	after := st.Calls[callPrice]
+	if after.Requests-before.Requests != 2 {
+		t.Errorf("requests grew by %d, want 2", after.Requests-before.Requests)
+	}
+	if after.Failures != before.Failures {
+		t.Errorf("failures grew by %d, want 0", after.Failures-before.Failures)
+	}
+	if after.LastSuccessAt == nil || time.Since(*after.LastSuccessAt) > time.Minute {
+		t.Errorf("LastSuccessAt = %v, want recent", after.LastSuccessAt)
+	}
+	if st.Coins == 0 || st.Coins != Default().CoinCount() {
+		t.Errorf("Coins = %d, Default().CoinCount() = %d", st.Coins, Default().CoinCount())
+	}
+}
+
+// TestPing checks the liveness probe against the configured upstream.
+func TestPing(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := Default().Ping(ctx); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+}
+
+// TestUpstreamStatusHidesErrorText checks that failures are reported by
+// class and status code only.
+func TestUpstreamStatusHidesErrorText(t *testing.T) {
+	st := &statusTracker{calls: map[string]*callTracker{}}
+	now := time.Now()
+	st.track(callPrice, now, time.Millisecond, &UpstreamError{StatusCode: 503, Message: "backend 10.1.2.3 down", Err: ErrServiceUnavailable})
+	if s := st.calls[callPrice].snapshot(); s.LastError != "service_unavailable" || s.LastStatusCode != 503 {
+		t.Errorf("after 503: last_error %q, last_status_code %d", s.LastError, s.LastStatusCode)
+	}
+	st.track(callPrice, now, time.Millisecond, fmt.Errorf("%w: dial tcp 10.1.2.3:443: connection refused", ErrServiceUnavailable))
+	if s := st.calls[callPrice].snapshot(); s.LastError != "service_unavailable" || s.LastStatusCode != 0 {
+		t.Errorf("after a dial error: last_error %q, last_status_code %d", s.LastError, s.LastStatusCode)
+	}
+}
@@ -0,0 +1,160 @@
+// Package metrics is a small in-tree metrics registry that renders the
+// Prometheus text exposition format (version 0.0.4). It covers the handful
+// of metric kinds the server needs without pulling in client_golang.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the Content-Type of WriteText output.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are latency buckets in seconds, matching Prometheus defaults.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the process-wide registry used by packages without an owner
+// to hand them one (e.g. the CoinGecko client).
+var Default = NewRegistry()
+
+// collector is one metric family.
+type collector interface {
+	name() string
+	write(w io.Writer) error
+}
+
+// Registry holds metric families by name.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.collectors[c.name()]; dup {
+		panic(fmt.Sprintf("metrics: duplicate registration of %q", c.name()))
+	}
+	r.collectors[c.name()] = c
+}
+
+// WriteText renders every family of every registry, sorted by name.
+func WriteText(w io.Writer, regs ...*Registry) error {
+	var all []collector
+	for _, r := range regs {
+		r.mu.Lock()
+		for _, c := range r.collectors {
+			all = append(all, c)
+		}
+		r.mu.Unlock()
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].name() < all[j].name() })
+	for _, c := range all {
+		if err := c.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// desc is the shared identity of a metric family.
+type desc struct {
+	fqName string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d *desc) name() string { return d.fqName }
+
+func (d *desc) writeHeader(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.fqName, escapeHelp(d.help), d.fqName, d.kind)
+	return err
+}
+
+// key joins label values into a map key; \xff never appears in valid UTF-8.
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.fqName, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// series formats name{labels} with optional extra trailing label pairs.
+func (d *desc) series(suffix string, values []string, extra ...string) string {
+	var b strings.Builder
+	b.WriteString(d.fqName)
+	b.WriteString(suffix)
+	n := len(values) + len(extra)/2
+	if n == 0 {
+		return b.String()
+	}
+	b.WriteByte('{')
+	i := 0
+	add := func(k, v string) {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		i++
+		b.WriteString(k)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(v))
+		b.WriteByte('"')
+	}
+	for j, v := range values {
+		add(d.labels[j], v)
+	}
+	for j := 0; j+1 < len(extra); j += 2 {
+		add(extra[j], extra[j+1])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sortedKeys returns map keys in a stable order so output is deterministic.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func splitKey(k string, n int) []string {
+	if n == 0 {
+		return nil
+	}
+	return strings.Split(k, "\xff")
+}
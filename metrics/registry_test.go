@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteTextFormat(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.NewCounterVec("test_requests_total", "Requests.", "code")
+	c.Inc("200")
+	c.Inc("200")
+	c.Add(0.5, `a"b`)
+	g := reg.NewGaugeVec("test_temperature", "Line one\nline two.")
+	g.Set(-1.5)
+	h := reg.NewHistogramVec("test_latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/x")
+	h.Observe(0.5, "/x")
+	h.Observe(5, "/x")
+	reg.NewGaugeFunc("test_items", "Items.", []string{"kind"}, func(emit func(float64, ...string)) {
+		emit(2, "b")
+		emit(1, "a")
+	})
+
+	var buf bytes.Buffer
+	if err := WriteText(&buf, reg); err != nil {
+		t.Fatalf("WriteText: %v", err)
+	}
+	want := `# HELP test_items Items.
+# TYPE test_items gauge
+test_items{kind="a"} 1
+test_items{kind="b"} 2
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{route="/x",le="0.1"} 1
+test_latency_seconds_bucket{route="/x",le="1"} 2
+test_latency_seconds_bucket{route="/x",le="+Inf"} 3
+test_latency_seconds_sum{route="/x"} 5.55
+test_latency_seconds_count{route="/x"} 3
+# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{code="200"} 2
+test_requests_total{code="a\"b"} 0.5
+# HELP test_temperature Line one\nline two.
+# TYPE test_temperature gauge
+test_temperature -1.5
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteText output mismatch\n got:\n%s\nwant:\n%s", got, want)
+	}
+	if c.Value("200") != 2 || h.Count("/x") != 3 {
+		t.Errorf("Value/Count = %v/%v, want 2/3", c.Value("200"), h.Count("/x"))
+	}
+}
+
+func TestDuplicateRegistrationPanics(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounterVec("dup_total", "x")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic on duplicate registration")
+		}
+	}()
+	reg.NewGaugeVec("dup_total", "x")
+}
+
+func TestLabelCountMismatchPanics(t *testing.T) {
+	c := NewRegistry().NewCounterVec("labels_total", "x", "a", "b")
+	defer func() {
+		r := recover()
+		if r == nil || !strings.Contains(r.(string), "expects 2 label values") {
+			t.Fatalf("recover() = %v, want label count panic", r)
+		}
+	}()
+	c.Inc("only-one")
+}
@@ -0,0 +1,266 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// CounterVec is a monotonically increasing value per label set.
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]*atomicFloat
+}
+
+// NewCounterVec registers a counter family on r.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		desc:   desc{fqName: name, help: help, kind: "counter", labels: labels},
+		values: make(map[string]*atomicFloat),
+	}
+	r.register(c)
+	return c
+}
+
+func (c *CounterVec) get(values []string) *atomicFloat {
+	k := c.key(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.values[k]
+	if !ok {
+		v = new(atomicFloat)
+		c.values[k] = v
+	}
+	return v
+}
+
+// Inc adds one to the series identified by label values.
+func (c *CounterVec) Inc(values ...string) { c.get(values).add(1) }
+
+// Add adds delta (which must be non-negative) to the series.
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.get(values).add(delta)
+}
+
+// Value returns the current value of a series, 0 if it was never touched.
+func (c *CounterVec) Value(values ...string) float64 {
+	k := c.key(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, ok := c.values[k]; ok {
+		return v.load()
+	}
+	return 0
+}
+
+func (c *CounterVec) write(w io.Writer) error {
+	if err := c.writeHeader(w); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range sortedKeys(c.values) {
+		if _, err := fmt.Fprintf(w, "%s %s\n", c.series("", splitKey(k, len(c.labels))), formatFloat(c.values[k].load())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GaugeVec is a value per label set that can go up and down.
+type GaugeVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]*atomicFloat
+}
+
+// NewGaugeVec registers a gauge family on r.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{
+		desc:   desc{fqName: name, help: help, kind: "gauge", labels: labels},
+		values: make(map[string]*atomicFloat),
+	}
+	r.register(g)
+	return g
+}
+
+// Set sets the series identified by label values.
+func (g *GaugeVec) Set(v float64, values ...string) {
+	k := g.key(values)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	f, ok := g.values[k]
+	if !ok {
+		f = new(atomicFloat)
+		g.values[k] = f
+	}
+	f.store(v)
+}
+
+// Delete drops a series, e.g. when the thing it describes goes away.
+func (g *GaugeVec) Delete(values ...string) {
+	k := g.key(values)
+	g.mu.Lock()
+	delete(g.values, k)
+	g.mu.Unlock()
+}
+
+func (g *GaugeVec) write(w io.Writer) error {
+	if err := g.writeHeader(w); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, k := range sortedKeys(g.values) {
+		if _, err := fmt.Fprintf(w, "%s %s\n", g.series("", splitKey(k, len(g.labels))), formatFloat(g.values[k].load())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GaugeFunc is a gauge family whose series are produced at scrape time,
+// for values that are cheaper to derive than to keep in sync.
+type GaugeFunc struct {
+	desc
+	collect func(emit func(v float64, labelValues ...string))
+}
+
+// NewGaugeFunc registers a gauge family computed by collect on every scrape.
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, collect func(emit func(v float64, labelValues ...string))) *GaugeFunc {
+	g := &GaugeFunc{
+		desc:    desc{fqName: name, help: help, kind: "gauge", labels: labels},
+		collect: collect,
+	}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) error {
+	values := make(map[string]float64)
+	g.collect(func(v float64, labelValues ...string) {
+		values[g.key(labelValues)] = v
+	})
+	if err := g.writeHeader(w); err != nil {
+		return err
+	}
+	for _, k := range sortedKeys(values) {
+		if _, err := fmt.Fprintf(w, "%s %s\n", g.series("", splitKey(k, len(g.labels))), formatFloat(values[k])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HistogramVec counts observations into cumulative buckets per label set.
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, non-cumulative; last slot is +Inf
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec registers a histogram family on r. Buckets are upper
+// bounds in increasing order; +Inf is implied.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			panic(fmt.Sprintf("metrics: %s buckets must be increasing", name))
+		}
+	}
+	h := &HistogramVec{
+		desc:    desc{fqName: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		values:  make(map[string]*histogram),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe records v in the series identified by label values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	k := h.key(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.values[k]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets)+1)}
+		h.values[k] = s
+	}
+	i := len(h.buckets)
+	for j, ub := range h.buckets {
+		if v <= ub {
+			i = j
+			break
+		}
+	}
+	s.counts[i]++
+	s.sum += v
+	s.count++
+}
+
+// Count returns the number of observations in a series.
+func (h *HistogramVec) Count(values ...string) uint64 {
+	k := h.key(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.values[k]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w io.Writer) error {
+	if err := h.writeHeader(w); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, k := range sortedKeys(h.values) {
+		lv := splitKey(k, len(h.labels))
+		s := h.values[k]
+		var cum uint64
+		for i, ub := range h.buckets {
+			cum += s.counts[i]
+			if _, err := fmt.Fprintf(w, "%s %d\n", h.series("_bucket", lv, "le", formatFloat(ub)), cum); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s %d\n%s %s\n%s %d\n",
+			h.series("_bucket", lv, "le", "+Inf"), s.count,
+			h.series("_sum", lv), formatFloat(s.sum),
+			h.series("_count", lv), s.count,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// atomicFloat is a float64 updated with compare-and-swap.
+type atomicFloat struct{ bits atomic.Uint64 }
+
+func (f *atomicFloat) load() float64   { return math.Float64frombits(f.bits.Load()) }
+func (f *atomicFloat) store(v float64) { f.bits.Store(math.Float64bits(v)) }
+
+func (f *atomicFloat) add(delta float64) {
+	for {
+		old := f.bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if f.bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
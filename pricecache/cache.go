@@ -0,0 +1,172 @@
+// Package pricecache sits between the repository and the upstream price
+// source. It reuses prices for a configurable TTL, coalesces concurrent
+// lookups of the same coin into one upstream call and, while the upstream
+// is failing, keeps serving the last known price for a bounded time.
+package pricecache
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cryptoserver/config"
+	"cryptoserver/gecko/geckoclient"
+	"cryptoserver/repository"
+)
+
+// Cache wraps a repository.PriceSource. It implements both PriceSource
+// and repository.QuoteSource, so the repository records whether each
+// price came from the cache.
+type Cache struct {
+	src      repository.PriceSource
+	ttl      time.Duration
+	staleTTL time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	entries  map[string]entry
+	inflight map[string]*call
+
+	hits, misses, coalesced, staleServed, failures atomic.Int64
+}
+
+type entry struct {
+	price     float64
+	provider  string
+	fetchedAt time.Time
+}
+
+// call is one upstream fetch that concurrent lookups wait on.
+type call struct {
+	done  chan struct{}
+	quote repository.Quote
+	err   error
+}
+
+// New wraps src with the TTLs from cfg.
+func New(cfg config.CacheConfig, src repository.PriceSource) *Cache {
+	return &Cache{
+		src:      src,
+		ttl:      time.Duration(cfg.TTL),
+		staleTTL: time.Duration(cfg.StaleTTL),
+		now:      time.Now,
+		entries:  make(map[string]entry),
+		inflight: make(map[string]*call),
+	}
+}
+
+// GetName is passed through: names come from the coin list the upstream
+// client already keeps in memory.
+func (c *Cache) GetName(symbol string) (string, error) {
+	return c.src.GetName(symbol)
+}
+
+// GetPrice is GetQuote without provenance.
+func (c *Cache) GetPrice(symbol string) (float64, error) {
+	q, err := c.GetQuote(symbol)
+	return q.Price, err
+}
+
+// GetQuote returns a fresh cached price if there is one; otherwise it
+// fetches from upstream, sharing the call with concurrent lookups of the
+// same symbol. If that fetch fails because the upstream is unavailable
+// or rate limiting us, and a price younger than TTL+StaleTTL is cached, the stale price is
+// returned instead of the error.
+func (c *Cache) GetQuote(symbol string) (repository.Quote, error) {
+	key := strings.ToLower(strings.TrimSpace(symbol))
+
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && c.ttl > 0 && c.now().Sub(e.fetchedAt) < c.ttl {
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return repository.Quote{Price: e.price, Cached: true, Provider: e.provider}, nil
+	}
+	if cl, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		c.coalesced.Add(1)
+		<-cl.done
+		return cl.quote, cl.err
+	}
+	cl := &call{done: make(chan struct{})}
+	c.inflight[key] = cl
+	c.mu.Unlock()
+	c.misses.Add(1)
+
+	q, err := c.fetch(symbol)
+
+	c.mu.Lock()
+	now := c.now()
+	if err == nil {
+		c.entries[key] = entry{price: q.Price, provider: q.Provider, fetchedAt: now}
+		cl.quote = q
+	} else if e, ok := c.entries[key]; ok && serveStale(err) && now.Sub(e.fetchedAt) < c.ttl+c.staleTTL && c.staleTTL > 0 {
+		c.staleServed.Add(1)
+		cl.quote = repository.Quote{Price: e.price, Cached: true, Stale: true, Provider: e.provider}
+	} else {
+		c.failures.Add(1)
+		cl.err = err
+	}
+	delete(c.inflight, key)
+	c.mu.Unlock()
+	close(cl.done)
+	return cl.quote, cl.err
+}
+
+// fetch asks the wrapped source, keeping its provenance if it reports one.
+func (c *Cache) fetch(symbol string) (repository.Quote, error) {
+	if qs, ok := c.src.(repository.QuoteSource); ok {
+		return qs.GetQuote(symbol)
+	}
+	price, err := c.src.GetPrice(symbol)
+	return repository.Quote{Price: price}, err
+}
+
+// serveStale reports whether err is an upstream outage or refusal, as
+// opposed to the coin no longer being listed, where a stale price would
+// be misleading.
+func serveStale(err error) bool {
+	return errors.Is(err, geckoclient.ErrServiceUnavailable) ||
+		errors.Is(err, geckoclient.ErrBadResponse) ||
+		errors.Is(err, geckoclient.ErrRateLimited)
+}
+
+// Stats is a snapshot of cache effectiveness, served at GET /admin/cache.
+type Stats struct {
+	Entries int `json:"entries"`
+	// Hits are lookups answered from a fresh entry, Misses those that
+	// called upstream, Coalesced those that waited on another lookup's
+	// upstream call.
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Coalesced int64 `json:"coalesced"`
+	// StaleServed counts failed upstream calls answered with a stale price;
+	// Errors those that had nothing to fall back on.
+	StaleServed int64   `json:"stale_served"`
+	Errors      int64   `json:"errors"`
+	HitRatio    float64 `json:"hit_ratio"`
+	TTL         string  `json:"ttl"`
+	StaleTTL    string  `json:"stale_ttl"`
+}
+
+// Stats returns the current counters.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	n := len(c.entries)
+	c.mu.Unlock()
+	s := Stats{
+		Entries:     n,
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Coalesced:   c.coalesced.Load(),
+		StaleServed: c.staleServed.Load(),
+		Errors:      c.failures.Load(),
+		TTL:         c.ttl.String(),
+		StaleTTL:    c.staleTTL.String(),
+	}
+	if total := s.Hits + s.Misses + s.Coalesced; total > 0 {
+		s.HitRatio = float64(s.Hits+s.Coalesced) / float64(total)
+	}
+	return s
+}
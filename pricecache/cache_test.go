@@ -0,0 +1,237 @@
+package pricecache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cryptoserver/config"
+	"cryptoserver/gecko/geckoclient"
+	"cryptoserver/repository"
+)
+
+type fakeSource struct {
+	calls atomic.Int64
+	gate  chan struct{} // when set, GetPrice blocks until it is closed
+
+	mu    sync.Mutex
+	price float64
+	err   error
+}
+
+func (f *fakeSource) GetName(symbol string) (string, error) { return "Name of " + symbol, nil }
+
+func (f *fakeSource) GetPrice(symbol string) (float64, error) {
+	f.calls.Add(1)
+	if f.gate != nil {
+		<-f.gate
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.price, f.err
+}
+
+func (f *fakeSource) set(price float64, err error) {
+	f.mu.Lock()
+	f.price, f.err = price, err
+	f.mu.Unlock()
+}
+
+// newTestCache returns a cache over src with a clock the test advances.
+func newTestCache(src *fakeSource, ttl, staleTTL time.Duration) (*Cache, *time.Time) {
+	c := New(config.CacheConfig{TTL: config.Duration(ttl), StaleTTL: config.Duration(staleTTL)}, src)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestCacheServesWithinTTL(t *testing.T) {
+	src := &fakeSource{price: 100}
+	c, now := newTestCache(src, time.Minute, 0)
+
+	q, err := c.GetQuote("BTC")
+	if err != nil || q != (repository.Quote{Price: 100}) {
+		t.Fatalf("first lookup = %+v, %v; want fresh 100", q, err)
+	}
+	src.set(200, nil)
+	*now = now.Add(30 * time.Second)
+	q, err = c.GetQuote("btc")
+	if err != nil || q != (repository.Quote{Price: 100, Cached: true}) {
+		t.Fatalf("lookup within TTL = %+v, %v; want cached 100", q, err)
+	}
+	*now = now.Add(31 * time.Second)
+	q, err = c.GetQuote("btc")
+	if err != nil || q != (repository.Quote{Price: 200}) {
+		t.Fatalf("lookup after TTL = %+v, %v; want fresh 200", q, err)
+	}
+	if n := src.calls.Load(); n != 2 {
+		t.Errorf("upstream calls = %d, want 2", n)
+	}
+	st := c.Stats()
+	if st.Hits != 1 || st.Misses != 2 || st.Entries != 1 {
+		t.Errorf("stats = %+v, want 1 hit, 2 misses, 1 entry", st)
+	}
+}
+
+func TestCacheZeroTTLDisablesCaching(t *testing.T) {
+	src := &fakeSource{price: 1}
+	c, _ := newTestCache(src, 0, 0)
+	for range 3 {
+		if q, _ := c.GetQuote("btc"); q.Cached {
+			t.Fatal("price served from cache with TTL 0")
+		}
+	}
+	if n := src.calls.Load(); n != 3 {
+		t.Errorf("upstream calls = %d, want 3", n)
+	}
+}
+
+func TestCacheCoalescesConcurrentLookups(t *testing.T) {
+	src := &fakeSource{price: 42, gate: make(chan struct{})}
+	c, _ := newTestCache(src, 0, 0)
+
+	const n = 20
+	var wg sync.WaitGroup
+	results := make([]float64, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = c.GetPrice("eth")
+		}()
+	}
+	// Wait until every lookup is either the leader or parked on it.
+	deadline := time.Now().Add(2 * time.Second)
+	for c.Stats().Misses+c.Stats().Coalesced < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("lookups did not start: %+v", c.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(src.gate)
+	wg.Wait()
+
+	if got := src.calls.Load(); got != 1 {
+		t.Errorf("upstream calls = %d, want 1", got)
+	}
+	for i, p := range results {
+		if p != 42 {
+			t.Errorf("lookup %d got %v, want 42", i, p)
+		}
+	}
+	if st := c.Stats(); st.Coalesced != n-1 {
+		t.Errorf("coalesced = %d, want %d", st.Coalesced, n-1)
+	}
+}
+
+func TestCacheServesStaleOnUpstreamFailure(t *testing.T) {
+	outage := fmt.Errorf("%w: connection refused", geckoclient.ErrServiceUnavailable)
+	tests := []struct {
+		name      string
+		err       error
+		age       time.Duration
+		wantStale bool
+	}{
+		{"outage within stale window", outage, 5 * time.Minute, true},
+		{"bad response within stale window", fmt.Errorf("%w: garbage", geckoclient.ErrBadResponse), 5 * time.Minute, true},
+		{"rate limited within stale window", fmt.Errorf("%w: 429", geckoclient.ErrRateLimited), 5 * time.Minute, true},
+		{"outage past stale window", outage, 12 * time.Minute, false},
+		{"coin delisted", fmt.Errorf("%w: no price", geckoclient.ErrNotFound), 5 * time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &fakeSource{price: 10}
+			c, now := newTestCache(src, time.Minute, 10*time.Minute)
+			if _, err := c.GetQuote("btc"); err != nil {
+				t.Fatal(err)
+			}
+			src.set(0, tt.err)
+			*now = now.Add(tt.age)
+
+			q, err := c.GetQuote("btc")
+			if tt.wantStale {
+				if err != nil || q != (repository.Quote{Price: 10, Cached: true, Stale: true}) {
+					t.Fatalf("got %+v, %v; want stale 10", q, err)
+				}
+				if st := c.Stats(); st.StaleServed != 1 {
+					t.Errorf("stale_served = %d, want 1", st.StaleServed)
+				}
+				return
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if st := c.Stats(); st.Errors != 1 {
+				t.Errorf("errors = %d, want 1", st.Errors)
+			}
+		})
+	}
+}
+
+func TestRepositoryRecordsCacheProvenance(t *testing.T) {
+	src := &fakeSource{price: 5}
+	c, _ := newTestCache(src, time.Minute, 0)
+	repo := repository.NewMemoryCryptoRepoWithConfig(config.Default().Repository, c)
+
+	if _, err := repo.Create("btc"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.RefreshPrice("btc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.History) != 2 || got.History[0].Cached || !got.History[1].Cached {
+		t.Fatalf("history = %+v, want fresh then cached record", got.History)
+	}
+}
+
+// quoteSource reports which provider answered, like providers.Set.
+type quoteSource struct{ fakeSource }
+
+func (q *quoteSource) GetQuote(symbol string) (repository.Quote, error) {
+	price, err := q.GetPrice(symbol)
+	return repository.Quote{Price: price, Provider: "binance"}, err
+}
+
+func TestCacheKeepsProvider(t *testing.T) {
+	src := &quoteSource{fakeSource{price: 5}}
+	c := New(config.CacheConfig{TTL: config.Duration(time.Minute)}, src)
+	repo := repository.NewMemoryCryptoRepoWithConfig(config.Default().Repository, c)
+
+	if _, err := repo.Create("btc"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.RefreshPrice("btc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range got.History {
+		if r.Provider != "binance" {
+			t.Errorf("history[%d].Provider = %q, want binance", i, r.Provider)
+		}
+	}
+	if !got.History[1].Cached {
+		t.Errorf("second record not served from cache: %+v", got.History[1])
+	}
+}
+
+func TestTenantsShareUpstreamFetches(t *testing.T) {
+	src := &fakeSource{price: 5}
+	c, _ := newTestCache(src, time.Minute, 0)
+	tenants := repository.NewMemoryTenants(config.Default().Repository, c)
+
+	for _, tenant := range []string{"team-a", "team-b", "team-c"} {
+		if _, err := tenants.For(tenant).Create("btc"); err != nil {
+			t.Fatalf("%s: %v", tenant, err)
+		}
+		if _, err := tenants.For(tenant).RefreshPrice("btc"); err != nil {
+			t.Fatalf("%s: %v", tenant, err)
+		}
+	}
+	if n := src.calls.Load(); n != 1 {
+		t.Errorf("upstream calls = %d, want 1 shared by all tenants", n)
+	}
+}
@@ -0,0 +1,206 @@
+// Package providers puts several price providers behind one
+// repository.PriceSource, combining them with a fallback or median
+// strategy and reporting which provider supplied each price.
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+
+	"cryptoserver/binance/binanceclient"
+	"cryptoserver/config"
+	"cryptoserver/gecko/geckoclient"
+	"cryptoserver/repository"
+)
+
+// Provider is one source of USD-ish spot prices. Errors wrap the
+// geckoclient sentinels.
+type Provider interface {
+	Name() string
+	GetPrice(symbol string) (float64, error)
+}
+
+// NameSource resolves display names; only CoinGecko has them.
+type NameSource interface {
+	GetName(symbol string) (string, error)
+}
+
+type named struct {
+	name string
+	src  interface {
+		GetPrice(symbol string) (float64, error)
+	}
+}
+
+func (n named) Name() string                            { return n.name }
+func (n named) GetPrice(symbol string) (float64, error) { return n.src.GetPrice(symbol) }
+
+// Named gives src a provider name.
+func Named(name string, src interface {
+	GetPrice(symbol string) (float64, error)
+}) Provider {
+	return named{name: name, src: src}
+}
+
+// Set combines providers with a strategy; it implements
+// repository.PriceSource and repository.QuoteSource.
+type Set struct {
+	names     NameSource
+	providers []Provider
+	strategy  string
+}
+
+// New combines ps (in priority order) with strategy, which is
+// config.StrategyFallback or config.StrategyMedian.
+func New(strategy string, names NameSource, ps ...Provider) *Set {
+	return &Set{names: names, providers: ps, strategy: strategy}
+}
+
+// FromConfig builds the providers enabled in cfg around the CoinGecko
+// client, which also serves names.
+func FromConfig(cfg config.ProvidersConfig, gecko *geckoclient.Client) *Set {
+	ps := make([]Provider, 0, len(cfg.Enabled))
+	for _, name := range cfg.Enabled {
+		switch name {
+		case config.ProviderCoinGecko:
+			ps = append(ps, Named(config.ProviderCoinGecko, gecko))
+		case config.ProviderBinance:
+			ps = append(ps, binanceclient.New(cfg.Binance))
+		}
+	}
+	return New(cfg.Strategy, gecko, ps...)
+}
+
+// Names lists the providers in priority order.
+func (s *Set) Names() []string {
+	out := make([]string, len(s.providers))
+	for i, p := range s.providers {
+		out[i] = p.Name()
+	}
+	return out
+}
+
+func (s *Set) GetName(symbol string) (string, error) { return s.names.GetName(symbol) }
+
+func (s *Set) GetPrice(symbol string) (float64, error) {
+	q, err := s.GetQuote(symbol)
+	return q.Price, err
+}
+
+// GetQuote prices symbol with the configured strategy. Quote.Provider is
+// the provider that answered, or for the median every provider that
+// contributed, joined with "+".
+func (s *Set) GetQuote(symbol string) (repository.Quote, error) {
+	if s.strategy == config.StrategyMedian {
+		return s.median(symbol)
+	}
+	return s.fallback(symbol)
+}
+
+// result is one provider's answer.
+type result struct {
+	provider string
+	price    float64
+	err      error
+}
+
+// fallback asks providers in order and returns the first price. A
+// provider that does not list the coin is skipped like one that is down.
+func (s *Set) fallback(symbol string) (repository.Quote, error) {
+	var failed []result
+	for _, p := range s.providers {
+		price, err := p.GetPrice(symbol)
+		if err == nil {
+			return repository.Quote{Price: price, Provider: p.Name()}, nil
+		}
+		failed = append(failed, result{provider: p.Name(), err: err})
+	}
+	return repository.Quote{}, combine(failed)
+}
+
+// minMedianAnswers is how many usable prices a median needs: with two, one
+// bad quote would move their mean as far as it likes.
+const minMedianAnswers = 3
+
+// median asks every provider concurrently and returns the median of the
+// usable prices that came back. With fewer than minMedianAnswers of them
+// it returns the price of the first provider, in priority order, that
+// answered.
+func (s *Set) median(symbol string) (repository.Quote, error) {
+	results := make([]result, len(s.providers))
+	var wg sync.WaitGroup
+	for i, p := range s.providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			price, err := p.GetPrice(symbol)
+			results[i] = result{provider: p.Name(), price: price, err: err}
+		}()
+	}
+	wg.Wait()
+
+	var prices []float64
+	var from []string
+	var failed []result
+	for _, r := range results {
+		if r.err == nil && !usable(r.price) {
+			r.err = fmt.Errorf("%w: unusable price %v", geckoclient.ErrBadResponse, r.price)
+		}
+		if r.err != nil {
+			failed = append(failed, r)
+			continue
+		}
+		prices = append(prices, r.price)
+		from = append(from, r.provider)
+	}
+	if len(prices) == 0 {
+		return repository.Quote{}, combine(failed)
+	}
+	if len(prices) < minMedianAnswers {
+		return repository.Quote{Price: prices[0], Provider: from[0]}, nil
+	}
+	slices.Sort(prices)
+	mid := len(prices) / 2
+	price := prices[mid]
+	if len(prices)%2 == 0 {
+		price = (prices[mid-1] + prices[mid]) / 2
+	}
+	return repository.Quote{Price: price, Provider: strings.Join(from, "+")}, nil
+}
+
+// usable reports whether price can be a spot price at all.
+func usable(price float64) bool {
+	return price > 0 && !math.IsInf(price, 0)
+}
+
+// combine reports why every provider failed. The coin counts as unknown
+// only if all providers say so; otherwise the first outage wins, so the
+// client sees "try later" rather than "no such price" while a source that
+// might know the coin is down.
+func combine(failed []result) error {
+	if len(failed) == 0 {
+		return fmt.Errorf("%w: no price providers configured", geckoclient.ErrServiceUnavailable)
+	}
+	pick := 0
+	for i, r := range failed {
+		if !errors.Is(r.err, geckoclient.ErrNotFound) {
+			pick = i
+			break
+		}
+	}
+	err := fmt.Errorf("%s: %w", failed[pick].provider, failed[pick].err)
+	if len(failed) == 1 {
+		return err
+	}
+	var others []string
+	for i, r := range failed {
+		if i != pick {
+			others = append(others, fmt.Sprintf("%s: %v", r.provider, r.err))
+		}
+	}
+	return fmt.Errorf("%w (also %s)", err, strings.Join(others, "; "))
+}
@@ -0,0 +1,142 @@
+package providers
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"cryptoserver/config"
+	"cryptoserver/gecko/geckoclient"
+	"cryptoserver/repository"
+)
+
+type fakeProvider struct {
+	name  string
+	price float64
+	err   error
+	calls atomic.Int64
+}
+
+func (f *fakeProvider) Name() string { return f.name }
+
+func (f *fakeProvider) GetPrice(symbol string) (float64, error) {
+	f.calls.Add(1)
+	return f.price, f.err
+}
+
+type fakeNames struct{}
+
+func (fakeNames) GetName(symbol string) (string, error) { return "Name of " + symbol, nil }
+
+func TestFallbackUsesFirstAnswer(t *testing.T) {
+	primary := &fakeProvider{name: "a", err: geckoclient.ErrServiceUnavailable}
+	secondary := &fakeProvider{name: "b", price: 42}
+	third := &fakeProvider{name: "c", price: 7}
+	s := New(config.StrategyFallback, fakeNames{}, primary, secondary, third)
+
+	q, err := s.GetQuote("btc")
+	if err != nil || q != (repository.Quote{Price: 42, Provider: "b"}) {
+		t.Fatalf("GetQuote = %+v, %v; want 42 from b", q, err)
+	}
+	if third.calls.Load() != 0 {
+		t.Errorf("third provider called %d times after b answered", third.calls.Load())
+	}
+
+	primary.err = nil
+	primary.price = 10
+	if q, _ := s.GetQuote("btc"); q.Provider != "a" || q.Price != 10 {
+		t.Errorf("recovered primary: GetQuote = %+v, want 10 from a", q)
+	}
+}
+
+func TestMedianOfProviders(t *testing.T) {
+	cases := []struct {
+		name      string
+		providers []Provider
+		want      repository.Quote
+	}{
+		{
+			name:      "odd",
+			providers: []Provider{&fakeProvider{name: "a", price: 3}, &fakeProvider{name: "b", price: 1000}, &fakeProvider{name: "c", price: 2}},
+			want:      repository.Quote{Price: 3, Provider: "a+b+c"},
+		},
+		{
+			name:      "even",
+			providers: []Provider{&fakeProvider{name: "a", price: 2}, &fakeProvider{name: "b", price: 4}, &fakeProvider{name: "c", price: 6}, &fakeProvider{name: "d", price: 9000}},
+			want:      repository.Quote{Price: 5, Provider: "a+b+c+d"},
+		},
+		{
+			name:      "two answers take the primary",
+			providers: []Provider{&fakeProvider{name: "a", price: 100}, &fakeProvider{name: "b", price: 100000}},
+			want:      repository.Quote{Price: 100, Provider: "a"},
+		},
+		{
+			name:      "two answers with a spiking primary",
+			providers: []Provider{&fakeProvider{name: "a", price: 100000}, &fakeProvider{name: "b", price: 100}},
+			want:      repository.Quote{Price: 100000, Provider: "a"},
+		},
+		{
+			name:      "drops unusable quotes",
+			providers: []Provider{&fakeProvider{name: "a", price: 0}, &fakeProvider{name: "b", price: math.NaN()}, &fakeProvider{name: "c", price: 100}},
+			want:      repository.Quote{Price: 100, Provider: "c"},
+		},
+		{
+			name:      "skips failures",
+			providers: []Provider{&fakeProvider{name: "a", err: geckoclient.ErrBadResponse}, &fakeProvider{name: "b", price: 5}},
+			want:      repository.Quote{Price: 5, Provider: "b"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := New(config.StrategyMedian, fakeNames{}, tc.providers...).GetQuote("btc")
+			if err != nil || q != tc.want {
+				t.Errorf("GetQuote = %+v, %v; want %+v", q, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestMedianWithOnlyUnusableQuotes(t *testing.T) {
+	_, err := New(config.StrategyMedian, fakeNames{}, &fakeProvider{name: "a", price: -1}, &fakeProvider{name: "b", price: math.Inf(1)}).GetQuote("btc")
+	if !errors.Is(err, geckoclient.ErrBadResponse) {
+		t.Errorf("error = %v, want a bad response", err)
+	}
+}
+
+func TestAllProvidersFail(t *testing.T) {
+	for _, strategy := range []string{config.StrategyFallback, config.StrategyMedian} {
+		t.Run(strategy, func(t *testing.T) {
+			notListed := &fakeProvider{name: "a", err: geckoclient.ErrNotFound}
+			down := &fakeProvider{name: "b", err: geckoclient.ErrServiceUnavailable}
+
+			_, err := New(strategy, fakeNames{}, notListed, down).GetQuote("btc")
+			if !errors.Is(err, geckoclient.ErrServiceUnavailable) || errors.Is(err, geckoclient.ErrNotFound) {
+				t.Errorf("one provider down: error = %v, want service unavailable", err)
+			}
+			if !strings.Contains(err.Error(), "a: ") || !strings.Contains(err.Error(), "b: ") {
+				t.Errorf("error %q does not name both providers", err)
+			}
+
+			down.err = geckoclient.ErrNotFound
+			if _, err := New(strategy, fakeNames{}, notListed, down).GetQuote("btc"); !errors.Is(err, geckoclient.ErrNotFound) {
+				t.Errorf("no provider lists coin: error = %v, want not found", err)
+			}
+		})
+	}
+}
+
+func TestSetServesNamesAndPrices(t *testing.T) {
+	s := New(config.StrategyFallback, fakeNames{}, Named("gecko", &fakeProvider{price: 9}))
+	var src repository.PriceSource = s
+	if name, err := src.GetName("btc"); err != nil || name != "Name of btc" {
+		t.Errorf("GetName = %q, %v", name, err)
+	}
+	if price, err := src.GetPrice("btc"); err != nil || price != 9 {
+		t.Errorf("GetPrice = %v, %v", price, err)
+	}
+	if got := s.Names(); len(got) != 1 || got[0] != "gecko" {
+		t.Errorf("Names() = %v", got)
+	}
+}
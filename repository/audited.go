@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"cryptoserver/audit"
+)
+
+// ActorRepository is implemented by repositories that record who changes
+// them. As returns a view whose changes are attributed to actor.
+type ActorRepository interface {
+	CryptoRepository
+	As(actor audit.Actor) CryptoRepository
+}
+
+// Audited records every successful Create, Delete, RefreshPrice, Restore,
+// metadata edit and purge of the wrapped repository in an audit log, with
+// the price before and after.
+// Changes are attributed to audit.SystemActor unless made through As.
+type Audited struct {
+	CryptoRepository
+	log    audit.Store
+	tenant string
+	actor  audit.Actor
+	now    func() time.Time
+}
+
+// NewAudited records the changes of repo, which holds tenant's coins, in log.
+func NewAudited(repo CryptoRepository, log audit.Store, tenant string) *Audited {
+	return &Audited{
+		CryptoRepository: repo,
+		log:              log,
+		tenant:           tenant,
+		actor:            audit.Actor{Subject: audit.SystemActor},
+		now:              time.Now,
+	}
+}
+
+func (a *Audited) As(actor audit.Actor) CryptoRepository {
+	out := *a
+	out.actor = actor
+	return &out
+}
+
+func (a *Audited) Create(symbol string) (Crypto, error) {
+	c, err := a.CryptoRepository.Create(symbol)
+	if err == nil {
+		a.record(audit.ActionCreate, c.Symbol, nil, &c.CurrentPrice)
+	}
+	return c, err
+}
+
+func (a *Audited) Delete(symbol string) error {
+	return a.DeleteIf(symbol, nil)
+}
+
+func (a *Audited) DeleteIf(symbol string, ok Precondition) error {
+	var before *float64
+	err := DeleteIf(a.CryptoRepository, symbol, priceSeen(ok, &before))
+	if err == nil {
+		a.record(audit.ActionDelete, symbol, before, nil)
+	}
+	return err
+}
+
+func (a *Audited) RefreshPrice(symbol string) (Crypto, error) {
+	return a.RefreshPriceIf(symbol, nil)
+}
+
+func (a *Audited) RefreshPriceIf(symbol string, ok Precondition) (Crypto, error) {
+	var before *float64
+	c, err := RefreshPriceIf(a.CryptoRepository, symbol, priceSeen(ok, &before))
+	if err == nil {
+		a.record(audit.ActionRefresh, c.Symbol, before, &c.CurrentPrice)
+	}
+	return c, err
+}
+
+// UpdateMetadata sees a repository without metadata as one without the
+// coin.
+func (a *Audited) UpdateMetadata(symbol string, p MetadataPatch, ok Precondition) (Crypto, error) {
+	me, is := a.CryptoRepository.(MetadataEditor)
+	if !is {
+		return Crypto{}, missing(symbol)
+	}
+	c, err := me.UpdateMetadata(symbol, p, ok)
+	if err == nil {
+		a.record(audit.ActionUpdate, c.Symbol, nil, nil)
+	}
+	return c, err
+}
+
+// Restore, ListDeleted and PurgeExpired see a repository without
+// tombstones as one with nothing deleted.
+func (a *Audited) Restore(symbol string) (Crypto, error) {
+	sd, ok := a.CryptoRepository.(SoftDeleter)
+	if !ok {
+		return Crypto{}, missing(symbol)
+	}
+	c, err := sd.Restore(symbol)
+	if err == nil {
+		a.record(audit.ActionRestore, c.Symbol, nil, &c.CurrentPrice)
+	}
+	return c, err
+}
+
+func (a *Audited) ListDeleted() ([]Crypto, error) {
+	if sd, ok := a.CryptoRepository.(SoftDeleter); ok {
+		return sd.ListDeleted()
+	}
+	return []Crypto{}, nil
+}
+
+func (a *Audited) PurgeExpired(now time.Time) []string {
+	sd, ok := a.CryptoRepository.(SoftDeleter)
+	if !ok {
+		return nil
+	}
+	purged := sd.PurgeExpired(now)
+	for _, symbol := range purged {
+		a.record(audit.ActionPurge, symbol, nil, nil)
+	}
+	return purged
+}
+
+// Find passes through to the wrapped repository.
+func (a *Audited) Find(q ListQuery) (Page, error) {
+	return Find(a.CryptoRepository, q)
+}
+
+// CheckHealth passes through to the wrapped repository.
+func (a *Audited) CheckHealth() error {
+	if hc, ok := a.CryptoRepository.(HealthChecker); ok {
+		return hc.CheckHealth()
+	}
+	return nil
+}
+
+// ListAt and Events pass through to the wrapped repository; reads are
+// not audited.
+func (a *Audited) ListAt(t time.Time) ([]Crypto, error) {
+	if el, ok := a.CryptoRepository.(EventLog); ok {
+		return el.ListAt(t)
+	}
+	return nil, ErrNoEventLog
+}
+
+func (a *Audited) Events(after int64, limit int) ([]Event, error) {
+	if el, ok := a.CryptoRepository.(EventLog); ok {
+		return el.Events(after, limit)
+	}
+	return nil, ErrNoEventLog
+}
+
+// priceSeen wraps ok to store in *before the price of the coin it is
+// checked against. A ConditionalRepository checks it last under the lock
+// that applies the change, so *before is the price the change replaced,
+// whatever concurrent changes ran in between.
+func priceSeen(ok Precondition, before **float64) Precondition {
+	return func(c Crypto) bool {
+		price := c.CurrentPrice
+		*before = &price
+		return ok == nil || ok(c)
+	}
+}
+
+// record appends an entry. The change has already happened, so a failing
+// log is reported rather than turned into an error for the caller.
+func (a *Audited) record(action, symbol string, before, after *float64) {
+	e := audit.Entry{
+		Time:        a.now(),
+		Action:      action,
+		Tenant:      a.tenant,
+		Symbol:      strings.ToLower(strings.TrimSpace(symbol)),
+		Actor:       a.actor,
+		PriceBefore: before,
+		PriceAfter:  after,
+	}
+	if _, err := a.log.Append(e); err != nil {
+		slog.Error("audit log append failed", "action", action, "tenant", a.tenant, "symbol", e.Symbol, "actor", a.actor.Subject, "err", err)
+	}
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"testing"
+
+	"cryptoserver/audit"
+	"cryptoserver/config"
+)
+
+func TestAuditedRecordsChanges(t *testing.T) {
+	log := audit.NewMemoryStore(100)
+	src := &scriptedSource{quotes: []Quote{{Price: 100}, {Price: 101}}}
+	tenants := NewTenants(func(tenant string) CryptoRepository {
+		return NewAudited(NewMemoryCryptoRepoWithConfig(config.Default().Repository, src), log, tenant)
+	})
+	ci := audit.Actor{Subject: "ci", Method: "api_key", RequestID: "req-1", Client: "10.0.0.1"}
+
+	repo := tenants.For("team-a").(ActorRepository)
+	if _, err := repo.As(ci).Create(" BTC "); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.RefreshPrice("btc"); err != nil {
+		t.Fatal(err)
+	}
+	notes := "cold storage"
+	if _, err := repo.As(ci).(MetadataEditor).UpdateMetadata("btc", MetadataPatch{Notes: &notes}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.As(ci).Create("btc"); err == nil {
+		t.Fatal("duplicate create succeeded")
+	}
+	if err := repo.As(ci).Delete("eth"); err == nil {
+		t.Fatal("deleting an untracked coin succeeded")
+	}
+	if err := repo.As(ci).Delete("btc"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := log.Find(audit.Query{Tenant: "team-a"})
+	if len(got) != 4 {
+		t.Fatalf("entries = %+v, want create, refresh, update and delete only", got)
+	}
+	create, refresh, update, del := got[0], got[1], got[2], got[3]
+	if create.Action != audit.ActionCreate || create.Symbol != "btc" || create.Actor != ci || create.PriceBefore != nil || *create.PriceAfter != 100 {
+		t.Errorf("create = %+v", create)
+	}
+	if refresh.Action != audit.ActionRefresh || refresh.Subject != audit.SystemActor || *refresh.PriceBefore != 100 || *refresh.PriceAfter != 101 {
+		t.Errorf("refresh = %+v, want it attributed to %q", refresh, audit.SystemActor)
+	}
+	if update.Action != audit.ActionUpdate || update.Actor != ci || update.PriceBefore != nil || update.PriceAfter != nil {
+		t.Errorf("update = %+v", update)
+	}
+	if del.Action != audit.ActionDelete || del.Actor != ci || *del.PriceBefore != 101 || del.PriceAfter != nil {
+		t.Errorf("delete = %+v", del)
+	}
+	if other, _ := log.Find(audit.Query{Tenant: config.DefaultTenant}); len(other) != 0 {
+		t.Errorf("default tenant entries = %+v, want none", other)
+	}
+}
+
+// staleReads answers Get with an outdated price, as a read racing a
+// concurrent refresh would.
+type staleReads struct{ *MemoryCryptoRepo }
+
+func (s staleReads) Get(symbol string) (Crypto, error) {
+	c, err := s.MemoryCryptoRepo.Get(symbol)
+	c.CurrentPrice = 1
+	return c, err
+}
+
+func TestAuditedPriceBeforeIsTheReplacedState(t *testing.T) {
+	log := audit.NewMemoryStore(100)
+	src := &scriptedSource{quotes: []Quote{{Price: 100}, {Price: 101}}}
+	repo := NewAudited(staleReads{NewMemoryCryptoRepoWithConfig(config.Default().Repository, src)}, log, config.DefaultTenant)
+	if _, err := repo.Create("btc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.RefreshPrice("btc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete("btc"); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := log.Find(audit.Query{Tenant: config.DefaultTenant})
+	if len(got) != 3 || *got[1].PriceBefore != 100 || *got[2].PriceBefore != 101 {
+		t.Fatalf("entries = %+v, want prices before taken under the repository's lock", got)
+	}
+}
@@ -0,0 +1,57 @@
+package repository
+
+// Precondition decides whether a conditional change may go ahead, given
+// the coin as it is right before the change.
+type Precondition func(Crypto) bool
+
+// ConditionalRepository is implemented by repositories that check a
+// Precondition under the same lock that applies the change, so a write
+// based on a stale read fails with ErrPreconditionFailed instead of
+// overwriting a newer state. A nil Precondition always holds.
+type ConditionalRepository interface {
+	DeleteIf(symbol string, ok Precondition) error
+	RefreshPriceIf(symbol string, ok Precondition) (Crypto, error)
+}
+
+// DeleteIf deletes symbol from repo if ok holds for it: atomically when
+// repo is a ConditionalRepository, else checked just before.
+func DeleteIf(repo CryptoRepository, symbol string, ok Precondition) error {
+	if cr, is := repo.(ConditionalRepository); is {
+		return cr.DeleteIf(symbol, ok)
+	}
+	if err := check(repo, symbol, ok); err != nil {
+		return err
+	}
+	return repo.Delete(symbol)
+}
+
+// RefreshPriceIf refreshes symbol's price in repo if ok holds for it,
+// like DeleteIf.
+func RefreshPriceIf(repo CryptoRepository, symbol string, ok Precondition) (Crypto, error) {
+	if cr, is := repo.(ConditionalRepository); is {
+		return cr.RefreshPriceIf(symbol, ok)
+	}
+	if err := check(repo, symbol, ok); err != nil {
+		return Crypto{}, err
+	}
+	return repo.RefreshPrice(symbol)
+}
+
+func check(repo CryptoRepository, symbol string, ok Precondition) error {
+	if ok == nil {
+		return nil
+	}
+	c, err := repo.Get(symbol)
+	if err != nil {
+		return err
+	}
+	if !ok(c) {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// holds reports whether ok holds for c.
+func (ok Precondition) holds(c Crypto) bool {
+	return ok == nil || ok(c.Copy())
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVersionsAndPreconditions(t *testing.T) {
+	eachBackend(t, func(t *testing.T, repo CryptoRepository) {
+		version := func(want int64) Crypto {
+			t.Helper()
+			c, err := repo.Get("btc")
+			if err != nil || c.Version != want {
+				t.Fatalf("version = %d, %v, want %d", c.Version, err, want)
+			}
+			return c
+		}
+		at := func(v int64) Precondition {
+			return func(c Crypto) bool { return c.Version == v }
+		}
+
+		if _, err := repo.Create("btc"); err != nil {
+			t.Fatal(err)
+		}
+		version(1)
+		if _, err := RefreshPriceIf(repo, "btc", at(1)); err != nil {
+			t.Fatal(err)
+		}
+		version(2)
+		if _, err := RefreshPriceIf(repo, "btc", at(1)); !errors.Is(err, ErrPreconditionFailed) {
+			t.Errorf("stale refresh: %v", err)
+		}
+		if err := DeleteIf(repo, "btc", at(1)); !errors.Is(err, ErrPreconditionFailed) {
+			t.Errorf("stale delete: %v", err)
+		}
+		version(2)
+		if err := DeleteIf(repo, "btc", at(2)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.(SoftDeleter).Restore("btc"); err != nil {
+			t.Fatal(err)
+		}
+		version(4)
+	})
+}
@@ -0,0 +1,597 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"cryptoserver/config"
+	"cryptoserver/gecko/geckoclient"
+)
+
+// Event types of the EventCryptoRepo log.
+const (
+	EventCoinCreated   = "coin_created"
+	EventPriceRecorded = "price_recorded"
+	// EventPriceRejected is a price kept out of history by the sanity
+	// checks; logging it lets the anomalies be replayed too.
+	EventPriceRejected = "price_rejected"
+	// EventCoinDeleted leaves a tombstone that EventCoinRestored clears
+	// and EventCoinPurged drops with the coin's history.
+	EventCoinDeleted  = "coin_deleted"
+	EventCoinRestored = "coin_restored"
+	EventCoinPurged   = "coin_purged"
+	// EventRefreshFailed is a refresh that got no price from upstream.
+	EventRefreshFailed = "refresh_failed"
+	// EventMetadataUpdated carries the coin's metadata after an edit.
+	EventMetadataUpdated = "metadata_updated"
+)
+
+// Event is one change of an EventCryptoRepo. Seq numbers the events of a
+// repository from 1 without gaps; Time never decreases along Seq.
+type Event struct {
+	Seq    int64     `json:"seq"`
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Symbol string    `json:"symbol"`
+	// Name is set on EventCoinCreated.
+	Name string `json:"name,omitempty"`
+	// Record is the price accepted by EventCoinCreated and
+	// EventPriceRecorded.
+	Record *PriceRecord `json:"record,omitempty"`
+	// Anomaly is set on EventPriceRejected, and on EventPriceRecorded for
+	// a flagged outlier.
+	Anomaly *Anomaly `json:"anomaly,omitempty"`
+	// NewLevel marks a price that confirmed a sustained move; later
+	// prices are checked against records from here on only.
+	NewLevel bool `json:"new_level,omitempty"`
+	// Error is why an EventRefreshFailed refresh failed.
+	Error string `json:"error,omitempty"`
+	// Metadata is set on EventMetadataUpdated.
+	Metadata *Metadata `json:"metadata,omitempty"`
+}
+
+// copy returns e with its own Record, Anomaly and Metadata.
+func (e Event) copy() Event {
+	if e.Metadata != nil {
+		m := e.Metadata.copy()
+		e.Metadata = &m
+	}
+	if e.Record != nil {
+		rec := *e.Record
+		e.Record = &rec
+	}
+	if e.Anomaly != nil {
+		a := *e.Anomaly
+		e.Anomaly = &a
+	}
+	return e
+}
+
+// EventLog is implemented by repositories whose state can be replayed.
+// Wrappers implement it too and return ErrNoEventLog when the repository
+// they wrap keeps no log.
+type EventLog interface {
+	// ListAt returns the coins as they were at t, tombstones included
+	// with DeletedAt set, or ErrEventsTrimmed when the events up to t are
+	// no longer retained.
+	ListAt(t time.Time) ([]Crypto, error)
+	// Events returns up to limit events with Seq greater than after,
+	// oldest first, or ErrEventsTrimmed when some of them are no longer
+	// retained.
+	Events(after int64, limit int) ([]Event, error)
+}
+
+// FromConfig builds the repository cfg.Storage names.
+func FromConfig(cfg config.RepositoryConfig, src PriceSource) CryptoRepository {
+	if cfg.Storage == config.StorageEvents {
+		return NewEventCryptoRepoWithConfig(cfg, src)
+	}
+	return NewMemoryCryptoRepoWithConfig(cfg, src)
+}
+
+// projection is the state a sequence of events folds into.
+type projection struct {
+	coins      map[string]Crypto
+	anomalies  map[string][]Anomaly
+	levelSince map[string]time.Time
+
+	historyLimit int
+	anomalyLimit int
+}
+
+func newProjection(historyLimit, anomalyLimit int) *projection {
+	return &projection{
+		coins:        make(map[string]Crypto),
+		anomalies:    make(map[string][]Anomaly),
+		levelSince:   make(map[string]time.Time),
+		historyLimit: historyLimit,
+		anomalyLimit: anomalyLimit,
+	}
+}
+
+func (p *projection) clone() *projection {
+	out := newProjection(p.historyLimit, p.anomalyLimit)
+	for sym, c := range p.coins {
+		out.coins[sym] = c.Copy()
+	}
+	for sym, list := range p.anomalies {
+		out.anomalies[sym] = slices.Clone(list)
+	}
+	for sym, t := range p.levelSince {
+		out.levelSince[sym] = t
+	}
+	return out
+}
+
+// apply folds e into p.
+func (p *projection) apply(e Event) {
+	switch e.Type {
+	case EventCoinCreated:
+		// A coin created anew replaces its tombstone.
+		p.drop(e.Symbol)
+		p.coins[e.Symbol] = Crypto{
+			Symbol:        e.Symbol,
+			Name:          e.Name,
+			CurrentPrice:  e.Record.Price,
+			LastUpdated:   e.Record.Timestamp,
+			Version:       1,
+			LastRefreshAt: e.Record.Timestamp,
+			History:       []PriceRecord{*e.Record},
+		}
+	case EventPriceRecorded:
+		c := p.coins[e.Symbol]
+		c.CurrentPrice = e.Record.Price
+		c.LastUpdated = e.Record.Timestamp
+		c.LastRefreshAt = e.Record.Timestamp
+		c.LastRefreshError = ""
+		c.Version++
+		c.History = append(c.History, *e.Record)
+		if len(c.History) > p.historyLimit {
+			c.History = slices.Clone(c.History[len(c.History)-p.historyLimit:])
+		}
+		p.coins[e.Symbol] = c
+		if e.Anomaly != nil {
+			p.addAnomaly(e.Symbol, *e.Anomaly)
+		}
+		if e.NewLevel {
+			p.levelSince[e.Symbol] = e.Time
+		}
+	case EventPriceRejected:
+		p.addAnomaly(e.Symbol, *e.Anomaly)
+		p.failRefresh(e, refreshFailure(rejected(e.Anomaly)))
+	case EventRefreshFailed:
+		p.failRefresh(e, e.Error)
+	case EventCoinDeleted:
+		c := p.coins[e.Symbol]
+		deletedAt := e.Time
+		c.DeletedAt = &deletedAt
+		c.Version++
+		p.coins[e.Symbol] = c
+	case EventCoinRestored:
+		c := p.coins[e.Symbol]
+		c.DeletedAt = nil
+		c.Version++
+		p.coins[e.Symbol] = c
+	case EventCoinPurged:
+		p.drop(e.Symbol)
+	case EventMetadataUpdated:
+		c := p.coins[e.Symbol]
+		c.Metadata = e.Metadata.copy()
+		c.Version++
+		p.coins[e.Symbol] = c
+	}
+}
+
+func (p *projection) failRefresh(e Event, reason string) {
+	c := p.coins[e.Symbol]
+	c.LastRefreshAt = e.Time
+	c.LastRefreshError = reason
+	c.Version++
+	p.coins[e.Symbol] = c
+}
+
+func (p *projection) drop(symbol string) {
+	delete(p.coins, symbol)
+	delete(p.anomalies, symbol)
+	delete(p.levelSince, symbol)
+}
+
+// live returns symbol's coin unless it is missing or deleted.
+func (p *projection) live(symbol string) (Crypto, bool) {
+	c, exists := p.coins[symbol]
+	return c, exists && c.DeletedAt == nil
+}
+
+// addAnomaly files a under symbol, keeping the newest anomalyLimit.
+func (p *projection) addAnomaly(symbol string, a Anomaly) {
+	list := append(p.anomalies[symbol], a)
+	if len(list) > p.anomalyLimit {
+		list = slices.Clone(list[len(list)-p.anomalyLimit:])
+	}
+	p.anomalies[symbol] = list
+}
+
+// list returns the live coins, or with deleted the tombstoned ones.
+func (p *projection) list(deleted bool) []Crypto {
+	out := []Crypto{}
+	for _, c := range p.coins {
+		if (c.DeletedAt != nil) == deleted {
+			out = append(out, c.Copy())
+		}
+	}
+	return out
+}
+
+// EventCryptoRepo is a CryptoRepository whose state is a projection of
+// an append-only event log. Every change is decided against the current
+// projection under one lock, appended and applied, so replaying the log
+// up to any point rebuilds the state the repository had then. It behaves
+// like MemoryCryptoRepo otherwise.
+type EventCryptoRepo struct {
+	mu sync.Mutex
+	// events is the retained log, oldest first. base is the fold of the
+	// events trimmed from its front, the last of which happened at
+	// trimmedAt; state is the fold of all events.
+	events    []Event
+	base      *projection
+	state     *projection
+	trimmedAt time.Time
+	seq       int64
+
+	src        PriceSource
+	eventLimit int
+	purgeAfter time.Duration
+	sanity     sanity
+}
+
+// NewEventCryptoRepo uses the default CoinGecko client and default limits.
+func NewEventCryptoRepo() *EventCryptoRepo {
+	return NewEventCryptoRepoWithConfig(config.Default().Repository, geckoclient.Default())
+}
+
+// NewEventCryptoRepoWithConfig builds a repository that fetches names and
+// prices from src, keeps cfg.HistoryLimit records per coin and the newest
+// cfg.EventLimit events, and checks prices as cfg.Sanity says.
+func NewEventCryptoRepoWithConfig(cfg config.RepositoryConfig, src PriceSource) *EventCryptoRepo {
+	return &EventCryptoRepo{
+		base:       newProjection(cfg.HistoryLimit, cfg.Sanity.AnomalyLimit),
+		state:      newProjection(cfg.HistoryLimit, cfg.Sanity.AnomalyLimit),
+		src:        src,
+		eventLimit: cfg.EventLimit,
+		purgeAfter: time.Duration(cfg.PurgeAfter),
+		sanity:     sanity{cfg: cfg.Sanity},
+	}
+}
+
+// append numbers e, logs it and applies it. Callers hold r.mu.
+func (r *EventCryptoRepo) append(e Event) {
+	r.seq++
+	e.Seq = r.seq
+	r.events = append(r.events, e)
+	r.state.apply(e)
+	for len(r.events) > r.eventLimit {
+		old := r.events[0]
+		r.base.apply(old)
+		r.trimmedAt = old.Time
+		r.events[0] = Event{}
+		r.events = r.events[1:]
+	}
+}
+
+func (r *EventCryptoRepo) Create(symbol string) (Crypto, error) {
+	symbol = strings.ToLower(strings.TrimSpace(symbol))
+	if symbol == "" {
+		return Crypto{}, ErrInvalidSymbol
+	}
+
+	r.mu.Lock()
+	_, live := r.state.live(symbol)
+	r.mu.Unlock()
+	if live {
+		return Crypto{}, ErrAlreadyExists
+	}
+
+	name, err := r.src.GetName(symbol)
+	if err != nil {
+		return Crypto{}, upstreamError(err, ErrInvalidSymbol)
+	}
+	q, err := fetchQuote(r.src, symbol)
+	if err != nil {
+		return Crypto{}, upstreamError(err, ErrPriceUnavailable)
+	}
+	if a := r.sanity.check(q, nil); a != nil {
+		return Crypto{}, rejected(a)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, live := r.state.live(symbol); live {
+		return Crypto{}, ErrAlreadyExists
+	}
+	// Timestamps are taken under the lock so that Time follows Seq.
+	now := time.Now()
+	rec := PriceRecord{Price: q.Price, Timestamp: now, Cached: q.Cached, Stale: q.Stale, Provider: q.Provider}
+	r.append(Event{Type: EventCoinCreated, Time: now, Symbol: symbol, Name: name, Record: &rec})
+	return r.state.coins[symbol].Copy(), nil
+}
+
+func (r *EventCryptoRepo) Get(symbol string) (Crypto, error) {
+	symbol = strings.ToLower(strings.TrimSpace(symbol))
+	if symbol == "" {
+		return Crypto{}, ErrInvalidSymbol
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, live := r.state.live(symbol); live {
+		return c.Copy(), nil
+	}
+	return Crypto{}, ErrNotFound
+}
+
+func (r *EventCryptoRepo) List() ([]Crypto, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state.list(false), nil
+}
+
+// Find copies only the coins that match q.
+func (r *EventCryptoRepo) Find(q ListQuery) (Page, error) {
+	r.mu.Lock()
+	var items []Crypto
+	for _, c := range r.state.coins {
+		if q.matches(c) {
+			items = append(items, c.Copy())
+		}
+	}
+	r.mu.Unlock()
+	return q.page(items)
+}
+
+func (r *EventCryptoRepo) Delete(symbol string) error {
+	return r.DeleteIf(symbol, nil)
+}
+
+func (r *EventCryptoRepo) DeleteIf(symbol string, ok Precondition) error {
+	symbol = strings.ToLower(strings.TrimSpace(symbol))
+	if symbol == "" {
+		return ErrInvalidSymbol
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, live := r.state.live(symbol)
+	if !live {
+		return ErrNotFound
+	}
+	if !ok.holds(c) {
+		return ErrPreconditionFailed
+	}
+	now := time.Now()
+	r.append(Event{Type: EventCoinDeleted, Time: now, Symbol: symbol})
+	if r.purgeAfter == 0 {
+		r.append(Event{Type: EventCoinPurged, Time: now, Symbol: symbol})
+	}
+	return nil
+}
+
+func (r *EventCryptoRepo) Restore(symbol string) (Crypto, error) {
+	symbol = strings.ToLower(strings.TrimSpace(symbol))
+	if symbol == "" {
+		return Crypto{}, ErrInvalidSymbol
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, exists := r.state.coins[symbol]
+	switch {
+	case !exists:
+		return Crypto{}, ErrNotFound
+	case c.DeletedAt == nil:
+		return Crypto{}, ErrNotDeleted
+	}
+	r.append(Event{Type: EventCoinRestored, Time: time.Now(), Symbol: symbol})
+	return r.state.coins[symbol].Copy(), nil
+}
+
+func (r *EventCryptoRepo) UpdateMetadata(symbol string, p MetadataPatch, ok Precondition) (Crypto, error) {
+	symbol = strings.ToLower(strings.TrimSpace(symbol))
+	if symbol == "" {
+		return Crypto{}, ErrInvalidSymbol
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, live := r.state.live(symbol)
+	if !live {
+		return Crypto{}, ErrNotFound
+	}
+	if !ok.holds(c) {
+		return Crypto{}, ErrPreconditionFailed
+	}
+	m, err := p.apply(c.Metadata)
+	if err != nil {
+		return Crypto{}, err
+	}
+	now := time.Now()
+	m.MetadataUpdatedAt = &now
+	r.append(Event{Type: EventMetadataUpdated, Time: now, Symbol: symbol, Metadata: &m})
+	return r.state.coins[symbol].Copy(), nil
+}
+
+func (r *EventCryptoRepo) ListDeleted() ([]Crypto, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state.list(true), nil
+}
+
+// PurgeExpired stamps its coin_purged events with now, the time the
+// purge was decided at, so replay sees the same decision.
+func (r *EventCryptoRepo) PurgeExpired(now time.Time) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var purged []string
+	for symbol, c := range r.state.coins {
+		if c.DeletedAt != nil && now.Sub(*c.DeletedAt) >= r.purgeAfter {
+			purged = append(purged, symbol)
+		}
+	}
+	// Sorted so that the log does not depend on map order.
+	slices.Sort(purged)
+	for _, symbol := range purged {
+		r.append(Event{Type: EventCoinPurged, Time: now, Symbol: symbol})
+	}
+	return purged
+}
+
+func (r *EventCryptoRepo) RefreshPrice(symbol string) (Crypto, error) {
+	return r.RefreshPriceIf(symbol, nil)
+}
+
+// RefreshPriceIf checks ok before fetching and again before recording
+// the price.
+func (r *EventCryptoRepo) RefreshPriceIf(symbol string, ok Precondition) (Crypto, error) {
+	symbol = strings.ToLower(strings.TrimSpace(symbol))
+	if symbol == "" {
+		return Crypto{}, ErrInvalidSymbol
+	}
+
+	r.mu.Lock()
+	c, live := r.state.live(symbol)
+	held := live && ok.holds(c)
+	r.mu.Unlock()
+	if !live {
+		return Crypto{}, ErrNotFound
+	}
+	if !held {
+		return Crypto{}, ErrPreconditionFailed
+	}
+	q, err := fetchQuote(r.src, symbol)
+	if err != nil {
+		err = upstreamError(err, ErrPriceUnavailable)
+		r.mu.Lock()
+		if _, live := r.state.live(symbol); live {
+			r.append(Event{Type: EventRefreshFailed, Time: time.Now(), Symbol: symbol, Error: refreshFailure(err)})
+		}
+		r.mu.Unlock()
+		return Crypto{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, live = r.state.live(symbol)
+	if !live {
+		return Crypto{}, ErrNotFound
+	}
+	if !ok.holds(c) {
+		return Crypto{}, ErrPreconditionFailed
+	}
+	now := time.Now()
+	rec := PriceRecord{Price: q.Price, Timestamp: now, Cached: q.Cached, Stale: q.Stale, Provider: q.Provider}
+	e := Event{Type: EventPriceRecorded, Time: now, Symbol: symbol, Record: &rec}
+	if a := r.sanity.check(q, recordsSince(c.History, r.state.levelSince[symbol])); a != nil {
+		a.Timestamp = now
+		switch {
+		case !a.Quarantined:
+			rec.Outlier = true
+			e.Anomaly = a
+		case r.sanity.confirmed(a, r.state.anomalies[symbol], c.LastUpdated):
+			e.NewLevel = true
+		default:
+			r.append(Event{Type: EventPriceRejected, Time: now, Symbol: symbol, Anomaly: a})
+			return Crypto{}, rejected(a)
+		}
+	}
+	r.append(e)
+	return r.state.coins[symbol].Copy(), nil
+}
+
+func (r *EventCryptoRepo) History(symbol string) ([]PriceRecord, error) {
+	c, err := r.Get(symbol)
+	if err != nil {
+		return nil, err
+	}
+	return c.History, nil
+}
+
+func (r *EventCryptoRepo) Stats(symbol string) (PriceStats, error) {
+	c, err := r.Get(symbol)
+	if err != nil {
+		return PriceStats{}, err
+	}
+	return statsOf(c.History), nil
+}
+
+func (r *EventCryptoRepo) Anomalies(symbol string) ([]Anomaly, error) {
+	symbol = strings.ToLower(strings.TrimSpace(symbol))
+	if symbol == "" {
+		return nil, ErrInvalidSymbol
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, live := r.state.live(symbol); !live {
+		return nil, ErrNotFound
+	}
+	return append([]Anomaly{}, r.state.anomalies[symbol]...), nil
+}
+
+// ListAt replays the retained events up to and including t. The replay
+// runs on copies, so writers are only held up while they are taken.
+func (r *EventCryptoRepo) ListAt(t time.Time) ([]Crypto, error) {
+	r.mu.Lock()
+	if t.Before(r.trimmedAt) {
+		trimmedAt := r.trimmedAt
+		r.mu.Unlock()
+		return nil, fmt.Errorf("%w: state before %s is not retained", ErrEventsTrimmed, trimmedAt.Format(time.RFC3339Nano))
+	}
+	if n := len(r.events); n == 0 || !t.Before(r.events[n-1].Time) {
+		defer r.mu.Unlock()
+		return append(r.state.list(false), r.state.list(true)...), nil
+	}
+	p := r.base.clone()
+	events := slices.Clone(r.events)
+	r.mu.Unlock()
+
+	for _, e := range events {
+		if e.Time.After(t) {
+			break
+		}
+		p.apply(e)
+	}
+	return append(p.list(false), p.list(true)...), nil
+}
+
+func (r *EventCryptoRepo) Events(after int64, limit int) ([]Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// first is the Seq of r.events[0].
+	first := r.seq - int64(len(r.events)) + 1
+	if after < first-1 {
+		return nil, fmt.Errorf("%w: events after %d are retained, not after %d", ErrEventsTrimmed, first-1, after)
+	}
+	from := int(after - first + 1)
+	out := []Event{}
+	for _, e := range r.events[min(from, len(r.events)):] {
+		if len(out) == limit {
+			break
+		}
+		out = append(out, e.copy())
+	}
+	return out, nil
+}
+
+// CheckHealth reports whether the store can take writes; taking the lock
+// catches a wedged repository.
+func (r *EventCryptoRepo) CheckHealth() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state == nil {
+		return errors.New("event store not initialized")
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"cryptoserver/config"
+)
+
+func newEventRepo(eventLimit int, prices ...float64) *EventCryptoRepo {
+	src := &scriptedSource{}
+	for _, p := range prices {
+		src.quotes = append(src.quotes, Quote{Price: p, Provider: "test"})
+	}
+	cfg := config.Default().Repository
+	cfg.EventLimit = eventLimit
+	return NewEventCryptoRepoWithConfig(cfg, src)
+}
+
+// symbols lists the symbols of list, tombstones marked with a "-".
+func symbols(list []Crypto) []string {
+	out := []string{}
+	for _, c := range list {
+		if c.DeletedAt != nil {
+			c.Symbol = "-" + c.Symbol
+		}
+		out = append(out, c.Symbol)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// tick waits until time.Now has moved past the last event.
+func tick() time.Time {
+	time.Sleep(time.Millisecond)
+	t := time.Now()
+	time.Sleep(time.Millisecond)
+	return t
+}
+
+func TestEventRepoListAt(t *testing.T) {
+	repo := newEventRepo(100, 100, 101, 100_000, 102)
+	before := tick()
+	if _, err := repo.Create("btc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Create("eth"); err != nil {
+		t.Fatal(err)
+	}
+	created := tick()
+	if _, err := repo.RefreshPrice("btc"); !errors.Is(err, ErrPriceRejected) {
+		t.Fatalf("spike error = %v, want ErrPriceRejected", err)
+	}
+	if err := repo.Delete("eth"); err != nil {
+		t.Fatal(err)
+	}
+	deleted := tick()
+	if _, err := repo.RefreshPrice("btc"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		at   time.Time
+		want []string
+	}{
+		{"before", before, []string{}},
+		{"created", created, []string{"btc", "eth"}},
+		{"deleted", deleted, []string{"-eth", "btc"}},
+	} {
+		got, err := repo.ListAt(tc.at)
+		if err != nil || !slices.Equal(symbols(got), tc.want) {
+			t.Errorf("%s: ListAt = %v, %v; want %v", tc.name, symbols(got), err, tc.want)
+		}
+	}
+	then, _ := repo.ListAt(deleted)
+	for _, c := range then {
+		if c.Symbol == "btc" && (c.CurrentPrice != 100 || len(c.History) != 1) {
+			t.Errorf("btc before the last refresh = %+v", c)
+		}
+	}
+	if now, _ := repo.Get("btc"); now.CurrentPrice != 102 || len(now.History) != 2 {
+		t.Errorf("btc now = %+v", now)
+	}
+
+	// The quarantined spike is logged, so anomalies replay too.
+	events, _ := repo.Events(0, 100)
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	want := []string{EventCoinCreated, EventCoinCreated, EventPriceRejected, EventCoinDeleted, EventPriceRecorded}
+	if !slices.Equal(types, want) {
+		t.Fatalf("event types = %v, want %v", types, want)
+	}
+	if a := events[2].Anomaly; a == nil || a.Price != 100_000 {
+		t.Errorf("rejected event anomaly = %+v", a)
+	}
+	if got, _ := repo.Anomalies("btc"); len(got) != 1 {
+		t.Errorf("anomalies = %+v, want the spike", got)
+	}
+}
+
+func TestEventRepoTrimsLog(t *testing.T) {
+	repo := newEventRepo(2, 100)
+	for _, sym := range []string{"btc", "eth"} {
+		if _, err := repo.Create(sym); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mid := tick()
+	if err := repo.Delete("btc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Create("sol"); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := repo.Events(2, 10)
+	if err != nil || len(events) != 2 || events[0].Seq != 3 || events[1].Seq != 4 {
+		t.Fatalf("retained events = %+v, %v", events, err)
+	}
+	if _, err := repo.Events(1, 10); !errors.Is(err, ErrEventsTrimmed) {
+		t.Errorf("events after a trimmed one: error = %v, want ErrEventsTrimmed", err)
+	}
+	if got, err := repo.ListAt(mid); err != nil || !slices.Equal(symbols(got), []string{"btc", "eth"}) {
+		t.Errorf("ListAt from the trimmed base = %v, %v", symbols(got), err)
+	}
+	if _, err := repo.ListAt(mid.Add(-time.Hour)); !errors.Is(err, ErrEventsTrimmed) {
+		t.Errorf("ListAt before the retained log: error = %v, want ErrEventsTrimmed", err)
+	}
+	events[1].Record.Price = -1
+	if again, _ := repo.Events(3, 1); again[0].Record.Price != 100 {
+		t.Errorf("Events shares its log with callers: %+v", again[0].Record)
+	}
+}
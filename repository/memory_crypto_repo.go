@@ -3,6 +3,7 @@ package repository
 import (
     "errors"
     "fmt"
+    "cryptoserver/config"
     "cryptoserver/gecko/geckoclient"
     "slices"
     "strings"
@@ -12,16 +13,55 @@ import (
 
 // MemoryCryptoRepo хранит криптовалюты в памяти.
 type MemoryCryptoRepo struct {
+	// data holds live coins and, with DeletedAt set, tombstones.
 	data map[string]Crypto
-	mu   sync.Mutex
+	// anomalies holds prices that failed sanity checks, per symbol.
+	anomalies map[string][]Anomaly
+	// levelSince is when a coin's price last confirmedly moved to a new
+	// level; older records are not used as a sanity reference.
+	levelSince map[string]time.Time
+	mu        sync.Mutex
+
+	src          PriceSource
+	historyLimit int
+	purgeAfter   time.Duration
+	sanity       sanity
 }
 
+// NewMemoryCryptoRepo uses the default CoinGecko client and default limits.
 func NewMemoryCryptoRepo() *MemoryCryptoRepo {
+	return NewMemoryCryptoRepoWithConfig(config.Default().Repository, geckoclient.Default())
+}
+
+// NewMemoryCryptoRepoWithConfig builds a repository that fetches names and
+// prices from src, keeps cfg.HistoryLimit records per coin and checks
+// prices as cfg.Sanity says.
+func NewMemoryCryptoRepoWithConfig(cfg config.RepositoryConfig, src PriceSource) *MemoryCryptoRepo {
 	return &MemoryCryptoRepo{
-		data: make(map[string]Crypto),
+		data:         make(map[string]Crypto),
+		anomalies:    make(map[string][]Anomaly),
+		levelSince:   make(map[string]time.Time),
+		src:          src,
+		historyLimit: cfg.HistoryLimit,
+		purgeAfter:   time.Duration(cfg.PurgeAfter),
+		sanity:       sanity{cfg: cfg.Sanity},
 	}
 }
 
+// live returns symbol's coin unless it is missing or deleted. Callers
+// hold r.mu.
+func (r *MemoryCryptoRepo) live(symbol string) (Crypto, bool) {
+	c, exists := r.data[symbol]
+	return c, exists && c.DeletedAt == nil
+}
+
+// drop forgets symbol entirely. Callers hold r.mu.
+func (r *MemoryCryptoRepo) drop(symbol string) {
+	delete(r.data, symbol)
+	delete(r.anomalies, symbol)
+	delete(r.levelSince, symbol)
+}
+
 func (r *MemoryCryptoRepo) Create(symbol string) (Crypto, error) {
     symbol = strings.ToLower(strings.TrimSpace(symbol))
     if symbol == "" {
@@ -29,68 +69,107 @@ func (r *MemoryCryptoRepo) Create(symbol string) (Crypto, error) {
     }
 
 	r.mu.Lock()
-	if _, exists := r.data[symbol]; exists {
+	if _, live := r.live(symbol); live {
 		r.mu.Unlock()
 		return Crypto{}, ErrAlreadyExists
 	}
 	r.mu.Unlock()
 
-    name, err := geckoclient.GetName(symbol)
+    name, err := r.src.GetName(symbol)
     if err != nil {
-        switch {
-        case errors.Is(err, geckoclient.ErrNotFound):
-            return Crypto{}, fmt.Errorf("%w: %v", ErrInvalidSymbol, err)
-        case errors.Is(err, geckoclient.ErrServiceUnavailable), errors.Is(err, geckoclient.ErrBadResponse):
-            return Crypto{}, fmt.Errorf("%w: %v", ErrServiceUnavailable, err)
-        default:
-            return Crypto{}, fmt.Errorf("%w: %v", ErrServiceUnavailable, err)
-        }
-    }
-    price, err := geckoclient.GetPrice(symbol)
+        return Crypto{}, upstreamError(err, ErrInvalidSymbol)
+    }
+    q, err := r.fetchPrice(symbol)
     if err != nil {
-        switch {
-        case errors.Is(err, geckoclient.ErrNotFound):
-            return Crypto{}, fmt.Errorf("%w: %v", ErrPriceUnavailable, err)
-        case errors.Is(err, geckoclient.ErrServiceUnavailable), errors.Is(err, geckoclient.ErrBadResponse):
-            return Crypto{}, fmt.Errorf("%w: %v", ErrServiceUnavailable, err)
-        default:
-            return Crypto{}, fmt.Errorf("%w: %v", ErrServiceUnavailable, err)
-        }
+        return Crypto{}, upstreamError(err, ErrPriceUnavailable)
     }
+	// There is no history to compare with yet, so only a malformed price
+	// can fail here; with no coin to file it under, it is not kept.
+	if a := r.sanity.check(q, nil); a != nil {
+		return Crypto{}, rejected(a)
+	}
 
 	now := time.Now()
 
 	c := Crypto{
-		Symbol:       symbol,
-		Name:         name,
-		CurrentPrice: price,
-		LastUpdated:  now,
+		Symbol:        symbol,
+		Name:          name,
+		CurrentPrice:  q.Price,
+		LastUpdated:   now,
+		Version:       1,
+		LastRefreshAt: now,
 		History: []PriceRecord{
-			{Price: price, Timestamp: now},
+			{Price: q.Price, Timestamp: now, Cached: q.Cached, Stale: q.Stale, Provider: q.Provider},
 		},
 	}
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if _, exists := r.data[symbol]; exists {
+	if _, live := r.live(symbol); live {
 		return Crypto{}, ErrAlreadyExists
 	}
 
+	// Creating a deleted coin anew replaces its tombstone.
+	r.drop(symbol)
 	r.data[symbol] = c
 	return c.Copy(), nil
 }
 
+// upstreamError maps a PriceSource error onto the repository sentinels;
+// notFound is used when the upstream does not know the symbol. Other
+// causes stay wrapped so callers can still read e.g. a Retry-After hint.
+func upstreamError(err, notFound error) error {
+	switch {
+	case errors.Is(err, geckoclient.ErrNotFound):
+		return fmt.Errorf("%w: %v", notFound, err)
+	case errors.Is(err, geckoclient.ErrRateLimited):
+		return fmt.Errorf("%w: %w", ErrRateLimited, err)
+	default:
+		return fmt.Errorf("%w: %w", ErrServiceUnavailable, err)
+	}
+}
+
+func (r *MemoryCryptoRepo) fetchPrice(symbol string) (Quote, error) {
+	return fetchQuote(r.src, symbol)
+}
+
+// fetchQuote asks src for a price, keeping cache provenance when src
+// reports it.
+func fetchQuote(src PriceSource, symbol string) (Quote, error) {
+	if qs, ok := src.(QuoteSource); ok {
+		return qs.GetQuote(symbol)
+	}
+	price, err := src.GetPrice(symbol)
+	return Quote{Price: price}, err
+}
+
 func (r *MemoryCryptoRepo) List() ([]Crypto, error) {
 	r.mu.Lock()
 	result := make([]Crypto, 0, len(r.data))
 	for _, c := range r.data {
-		result = append(result, c.Copy())
+		if c.DeletedAt == nil {
+			result = append(result, c.Copy())
+		}
 	}
 	r.mu.Unlock()
 
 	return result, nil
 }
 
+// Find copies only the coins that match q.
+func (r *MemoryCryptoRepo) Find(q ListQuery) (Page, error) {
+	r.mu.Lock()
+	var items []Crypto
+	for _, c := range r.data {
+		if q.matches(c) {
+			items = append(items, c.Copy())
+		}
+	}
+	r.mu.Unlock()
+
+	return q.page(items)
+}
+
 func (r *MemoryCryptoRepo) Get(symbol string) (Crypto, error) {
     symbol = strings.ToLower(strings.TrimSpace(symbol))
     if symbol == "" {
@@ -100,13 +179,17 @@ func (r *MemoryCryptoRepo) Get(symbol string) (Crypto, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if c, exists := r.data[symbol]; exists {
+	if c, live := r.live(symbol); live {
 		return c.Copy(), nil
 	}
 	return Crypto{}, ErrNotFound
 }
 
 func (r *MemoryCryptoRepo) Delete(symbol string) error {
+	return r.DeleteIf(symbol, nil)
+}
+
+func (r *MemoryCryptoRepo) DeleteIf(symbol string, ok Precondition) error {
     symbol = strings.ToLower(strings.TrimSpace(symbol))
     if symbol == "" {
         return ErrInvalidSymbol
@@ -115,53 +198,208 @@ func (r *MemoryCryptoRepo) Delete(symbol string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, exists := r.data[symbol]; !exists {
+	c, live := r.live(symbol)
+	if !live {
 		return ErrNotFound
 	}
-	delete(r.data, symbol)
+	if !ok.holds(c) {
+		return ErrPreconditionFailed
+	}
+	if r.purgeAfter == 0 {
+		r.drop(symbol)
+		return nil
+	}
+	now := time.Now()
+	c.DeletedAt = &now
+	c.Version++
+	r.data[symbol] = c
 	return nil
 }
 
+// Restore clears the tombstone of a deleted coin; its history and
+// anomalies are as they were at deletion.
+func (r *MemoryCryptoRepo) Restore(symbol string) (Crypto, error) {
+    symbol = strings.ToLower(strings.TrimSpace(symbol))
+    if symbol == "" {
+        return Crypto{}, ErrInvalidSymbol
+    }
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, exists := r.data[symbol]
+	switch {
+	case !exists:
+		return Crypto{}, ErrNotFound
+	case c.DeletedAt == nil:
+		return Crypto{}, ErrNotDeleted
+	}
+	c.DeletedAt = nil
+	c.Version++
+	r.data[symbol] = c
+	return c.Copy(), nil
+}
+
+func (r *MemoryCryptoRepo) UpdateMetadata(symbol string, p MetadataPatch, ok Precondition) (Crypto, error) {
+    symbol = strings.ToLower(strings.TrimSpace(symbol))
+    if symbol == "" {
+        return Crypto{}, ErrInvalidSymbol
+    }
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, live := r.live(symbol)
+	if !live {
+		return Crypto{}, ErrNotFound
+	}
+	if !ok.holds(c) {
+		return Crypto{}, ErrPreconditionFailed
+	}
+	m, err := p.apply(c.Metadata)
+	if err != nil {
+		return Crypto{}, err
+	}
+	now := time.Now()
+	m.MetadataUpdatedAt = &now
+	c.Metadata = m
+	c.Version++
+	r.data[symbol] = c
+	return c.Copy(), nil
+}
+
+func (r *MemoryCryptoRepo) ListDeleted() ([]Crypto, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := []Crypto{}
+	for _, c := range r.data {
+		if c.DeletedAt != nil {
+			result = append(result, c.Copy())
+		}
+	}
+	return result, nil
+}
+
+func (r *MemoryCryptoRepo) PurgeExpired(now time.Time) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var purged []string
+	for symbol, c := range r.data {
+		if c.DeletedAt != nil && now.Sub(*c.DeletedAt) >= r.purgeAfter {
+			r.drop(symbol)
+			purged = append(purged, symbol)
+		}
+	}
+	return purged
+}
+
+// addAnomaly files a under symbol, keeping the newest AnomalyLimit.
+// Callers hold r.mu.
+func (r *MemoryCryptoRepo) addAnomaly(symbol string, a Anomaly) {
+	list := append(r.anomalies[symbol], a)
+	if limit := r.sanity.cfg.AnomalyLimit; len(list) > limit {
+		list = slices.Clone(list[len(list)-limit:])
+	}
+	r.anomalies[symbol] = list
+}
+
+// rejected is the error for a price that failed a sanity check.
+func rejected(a *Anomaly) error {
+	if a.Reason == ReasonDeviation {
+		return fmt.Errorf("%w: %s: %g is %.0f%% away from recent median %g", ErrPriceRejected, a.Reason, a.Price, a.Deviation*100, a.Reference)
+	}
+	if a.Raw != "" {
+		return fmt.Errorf("%w: %s: %s", ErrPriceRejected, a.Reason, a.Raw)
+	}
+	return fmt.Errorf("%w: %s: %g", ErrPriceRejected, a.Reason, a.Price)
+}
+
+func (r *MemoryCryptoRepo) Anomalies(symbol string) ([]Anomaly, error) {
+    symbol = strings.ToLower(strings.TrimSpace(symbol))
+    if symbol == "" {
+        return nil, ErrInvalidSymbol
+    }
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, live := r.live(symbol); !live {
+		return nil, ErrNotFound
+	}
+	return append([]Anomaly{}, r.anomalies[symbol]...), nil
+}
+
 func (r *MemoryCryptoRepo) RefreshPrice(symbol string) (Crypto, error) {
+	return r.RefreshPriceIf(symbol, nil)
+}
+
+// RefreshPriceIf checks ok before fetching, to spare the upstream a
+// doomed request, and again before recording the price.
+func (r *MemoryCryptoRepo) RefreshPriceIf(symbol string, ok Precondition) (Crypto, error) {
     symbol = strings.ToLower(strings.TrimSpace(symbol))
     if symbol == "" {
         return Crypto{}, ErrInvalidSymbol
     }
 
 	r.mu.Lock()
-	_, exists := r.data[symbol]
+	c, live := r.live(symbol)
+	held := live && ok.holds(c)
 	r.mu.Unlock()
 
-	if !exists {
+	if !live {
 		return Crypto{}, ErrNotFound
 	}
-    price, err := geckoclient.GetPrice(symbol)
+	if !held {
+		return Crypto{}, ErrPreconditionFailed
+	}
+    q, err := r.fetchPrice(symbol)
     if err != nil {
-        switch {
-        case errors.Is(err, geckoclient.ErrNotFound):
-            return Crypto{}, fmt.Errorf("%w: %v", ErrPriceUnavailable, err)
-        case errors.Is(err, geckoclient.ErrServiceUnavailable), errors.Is(err, geckoclient.ErrBadResponse):
-            return Crypto{}, fmt.Errorf("%w: %v", ErrServiceUnavailable, err)
-        default:
-            return Crypto{}, fmt.Errorf("%w: %v", ErrServiceUnavailable, err)
-        }
+        err = upstreamError(err, ErrPriceUnavailable)
+        r.mu.Lock()
+        r.failRefresh(symbol, err, time.Now())
+        r.mu.Unlock()
+        return Crypto{}, err
     }
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	now := time.Now()
 
-    c, exists := r.data[symbol]
-    if !exists {
+    c, live = r.live(symbol)
+    if !live {
         return Crypto{}, ErrNotFound
     }
+	if !ok.holds(c) {
+		return Crypto{}, ErrPreconditionFailed
+	}
+
+	rec := PriceRecord{Price: q.Price, Timestamp: now, Cached: q.Cached, Stale: q.Stale, Provider: q.Provider}
+	if a := r.sanity.check(q, recordsSince(c.History, r.levelSince[symbol])); a != nil {
+		a.Timestamp = now
+		switch {
+		case !a.Quarantined:
+			rec.Outlier = true
+			r.addAnomaly(symbol, *a)
+		case r.sanity.confirmed(a, r.anomalies[symbol], c.LastUpdated):
+			// The move held up; record it as a normal price and compare
+			// later ones with the new level only.
+			r.levelSince[symbol] = now
+		default:
+			r.addAnomaly(symbol, *a)
+			r.failRefresh(symbol, rejected(a), now)
+			return Crypto{}, rejected(a)
+		}
+	}
 
-	c.CurrentPrice = price
+	c.CurrentPrice = q.Price
 	c.LastUpdated = now
+	c.LastRefreshAt = now
+	c.LastRefreshError = ""
+	c.Version++
 
-	c.History = append(c.History, PriceRecord{Price: price, Timestamp: now})
-	if len(c.History) > 100 {
-		c.History = c.History[len(c.History)-100:]
+	c.History = append(c.History, rec)
+	if len(c.History) > r.historyLimit {
+		c.History = c.History[len(c.History)-r.historyLimit:]
 		c.History = slices.Clone(c.History)
 	}
 	r.data[symbol] = c
@@ -169,6 +407,19 @@ func (r *MemoryCryptoRepo) RefreshPrice(symbol string) (Crypto, error) {
 	return c.Copy(), nil
 }
 
+// failRefresh records on symbol's coin, if it is still live, that a
+// refresh failed with err. Callers hold r.mu.
+func (r *MemoryCryptoRepo) failRefresh(symbol string, err error, now time.Time) {
+	c, live := r.live(symbol)
+	if !live {
+		return
+	}
+	c.LastRefreshAt = now
+	c.LastRefreshError = refreshFailure(err)
+	c.Version++
+	r.data[symbol] = c
+}
+
 func (r *MemoryCryptoRepo) History(symbol string) ([]PriceRecord, error) {
     symbol = strings.ToLower(strings.TrimSpace(symbol))
     if symbol == "" {
@@ -178,8 +429,8 @@ func (r *MemoryCryptoRepo) History(symbol string) ([]PriceRecord, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-    c, exists := r.data[symbol]
-    if !exists {
+    c, live := r.live(symbol)
+    if !live {
         return nil, ErrNotFound
     }
 
@@ -193,17 +444,21 @@ func (r *MemoryCryptoRepo) Stats(symbol string) (PriceStats, error) {
     }
 
 	r.mu.Lock()
-    c, exists := r.data[symbol]
-    if !exists {
+    c, live := r.live(symbol)
+    if !live {
         r.mu.Unlock()
         return PriceStats{}, ErrNotFound
     }
 	c = c.Copy()
 	r.mu.Unlock()
 
-	h := c.History
+	return statsOf(c.History), nil
+}
+
+// statsOf computes the statistics of history h.
+func statsOf(h []PriceRecord) PriceStats {
 	if len(h) == 0 {
-		return PriceStats{}, nil
+		return PriceStats{}
 	}
 
 	minP, maxP := h[0].Price, h[0].Price
@@ -229,5 +484,16 @@ func (r *MemoryCryptoRepo) Stats(symbol string) (PriceStats, error) {
         PriceChange:    change,
         PriceChangePct: pct,
         RecordsCount:   len(h),
-    }, nil
+    }
+}
+
+// CheckHealth reports whether the store can take writes. Memory is always
+// writable; taking the lock catches a wedged repository.
+func (r *MemoryCryptoRepo) CheckHealth() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.data == nil {
+		return errors.New("memory store not initialized")
+	}
+	return nil
 }
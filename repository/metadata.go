@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits of user-defined metadata.
+const (
+	MaxTags           = 16
+	MaxDisplayNameLen = 100
+	MaxNotesLen       = 2000
+)
+
+// tagPattern is what a normalized tag looks like: lowercase letters,
+// digits, '-' and '_', at most 32 long.
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// Metadata is what users annotate a coin with; the upstream never sets
+// it. A coin created anew after deletion starts without it.
+type Metadata struct {
+	// DisplayName is shown instead of Name when set.
+	DisplayName string `json:"display_name,omitempty"`
+	// Tags are normalized: lowercase, unique and sorted.
+	Tags  []string `json:"tags,omitempty"`
+	Notes string   `json:"notes,omitempty"`
+	// RefreshPolicy drives the automatic refresher (see Tenants.RefreshDue).
+	RefreshPolicy RefreshPolicy `json:"refresh_policy"`
+	// MetadataUpdatedAt is when the metadata was last edited.
+	MetadataUpdatedAt *time.Time `json:"metadata_updated_at,omitempty"`
+}
+
+func (m Metadata) copy() Metadata {
+	m.Tags = slices.Clone(m.Tags)
+	m.RefreshPolicy = m.RefreshPolicy.copy()
+	if m.MetadataUpdatedAt != nil {
+		t := *m.MetadataUpdatedAt
+		m.MetadataUpdatedAt = &t
+	}
+	return m
+}
+
+// HasTags reports whether m carries every tag of tags, which must be
+// normalized.
+func (m Metadata) HasTags(tags []string) bool {
+	for _, tag := range tags {
+		if _, found := slices.BinarySearch(m.Tags, tag); !found {
+			return false
+		}
+	}
+	return true
+}
+
+// MetadataPatch changes the metadata fields that are set; an empty
+// string or list clears one. RefreshPolicy replaces the whole policy.
+type MetadataPatch struct {
+	DisplayName   *string
+	Tags          *[]string
+	Notes         *string
+	RefreshPolicy *RefreshPolicy
+}
+
+// apply returns m with p applied, or an error wrapping
+// ErrInvalidMetadata that says which field is wrong.
+func (p MetadataPatch) apply(m Metadata) (Metadata, error) {
+	m = m.copy()
+	if p.DisplayName != nil {
+		name := strings.TrimSpace(*p.DisplayName)
+		if utf8.RuneCountInString(name) > MaxDisplayNameLen {
+			return Metadata{}, fmt.Errorf("%w: display_name is longer than %d characters", ErrInvalidMetadata, MaxDisplayNameLen)
+		}
+		m.DisplayName = name
+	}
+	if p.Notes != nil {
+		if utf8.RuneCountInString(*p.Notes) > MaxNotesLen {
+			return Metadata{}, fmt.Errorf("%w: notes are longer than %d characters", ErrInvalidMetadata, MaxNotesLen)
+		}
+		m.Notes = *p.Notes
+	}
+	if p.Tags != nil {
+		tags, err := NormalizeTags(*p.Tags)
+		if err != nil {
+			return Metadata{}, err
+		}
+		if len(tags) > MaxTags {
+			return Metadata{}, fmt.Errorf("%w: more than %d tags", ErrInvalidMetadata, MaxTags)
+		}
+		m.Tags = tags
+	}
+	if p.RefreshPolicy != nil {
+		if err := p.RefreshPolicy.validate(); err != nil {
+			return Metadata{}, err
+		}
+		m.RefreshPolicy = p.RefreshPolicy.copy()
+	}
+	return m, nil
+}
+
+// NormalizeTags lowercases, sorts and deduplicates tags, or returns an
+// error wrapping ErrInvalidMetadata naming a malformed one.
+func NormalizeTags(tags []string) ([]string, error) {
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		norm := strings.ToLower(strings.TrimSpace(tag))
+		if !tagPattern.MatchString(norm) {
+			return nil, fmt.Errorf("%w: tag %q: want letters, digits, '-' or '_', at most 32", ErrInvalidMetadata, tag)
+		}
+		out = append(out, norm)
+	}
+	slices.Sort(out)
+	return slices.Compact(out), nil
+}
+
+// MetadataEditor is implemented by repositories that keep user metadata.
+// UpdateMetadata applies p to symbol's coin if ok holds for it, as
+// ConditionalRepository does for its changes.
+type MetadataEditor interface {
+	UpdateMetadata(symbol string, p MetadataPatch, ok Precondition) (Crypto, error)
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestUpdateMetadata(t *testing.T) {
+	eachBackend(t, func(t *testing.T, repo CryptoRepository) {
+		me := repo.(MetadataEditor)
+		for _, sym := range []string{"btc", "eth"} {
+			if _, err := repo.Create(sym); err != nil {
+				t.Fatal(err)
+			}
+		}
+		name, tags := "Cold BTC", []string{"Watch", "defi", "watch"}
+		c, err := me.UpdateMetadata("BTC", MetadataPatch{DisplayName: &name, Tags: &tags}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.DisplayName != name || !slices.Equal(c.Tags, []string{"defi", "watch"}) || c.Version != 2 || c.MetadataUpdatedAt == nil {
+			t.Fatalf("after update: %+v", c.Metadata)
+		}
+		notes := "kept on a ledger"
+		if c, err = me.UpdateMetadata("btc", MetadataPatch{Notes: &notes}, nil); err != nil || c.DisplayName != name || c.Notes != notes {
+			t.Fatalf("partial update: %+v, %v", c.Metadata, err)
+		}
+
+		page, err := Find(repo, ListQuery{Tags: []string{"defi"}})
+		if err != nil || !slices.Equal(ordered(page.Items), []string{"btc"}) {
+			t.Errorf("tag filter = %v, %v", ordered(page.Items), err)
+		}
+		if page, _ = Find(repo, ListQuery{Text: "cold"}); !slices.Equal(ordered(page.Items), []string{"btc"}) {
+			t.Errorf("display name search = %v", ordered(page.Items))
+		}
+
+		long := strings.Repeat("x", MaxDisplayNameLen+1)
+		bad := []string{"no spaces"}
+		for _, p := range []MetadataPatch{{DisplayName: &long}, {Tags: &bad}} {
+			if _, err := me.UpdateMetadata("btc", p, nil); !errors.Is(err, ErrInvalidMetadata) {
+				t.Errorf("invalid patch: %v", err)
+			}
+		}
+		if _, err := me.UpdateMetadata("xyz", MetadataPatch{}, nil); !errors.Is(err, ErrNotFound) {
+			t.Errorf("unknown coin: %v", err)
+		}
+
+		// Metadata survives a restore but not a coin created anew.
+		_ = repo.Delete("btc")
+		if c, _ := repo.(SoftDeleter).Restore("btc"); c.Notes != notes {
+			t.Errorf("restored metadata: %+v", c.Metadata)
+		}
+		_ = repo.Delete("btc")
+		if c, _ := repo.Create("btc"); c.DisplayName != "" || c.Tags != nil {
+			t.Errorf("recreated coin kept metadata: %+v", c.Metadata)
+		}
+	})
+}
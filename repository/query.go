@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SortField is what a list of coins is ordered by.
+type SortField string
+
+const (
+	SortSymbol SortField = "symbol"
+	// SortName orders by display name where one is set, else by name.
+	SortName        SortField = "name"
+	SortPrice       SortField = "price"
+	SortLastUpdated SortField = "last_updated"
+	// SortChangePct orders by the price change over the kept history, in
+	// percent, as PriceStats.PriceChangePct.
+	SortChangePct SortField = "change_pct"
+)
+
+// Valid reports whether f is a known field; empty means SortSymbol.
+func (f SortField) Valid() bool {
+	switch f {
+	case "", SortSymbol, SortName, SortPrice, SortLastUpdated, SortChangePct:
+		return true
+	}
+	return false
+}
+
+// ListQuery selects, orders and pages coins. Zero fields do not filter.
+// Ties are broken by symbol, so the order is total and pages are stable.
+type ListQuery struct {
+	// Sort defaults to SortSymbol; Desc reverses the order.
+	Sort SortField
+	Desc bool
+	// MinPrice and MaxPrice bound the current price, inclusive.
+	MinPrice, MaxPrice *float64
+	// Text matches a case-insensitive substring of the symbol, name or
+	// display name.
+	Text string
+	// Tags keeps coins that carry all of them; they must be normalized
+	// (see NormalizeTags).
+	Tags []string
+	// StaleSince keeps coins whose latest price is older than it.
+	StaleSince time.Time
+	// IncludeDeleted lists deleted coins that can be restored too.
+	IncludeDeleted bool
+	// Cursor continues after the page that returned it as Page.Next.
+	Cursor string
+	// Limit caps the page size; 0 returns all remaining coins.
+	Limit int
+}
+
+// Page is one page of a ListQuery.
+type Page struct {
+	Items []Crypto
+	// Next is the cursor of the following page, empty on the last one.
+	Next string
+}
+
+// Finder is implemented by repositories that filter, order and page
+// coins themselves, without copying every coin first.
+type Finder interface {
+	Find(q ListQuery) (Page, error)
+}
+
+// Find runs q against repo: natively when repo is a Finder, else over
+// List and, with q.IncludeDeleted, ListDeleted.
+func Find(repo CryptoRepository, q ListQuery) (Page, error) {
+	if f, ok := repo.(Finder); ok {
+		return f.Find(q)
+	}
+	items, err := repo.List()
+	if err != nil {
+		return Page{}, err
+	}
+	if sd, ok := repo.(SoftDeleter); ok && q.IncludeDeleted {
+		deleted, err := sd.ListDeleted()
+		if err != nil {
+			return Page{}, err
+		}
+		items = append(items, deleted...)
+	}
+	return q.Apply(items)
+}
+
+// Apply runs q over items, e.g. a list replayed with EventLog.ListAt.
+// It may reorder items.
+func (q ListQuery) Apply(items []Crypto) (Page, error) {
+	return q.page(slices.DeleteFunc(items, func(c Crypto) bool { return !q.matches(c) }))
+}
+
+// matches reports whether c passes q's filters.
+func (q ListQuery) matches(c Crypto) bool {
+	if c.DeletedAt != nil && !q.IncludeDeleted {
+		return false
+	}
+	if (q.MinPrice != nil && c.CurrentPrice < *q.MinPrice) || (q.MaxPrice != nil && c.CurrentPrice > *q.MaxPrice) {
+		return false
+	}
+	if !q.StaleSince.IsZero() && !c.LastUpdated.Before(q.StaleSince) {
+		return false
+	}
+	if !c.HasTags(q.Tags) {
+		return false
+	}
+	if q.Text != "" {
+		text := strings.ToLower(q.Text)
+		return strings.Contains(c.Symbol, text) ||
+			strings.Contains(strings.ToLower(c.Name), text) ||
+			strings.Contains(strings.ToLower(c.DisplayName), text)
+	}
+	return true
+}
+
+// sortKey is where a coin falls in the order of one SortField.
+type sortKey struct {
+	Str    string  `json:"s,omitempty"`
+	Num    float64 `json:"n,omitempty"`
+	Nanos  int64   `json:"t,omitempty"`
+	Symbol string  `json:"y"`
+}
+
+func keyOf(f SortField, c Crypto) sortKey {
+	k := sortKey{Symbol: c.Symbol}
+	switch f {
+	case SortName:
+		k.Str = strings.ToLower(cmp.Or(c.DisplayName, c.Name))
+	case SortPrice:
+		k.Num = c.CurrentPrice
+	case SortLastUpdated:
+		k.Nanos = c.LastUpdated.UnixNano()
+	case SortChangePct:
+		k.Num = statsOf(c.History).PriceChangePct
+	}
+	return k
+}
+
+func (k sortKey) compare(o sortKey) int {
+	return cmp.Or(
+		cmp.Compare(k.Str, o.Str),
+		cmp.Compare(k.Num, o.Num),
+		cmp.Compare(k.Nanos, o.Nanos),
+		cmp.Compare(k.Symbol, o.Symbol),
+	)
+}
+
+// cursor is the decoded form of Page.Next: the key of the last coin of a
+// page and the order it was taken in.
+type cursor struct {
+	Sort SortField `json:"sort"`
+	Desc bool      `json:"desc,omitempty"`
+	Key  sortKey   `json:"key"`
+}
+
+func (c cursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// after decodes q.Cursor; nil means the first page. A cursor taken in
+// another order cannot continue this one.
+func (q ListQuery) after() (*sortKey, error) {
+	if q.Cursor == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Sort != q.sort() || c.Desc != q.Desc {
+		return nil, ErrInvalidCursor
+	}
+	return &c.Key, nil
+}
+
+func (q ListQuery) sort() SortField {
+	if q.Sort == "" {
+		return SortSymbol
+	}
+	return q.Sort
+}
+
+// page orders the coins that matched q and cuts the page after q.Cursor.
+func (q ListQuery) page(items []Crypto) (Page, error) {
+	if !q.Sort.Valid() {
+		return Page{}, ErrInvalidSort
+	}
+	after, err := q.after()
+	if err != nil {
+		return Page{}, err
+	}
+	field := q.sort()
+	type keyed struct {
+		key sortKey
+		c   Crypto
+	}
+	ks := make([]keyed, 0, len(items))
+	for _, c := range items {
+		ks = append(ks, keyed{keyOf(field, c), c})
+	}
+	order := func(a, b sortKey) int {
+		if q.Desc {
+			return b.compare(a)
+		}
+		return a.compare(b)
+	}
+	slices.SortFunc(ks, func(a, b keyed) int { return order(a.key, b.key) })
+	if after != nil {
+		start, _ := slices.BinarySearchFunc(ks, *after, func(k keyed, t sortKey) int {
+			// Coins equal to the cursor were on the previous page.
+			if order(k.key, t) <= 0 {
+				return -1
+			}
+			return 1
+		})
+		ks = ks[start:]
+	}
+	var next string
+	if q.Limit > 0 && len(ks) > q.Limit {
+		ks = ks[:q.Limit]
+		next = cursor{Sort: field, Desc: q.Desc, Key: ks[len(ks)-1].key}.encode()
+	}
+	out := make([]Crypto, 0, len(ks))
+	for _, k := range ks {
+		out = append(out, k.c)
+	}
+	return Page{Items: out, Next: next}, nil
+}
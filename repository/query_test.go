@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindOrdersFiltersAndPages(t *testing.T) {
+	eachBackend(t, func(t *testing.T, repo CryptoRepository) {
+		for _, sym := range []string{"eth", "btc", "usdt", "doge"} {
+			if _, err := repo.Create(sym); err != nil {
+				t.Fatal(err)
+			}
+		}
+		midway := time.Now()
+		time.Sleep(time.Millisecond)
+		if _, err := repo.RefreshPrice("eth"); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Delete("doge"); err != nil {
+			t.Fatal(err)
+		}
+		find := func(q ListQuery) []string {
+			t.Helper()
+			page, err := Find(repo, q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return ordered(page.Items)
+		}
+
+		if got := find(ListQuery{}); !slices.Equal(got, []string{"btc", "eth", "usdt"}) {
+			t.Errorf("default order = %v", got)
+		}
+		if got := find(ListQuery{Sort: SortSymbol, Desc: true, IncludeDeleted: true}); !slices.Equal(got, []string{"usdt", "eth", "-doge", "btc"}) {
+			t.Errorf("desc with deleted = %v", got)
+		}
+		if got := find(ListQuery{Text: "T"}); !slices.Equal(got, []string{"btc", "eth", "usdt"}) {
+			t.Errorf("q=T = %v", got)
+		}
+		btc, _ := repo.Get("btc")
+		if got := find(ListQuery{Text: strings.ToUpper(btc.Name)}); !slices.Contains(got, "btc") {
+			t.Errorf("q=%s (name) = %v", btc.Name, got)
+		}
+		if got := find(ListQuery{StaleSince: midway}); !slices.Equal(got, []string{"btc", "usdt"}) {
+			t.Errorf("stale_since = %v", got)
+		}
+		if got := find(ListQuery{Sort: SortLastUpdated, Desc: true}); got[0] != "eth" {
+			t.Errorf("last_updated desc = %v, want eth first", got)
+		}
+
+		var all []string
+		q := ListQuery{Sort: SortName, Limit: 2, IncludeDeleted: true}
+		for pages := 0; ; pages++ {
+			if pages > 2 {
+				t.Fatal("paging does not end")
+			}
+			page, err := Find(repo, q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			all = append(all, ordered(page.Items)...)
+			if page.Next == "" {
+				break
+			}
+			q.Cursor = page.Next
+		}
+		slices.Sort(all)
+		if !slices.Equal(all, []string{"-doge", "btc", "eth", "usdt"}) {
+			t.Errorf("pages = %v, want every coin once", all)
+		}
+
+		q.Desc = true
+		if _, err := Find(repo, q); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("cursor of another order: %v", err)
+		}
+	})
+}
+
+// ordered is symbols without sorting.
+func ordered(list []Crypto) []string {
+	out := []string{}
+	for _, c := range list {
+		out = append(out, symbols([]Crypto{c})...)
+	}
+	return out
+}
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"cryptoserver/config"
+)
+
+// MinRefreshInterval is the shortest automatic refresh interval a coin
+// can be given, which bounds the upstream calls one coin can cause.
+const MinRefreshInterval = 10 * time.Second
+
+// RefreshPolicy is how the automatic refresher treats a coin. A coin
+// without an interval is refreshed on request only.
+type RefreshPolicy struct {
+	Interval config.Duration `json:"interval,omitempty"`
+	// Paused keeps the interval but stops automatic refreshes.
+	Paused     bool        `json:"paused,omitempty"`
+	QuietHours *QuietHours `json:"quiet_hours,omitempty"`
+}
+
+// QuietHours is a daily window, in UTC, without automatic refreshes.
+// Start and End are "HH:MM"; an End before Start spans midnight.
+type QuietHours struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Active reports whether p asks for automatic refreshes.
+func (p RefreshPolicy) Active() bool {
+	return p.Interval > 0 && !p.Paused
+}
+
+func (p RefreshPolicy) validate() error {
+	if p.Interval != 0 && time.Duration(p.Interval) < MinRefreshInterval {
+		return fmt.Errorf("%w: refresh_policy.interval must be 0 or at least %s", ErrInvalidMetadata, MinRefreshInterval)
+	}
+	if q := p.QuietHours; q != nil {
+		start, err1 := clock(q.Start)
+		end, err2 := clock(q.End)
+		if err := errors.Join(err1, err2); err != nil || start == end {
+			return fmt.Errorf("%w: refresh_policy.quiet_hours: want distinct start and end as HH:MM", ErrInvalidMetadata)
+		}
+	}
+	return nil
+}
+
+func (p RefreshPolicy) copy() RefreshPolicy {
+	if p.QuietHours != nil {
+		q := *p.QuietHours
+		p.QuietHours = &q
+	}
+	return p
+}
+
+// clock parses "HH:MM" into minutes since midnight.
+func clock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// window returns the quiet window that contains t, if any. The hours were
+// validated when they were set.
+func (q *QuietHours) window(t time.Time) (start, end time.Time, quiet bool) {
+	if q == nil {
+		return
+	}
+	from, _ := clock(q.Start)
+	to, _ := clock(q.End)
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if to < from {
+		to += 24 * time.Hour
+	}
+	// The window that started yesterday may still be running.
+	for _, d := range []time.Time{day.AddDate(0, 0, -1), day} {
+		start, end = d.Add(from), d.Add(to)
+		if !t.Before(start) && t.Before(end) {
+			return start, end, true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// NextRefreshAt is when the automatic refresher will next refresh c:
+// an interval after the last attempt, moved past quiet hours. A time in
+// the past means the coin is due. ok is false for coins that are not
+// refreshed automatically.
+func (c Crypto) NextRefreshAt() (next time.Time, ok bool) {
+	if !c.RefreshPolicy.Active() || c.DeletedAt != nil {
+		return time.Time{}, false
+	}
+	next = c.LastRefreshAt.Add(time.Duration(c.RefreshPolicy.Interval))
+	if _, end, quiet := c.RefreshPolicy.QuietHours.window(next); quiet {
+		next = end
+	}
+	return next, true
+}
+
+// due reports whether the automatic refresher should refresh c at now.
+func (c Crypto) due(now time.Time) bool {
+	next, ok := c.NextRefreshAt()
+	if !ok || next.After(now) {
+		return false
+	}
+	_, _, quiet := c.RefreshPolicy.QuietHours.window(now)
+	return !quiet
+}
+
+// refreshFailure is what a failed refresh leaves in LastRefreshError:
+// the repository's own reason, never upstream text.
+func refreshFailure(err error) string {
+	if errors.Is(err, ErrPriceRejected) {
+		return err.Error()
+	}
+	for _, sentinel := range []error{ErrPriceUnavailable, ErrRateLimited, ErrServiceUnavailable} {
+		if errors.Is(err, sentinel) {
+			return sentinel.Error()
+		}
+	}
+	return "refresh failed"
+}
+
+// RefreshDue refreshes the coins of every tenant whose refresh policy
+// makes them due at now and returns how many were refreshed. Failures
+// are recorded on the coins by RefreshPrice.
+func (t *Tenants) RefreshDue(now time.Time) int {
+	t.mu.Lock()
+	repos := maps.Clone(t.repos)
+	t.mu.Unlock()
+	n := 0
+	for _, tenant := range slices.Sorted(maps.Keys(repos)) {
+		repo := repos[tenant]
+		coins, err := repo.List()
+		if err != nil {
+			slog.Error("automatic refresh: list failed", "tenant", tenant, "err", err)
+			continue
+		}
+		for _, c := range coins {
+			if !c.due(now) {
+				continue
+			}
+			if _, err := repo.RefreshPrice(c.Symbol); err != nil {
+				slog.Warn("automatic refresh failed", "tenant", tenant, "symbol", c.Symbol, "err", err)
+				continue
+			}
+			n++
+		}
+	}
+	return n
+}
+
+// RunRefresher calls RefreshDue every interval until ctx is done.
+func (t *Tenants) RunRefresher(ctx context.Context, every time.Duration) {
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-tick.C:
+			if n := t.RefreshDue(now); n > 0 {
+				slog.Debug("refreshed due coins", "count", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"cryptoserver/config"
+)
+
+func TestRefreshPolicyValidation(t *testing.T) {
+	for _, tc := range []struct {
+		policy RefreshPolicy
+		ok     bool
+	}{
+		{RefreshPolicy{}, true},
+		{RefreshPolicy{Interval: config.Duration(MinRefreshInterval)}, true},
+		{RefreshPolicy{Interval: config.Duration(time.Second)}, false},
+		{RefreshPolicy{Interval: config.Duration(time.Minute), Paused: true}, true},
+		{RefreshPolicy{QuietHours: &QuietHours{Start: "22:00", End: "06:00"}}, true},
+		{RefreshPolicy{QuietHours: &QuietHours{Start: "22:00", End: "22:00"}}, false},
+		{RefreshPolicy{QuietHours: &QuietHours{Start: "25:00", End: "06:00"}}, false},
+		{RefreshPolicy{QuietHours: &QuietHours{Start: "22:00"}}, false},
+	} {
+		err := tc.policy.validate()
+		if (err == nil) != tc.ok || (err != nil && !errors.Is(err, ErrInvalidMetadata)) {
+			t.Errorf("validate(%+v) = %v, want ok %v", tc.policy, err, tc.ok)
+		}
+	}
+}
+
+func TestNextRefreshAtSkipsQuietHours(t *testing.T) {
+	at := func(hhmm string) time.Time {
+		t, _ := time.Parse("2006-01-02 15:04", "2026-03-10 "+hhmm)
+		return t
+	}
+	quiet := &QuietHours{Start: "22:00", End: "06:00"}
+	c := Crypto{LastRefreshAt: at("21:55")}
+	c.RefreshPolicy = RefreshPolicy{Interval: config.Duration(10 * time.Minute), QuietHours: quiet}
+	if next, ok := c.NextRefreshAt(); !ok || !next.Equal(at("06:00").AddDate(0, 0, 1)) {
+		t.Errorf("across midnight: next = %v, %v", next, ok)
+	}
+	c.LastRefreshAt = at("01:00")
+	if next, _ := c.NextRefreshAt(); !next.Equal(at("06:00")) {
+		t.Errorf("inside the window started yesterday: next = %v", next)
+	}
+	c.LastRefreshAt = at("12:00")
+	if next, _ := c.NextRefreshAt(); !next.Equal(at("12:10")) {
+		t.Errorf("outside quiet hours: next = %v", next)
+	}
+	if c.due(at("12:05")) || !c.due(at("12:10")) || c.due(at("23:00")) {
+		t.Error("due ignores the interval or quiet hours")
+	}
+
+	c.RefreshPolicy.Paused = true
+	if _, ok := c.NextRefreshAt(); ok || c.due(at("13:00")) {
+		t.Error("a paused coin is due")
+	}
+}
+
+func TestRefreshDue(t *testing.T) {
+	cfg := config.Default().Repository
+	for name, newRepo := range map[string]func(PriceSource) CryptoRepository{
+		"memory": func(src PriceSource) CryptoRepository { return NewMemoryCryptoRepoWithConfig(cfg, src) },
+		"events": func(src PriceSource) CryptoRepository { return NewEventCryptoRepoWithConfig(cfg, src) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			src := &scriptedSource{quotes: []Quote{{Price: 100}, {Price: 101}}}
+			var built []CryptoRepository
+			tenants := NewTenants(func(string) CryptoRepository {
+				repo := newRepo(src)
+				built = append(built, repo)
+				return repo
+			})
+			interval := RefreshPolicy{Interval: config.Duration(time.Minute)}
+			for _, tenant := range []string{"team-a", "team-b"} {
+				repo := tenants.For(tenant)
+				for _, sym := range []string{"btc", "eth"} {
+					if _, err := repo.Create(sym); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if _, err := repo.(MetadataEditor).UpdateMetadata("btc", MetadataPatch{RefreshPolicy: &interval}, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			now := time.Now()
+			if n := tenants.RefreshDue(now); n != 0 {
+				t.Errorf("refreshed %d coins before the interval", n)
+			}
+			later := now.Add(2 * time.Minute)
+			if n := tenants.RefreshDue(later); n != 2 {
+				t.Errorf("refreshed %d coins, want btc of both tenants", n)
+			}
+			btc, _ := tenants.For("team-a").Get("btc")
+			if len(btc.History) != 2 || btc.LastRefreshError != "" {
+				t.Errorf("refreshed btc: %d records, error %q", len(btc.History), btc.LastRefreshError)
+			}
+			if eth, _ := tenants.For("team-a").Get("eth"); len(eth.History) != 1 {
+				t.Errorf("eth without a policy was refreshed")
+			}
+
+			// A failure is recorded without the upstream text and counts as
+			// an attempt; a success clears it.
+			src.mu.Lock()
+			src.err = errors.New("upstream said no: secret-token")
+			src.mu.Unlock()
+			if n := tenants.RefreshDue(later.Add(2 * time.Minute)); n != 0 {
+				t.Errorf("failed refreshes counted: %d", n)
+			}
+			failed, _ := tenants.For("team-a").Get("btc")
+			if failed.LastRefreshError != ErrServiceUnavailable.Error() || strings.Contains(failed.LastRefreshError, "secret") {
+				t.Errorf("last refresh error = %q", failed.LastRefreshError)
+			}
+			if !failed.LastRefreshAt.After(btc.LastRefreshAt) || failed.Version != btc.Version+1 || failed.CurrentPrice != btc.CurrentPrice {
+				t.Errorf("failed refresh: %+v after %+v", failed, btc)
+			}
+			src.mu.Lock()
+			src.err = nil
+			src.mu.Unlock()
+			if c, err := tenants.For("team-a").RefreshPrice("btc"); err != nil || c.LastRefreshError != "" {
+				t.Errorf("refresh after failure: %q, %v", c.LastRefreshError, err)
+			}
+			if len(built) != 2 {
+				t.Fatalf("built %d repositories, want one per tenant", len(built))
+			}
+			for _, repo := range built {
+				if repo, ok := repo.(*EventCryptoRepo); ok {
+					checkReplay(t, repo)
+				}
+			}
+		})
+	}
+}
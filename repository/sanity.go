@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"cryptoserver/config"
+)
+
+// Reasons a fetched price is reported as an Anomaly.
+const (
+	ReasonNonFinite   = "non_finite"
+	ReasonNonPositive = "non_positive"
+	ReasonDeviation   = "deviation"
+)
+
+// Anomaly is a fetched price that failed a sanity check. Anomalies are
+// kept apart from the price history, which only holds accepted prices.
+type Anomaly struct {
+	Price float64 `json:"price"`
+	// Raw spells out a NaN or infinite price, which JSON cannot carry;
+	// Price is 0 then.
+	Raw       string    `json:"raw,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Provider  string    `json:"provider,omitempty"`
+	Cached    bool      `json:"cached,omitempty"`
+	Reason    string    `json:"reason"`
+	// Reference is the median of the recent history the price was
+	// compared to and Deviation the relative move from it; both are set
+	// for ReasonDeviation only.
+	Reference float64 `json:"reference,omitempty"`
+	Deviation float64 `json:"deviation,omitempty"`
+	// Quarantined is set when the price was kept out of history. A
+	// flagged outlier is recorded too, with PriceRecord.Outlier set.
+	Quarantined bool `json:"quarantined"`
+}
+
+// sanity applies config.SanityConfig to fetched prices.
+type sanity struct {
+	cfg config.SanityConfig
+}
+
+// check returns the anomaly q represents given the recorded history h,
+// or nil if the price is acceptable.
+func (s sanity) check(q Quote, h []PriceRecord) *Anomaly {
+	a := &Anomaly{Price: q.Price, Provider: q.Provider, Cached: q.Cached, Quarantined: true}
+	switch {
+	case math.IsNaN(q.Price) || math.IsInf(q.Price, 0):
+		a.Price, a.Raw = 0, strconv.FormatFloat(q.Price, 'g', -1, 64)
+		a.Reason = ReasonNonFinite
+		return a
+	case q.Price <= 0:
+		a.Reason = ReasonNonPositive
+		return a
+	}
+	if s.cfg.MaxDeviation == 0 || len(h) == 0 {
+		return nil
+	}
+	recent := make([]float64, 0, min(len(h), s.cfg.Window))
+	for _, rec := range h[max(0, len(h)-s.cfg.Window):] {
+		recent = append(recent, rec.Price)
+	}
+	ref := median(recent)
+	dev := math.Abs(q.Price/ref - 1)
+	if dev <= s.cfg.MaxDeviation {
+		return nil
+	}
+	a.Reason, a.Reference, a.Deviation = ReasonDeviation, ref, dev
+	a.Quarantined = s.cfg.Action == config.OutlierQuarantine
+	return a
+}
+
+// confirmed reports whether the quarantined outlier a, together with the
+// outliers quarantined just before it (since the last recorded price at
+// lastRecorded), amounts to ConfirmAfter fresh observations that agree
+// with each other, i.e. the market really moved. Cached repeats of one
+// bad tick do not count.
+func (s sanity) confirmed(a *Anomaly, prev []Anomaly, lastRecorded time.Time) bool {
+	if s.cfg.ConfirmAfter == 0 || a.Reason != ReasonDeviation || a.Cached {
+		return false
+	}
+	run := []float64{a.Price}
+	for i := len(prev) - 1; i >= 0 && len(run) < s.cfg.ConfirmAfter; i-- {
+		p := prev[i]
+		if p.Timestamp.Before(lastRecorded) {
+			break
+		}
+		if p.Reason == ReasonDeviation && p.Quarantined && !p.Cached {
+			run = append(run, p.Price)
+		}
+	}
+	if len(run) < s.cfg.ConfirmAfter {
+		return false
+	}
+	ref := median(run)
+	for _, p := range run {
+		if math.Abs(p/ref-1) > s.cfg.MaxDeviation {
+			return false
+		}
+	}
+	return true
+}
+
+// recordsSince returns the tail of h recorded at or after t.
+func recordsSince(h []PriceRecord, t time.Time) []PriceRecord {
+	i := len(h)
+	for i > 0 && !h[i-1].Timestamp.Before(t) {
+		i--
+	}
+	return h[i:]
+}
+
+func median(xs []float64) float64 {
+	xs = slices.Clone(xs)
+	slices.Sort(xs)
+	mid := len(xs) / 2
+	if len(xs)%2 == 0 {
+		return (xs[mid-1] + xs[mid]) / 2
+	}
+	return xs[mid]
+}
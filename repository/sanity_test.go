@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"testing"
+
+	"cryptoserver/config"
+)
+
+// scriptedSource answers GetQuote with queued quotes, repeating the last,
+// or with err while it is set.
+type scriptedSource struct {
+	mu     sync.Mutex
+	quotes []Quote
+	err    error
+}
+
+func (s *scriptedSource) GetName(symbol string) (string, error) { return "Name of " + symbol, nil }
+
+func (s *scriptedSource) GetPrice(symbol string) (float64, error) {
+	q, err := s.GetQuote(symbol)
+	return q.Price, err
+}
+
+func (s *scriptedSource) GetQuote(symbol string) (Quote, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return Quote{}, s.err
+	}
+	q := s.quotes[0]
+	if len(s.quotes) > 1 {
+		s.quotes = s.quotes[1:]
+	}
+	return q, nil
+}
+
+func newSanityRepo(t *testing.T, action string, prices ...float64) *MemoryCryptoRepo {
+	t.Helper()
+	src := &scriptedSource{}
+	for _, p := range prices {
+		src.quotes = append(src.quotes, Quote{Price: p, Provider: "test"})
+	}
+	cfg := config.Default().Repository
+	cfg.Sanity.Action = action
+	return NewMemoryCryptoRepoWithConfig(cfg, src)
+}
+
+func TestSanityRejectsMalformedPrices(t *testing.T) {
+	repo := newSanityRepo(t, config.OutlierFlag, 100, math.NaN(), math.Inf(1), 0, -5, 101)
+	if _, err := repo.Create("btc"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	for _, want := range []string{ReasonNonFinite, ReasonNonFinite, ReasonNonPositive, ReasonNonPositive} {
+		if _, err := repo.RefreshPrice("btc"); !errors.Is(err, ErrPriceRejected) {
+			t.Fatalf("RefreshPrice error = %v, want ErrPriceRejected (%s)", err, want)
+		}
+	}
+	c, err := repo.RefreshPrice("btc")
+	if err != nil || c.CurrentPrice != 101 || len(c.History) != 2 {
+		t.Fatalf("RefreshPrice = %+v, %v; want 101 after 100", c, err)
+	}
+
+	got, err := repo.Anomalies("BTC")
+	if err != nil {
+		t.Fatalf("Anomalies: %v", err)
+	}
+	want := []Anomaly{
+		{Raw: "NaN", Reason: ReasonNonFinite},
+		{Raw: "+Inf", Reason: ReasonNonFinite},
+		{Price: 0, Reason: ReasonNonPositive},
+		{Price: -5, Reason: ReasonNonPositive},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("anomalies = %+v, want %d", got, len(want))
+	}
+	for i, a := range got {
+		if a.Price != want[i].Price || a.Raw != want[i].Raw || a.Reason != want[i].Reason || !a.Quarantined || a.Provider != "test" || a.Timestamp.IsZero() {
+			t.Errorf("anomalies[%d] = %+v, want %+v quarantined", i, a, want[i])
+		}
+	}
+}
+
+func TestSanityRejectsMalformedFirstPrice(t *testing.T) {
+	repo := newSanityRepo(t, config.OutlierQuarantine, -1)
+	if _, err := repo.Create("btc"); !errors.Is(err, ErrPriceRejected) {
+		t.Fatalf("Create error = %v, want ErrPriceRejected", err)
+	}
+	if _, err := repo.Get("btc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("coin created despite rejected price: %v", err)
+	}
+}
+
+func TestSanityQuarantinesSpike(t *testing.T) {
+	repo := newSanityRepo(t, config.OutlierQuarantine, 100, 110, 100_000, 105)
+	if _, err := repo.Create("btc"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := repo.RefreshPrice("btc"); err != nil {
+		t.Fatalf("RefreshPrice 110: %v", err)
+	}
+	if _, err := repo.RefreshPrice("btc"); !errors.Is(err, ErrPriceRejected) {
+		t.Fatalf("RefreshPrice spike error = %v, want ErrPriceRejected", err)
+	}
+	c, err := repo.RefreshPrice("btc")
+	if err != nil || c.CurrentPrice != 105 {
+		t.Fatalf("RefreshPrice after spike = %+v, %v", c, err)
+	}
+	for _, rec := range c.History {
+		if rec.Price == 100_000 || rec.Outlier {
+			t.Errorf("quarantined spike reached history: %+v", c.History)
+		}
+	}
+
+	got, _ := repo.Anomalies("btc")
+	if len(got) != 1 {
+		t.Fatalf("anomalies = %+v, want the spike", got)
+	}
+	a := got[0]
+	if a.Reason != ReasonDeviation || a.Price != 100_000 || a.Reference != 105 || !a.Quarantined || math.Abs(a.Deviation-(100_000.0/105-1)) > 1e-9 {
+		t.Errorf("anomaly = %+v", a)
+	}
+}
+
+func TestSanityFlagsOutlier(t *testing.T) {
+	repo := newSanityRepo(t, config.OutlierFlag, 100, 1)
+	if _, err := repo.Create("btc"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	c, err := repo.RefreshPrice("btc")
+	if err != nil {
+		t.Fatalf("RefreshPrice: %v", err)
+	}
+	if c.CurrentPrice != 1 || !c.History[1].Outlier || c.History[0].Outlier {
+		t.Errorf("history = %+v, want the drop recorded as an outlier", c.History)
+	}
+	got, _ := repo.Anomalies("btc")
+	if len(got) != 1 || got[0].Quarantined || got[0].Reason != ReasonDeviation {
+		t.Errorf("anomalies = %+v, want one flagged deviation", got)
+	}
+}
+
+func TestSanityConfirmsSustainedMove(t *testing.T) {
+	// The price really halves and stays there: after confirm_after (3)
+	// agreeing observations the new level is accepted.
+	repo := newSanityRepo(t, config.OutlierQuarantine, 100, 30, 31, 29.5, 30.5)
+	if _, err := repo.Create("btc"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := repo.RefreshPrice("btc"); !errors.Is(err, ErrPriceRejected) {
+			t.Fatalf("refresh %d error = %v, want ErrPriceRejected", i, err)
+		}
+	}
+	c, err := repo.RefreshPrice("btc")
+	if err != nil || c.CurrentPrice != 29.5 {
+		t.Fatalf("third agreeing refresh = %+v, %v; want 29.5 accepted", c, err)
+	}
+	if c, err = repo.RefreshPrice("btc"); err != nil || c.CurrentPrice != 30.5 {
+		t.Fatalf("refresh at the new level = %+v, %v", c, err)
+	}
+}
+
+func TestSanityCachedRepeatsDoNotConfirm(t *testing.T) {
+	src := &scriptedSource{quotes: []Quote{{Price: 100}, {Price: 1e5}, {Price: 1e5, Cached: true}}}
+	repo := NewMemoryCryptoRepoWithConfig(config.Default().Repository, src)
+	if _, err := repo.Create("btc"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := repo.RefreshPrice("btc"); !errors.Is(err, ErrPriceRejected) {
+			t.Fatalf("refresh %d error = %v, want ErrPriceRejected", i, err)
+		}
+	}
+}
+
+func TestAnomaliesBoundedAndDroppedWithCoin(t *testing.T) {
+	src := &scriptedSource{quotes: []Quote{{Price: 100}, {Price: -1}}}
+	cfg := config.Default().Repository
+	cfg.Sanity.AnomalyLimit = 3
+	repo := NewMemoryCryptoRepoWithConfig(cfg, src)
+	if _, err := repo.Create("btc"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		_, _ = repo.RefreshPrice("btc")
+	}
+	if got, _ := repo.Anomalies("btc"); len(got) != 3 {
+		t.Errorf("len(anomalies) = %d, want limit 3", len(got))
+	}
+
+	if err := repo.Delete("btc"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := repo.Anomalies("btc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Anomalies after Delete error = %v, want ErrNotFound", err)
+	}
+	src.quotes = []Quote{{Price: 100}}
+	if _, err := repo.Create("btc"); err != nil {
+		t.Fatalf("re-Create: %v", err)
+	}
+	if got, err := repo.Anomalies("btc"); err != nil || len(got) != 0 || got == nil {
+		t.Errorf("anomalies of re-created coin = %#v, %v; want empty", got, err)
+	}
+}
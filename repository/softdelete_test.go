@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"cryptoserver/audit"
+	"cryptoserver/config"
+)
+
+// softDeleteBackends builds each SoftDeleter over one scripted price.
+func softDeleteBackends(purgeAfter time.Duration) map[string]func() CryptoRepository {
+	cfg := config.Default().Repository
+	cfg.PurgeAfter = config.Duration(purgeAfter)
+	src := &scriptedSource{quotes: []Quote{{Price: 100}}}
+	return map[string]func() CryptoRepository{
+		"memory": func() CryptoRepository { return NewMemoryCryptoRepoWithConfig(cfg, src) },
+		"events": func() CryptoRepository { return NewEventCryptoRepoWithConfig(cfg, src) },
+	}
+}
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	for name, newRepo := range softDeleteBackends(time.Hour) {
+		t.Run(name, func(t *testing.T) {
+			repo := newRepo()
+			sd := repo.(SoftDeleter)
+			if _, err := repo.Create("btc"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := repo.RefreshPrice("btc"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := sd.Restore("btc"); !errors.Is(err, ErrNotDeleted) {
+				t.Errorf("restoring a live coin: error = %v, want ErrNotDeleted", err)
+			}
+			if err := repo.Delete("btc"); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := repo.Get("btc"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get of a deleted coin: error = %v, want ErrNotFound", err)
+			}
+			if _, err := repo.RefreshPrice("btc"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("RefreshPrice of a deleted coin: error = %v, want ErrNotFound", err)
+			}
+			if err := repo.Delete("btc"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("deleting twice: error = %v, want ErrNotFound", err)
+			}
+			if list, _ := repo.List(); len(list) != 0 {
+				t.Errorf("List = %+v, want the deleted coin hidden", list)
+			}
+			deleted, _ := sd.ListDeleted()
+			if len(deleted) != 1 || deleted[0].DeletedAt == nil {
+				t.Fatalf("ListDeleted = %+v", deleted)
+			}
+
+			c, err := sd.Restore("BTC")
+			if err != nil || c.DeletedAt != nil || len(c.History) != 2 {
+				t.Fatalf("Restore = %+v, %v; want the coin with its 2 records", c, err)
+			}
+			if _, err := repo.Get("btc"); err != nil {
+				t.Errorf("Get after restore: %v", err)
+			}
+			if _, err := sd.Restore("eth"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("restoring an unknown coin: error = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestSoftDeletePurge(t *testing.T) {
+	for name, newRepo := range softDeleteBackends(time.Hour) {
+		t.Run(name, func(t *testing.T) {
+			repo := newRepo()
+			sd := repo.(SoftDeleter)
+			for _, sym := range []string{"btc", "eth"} {
+				if _, err := repo.Create(sym); err != nil {
+					t.Fatal(err)
+				}
+				if err := repo.Delete(sym); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := sd.PurgeExpired(time.Now()); len(got) != 0 {
+				t.Errorf("purged before the delay: %v", got)
+			}
+			if got := sd.PurgeExpired(time.Now().Add(time.Hour)); !slices.Equal(sortedCopy(got), []string{"btc", "eth"}) {
+				t.Errorf("purged after the delay = %v", got)
+			}
+			if _, err := sd.Restore("btc"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("restoring a purged coin: error = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestPurgeEventStampedWithDecisionTime(t *testing.T) {
+	cfg := config.Default().Repository
+	cfg.PurgeAfter = config.Duration(time.Hour)
+	repo := NewEventCryptoRepoWithConfig(cfg, &scriptedSource{quotes: []Quote{{Price: 100}}})
+	if _, err := repo.Create("btc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete("btc"); err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now().Add(2 * time.Hour)
+	repo.PurgeExpired(at)
+	events, _ := repo.Events(0, 10)
+	if last := events[len(events)-1]; last.Type != EventCoinPurged || !last.Time.Equal(at) {
+		t.Errorf("last event = %+v, want coin_purged at %v", last, at)
+	}
+	checkReplay(t, repo)
+}
+
+func TestSoftDeleteDisabled(t *testing.T) {
+	for name, newRepo := range softDeleteBackends(0) {
+		t.Run(name, func(t *testing.T) {
+			repo := newRepo()
+			if _, err := repo.Create("btc"); err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.Delete("btc"); err != nil {
+				t.Fatal(err)
+			}
+			if deleted, _ := repo.(SoftDeleter).ListDeleted(); len(deleted) != 0 {
+				t.Errorf("tombstones with purge_after 0: %+v", deleted)
+			}
+			// Creating again starts a fresh history either way.
+			c, err := repo.Create("btc")
+			if err != nil || len(c.History) != 1 {
+				t.Errorf("re-Create = %+v, %v", c, err)
+			}
+		})
+	}
+}
+
+func TestCreateReplacesTombstone(t *testing.T) {
+	for name, newRepo := range softDeleteBackends(time.Hour) {
+		t.Run(name, func(t *testing.T) {
+			repo := newRepo()
+			if _, err := repo.Create("btc"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := repo.RefreshPrice("btc"); err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.Delete("btc"); err != nil {
+				t.Fatal(err)
+			}
+			c, err := repo.Create("btc")
+			if err != nil || len(c.History) != 1 {
+				t.Fatalf("Create over a tombstone = %+v, %v; want a fresh coin", c, err)
+			}
+			if deleted, _ := repo.(SoftDeleter).ListDeleted(); len(deleted) != 0 {
+				t.Errorf("tombstone kept after Create: %+v", deleted)
+			}
+		})
+	}
+}
+
+func TestTenantsPurgeAudited(t *testing.T) {
+	log := audit.NewMemoryStore(100)
+	cfg := config.Default().Repository
+	src := &scriptedSource{quotes: []Quote{{Price: 100}}}
+	tenants := NewTenants(func(tenant string) CryptoRepository {
+		return NewAudited(NewMemoryCryptoRepoWithConfig(cfg, src), log, tenant)
+	})
+	for _, tenant := range []string{"team-a", "team-b"} {
+		repo := tenants.For(tenant)
+		if _, err := repo.Create("btc"); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Delete("btc"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := tenants.For("team-a").(SoftDeleter).Restore("btc"); err != nil {
+		t.Fatal(err)
+	}
+	if n := tenants.PurgeExpired(time.Now().Add(time.Duration(cfg.PurgeAfter))); n != 1 {
+		t.Errorf("purged %d coins, want team-b's", n)
+	}
+
+	var actions []string
+	entries, _ := log.Find(audit.Query{Tenant: "team-a"})
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+	}
+	if !slices.Equal(actions, []string{audit.ActionCreate, audit.ActionDelete, audit.ActionRestore}) {
+		t.Errorf("team-a actions = %v", actions)
+	}
+	entries, _ = log.Find(audit.Query{Tenant: "team-b"})
+	if last := entries[len(entries)-1]; last.Action != audit.ActionPurge || last.Subject != audit.SystemActor {
+		t.Errorf("team-b last entry = %+v, want a purge by %s", last, audit.SystemActor)
+	}
+}
+
+func sortedCopy(s []string) []string {
+	s = slices.Clone(s)
+	slices.Sort(s)
+	return s
+}
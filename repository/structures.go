@@ -9,6 +9,16 @@ import (
 type PriceRecord struct {
 	Price     float64   `json:"price"`
 	Timestamp time.Time `json:"timestamp"`
+	// Cached is set when the price was served from the price cache rather
+	// than fetched for this record; Stale when that cached price had
+	// expired and was served because the upstream failed.
+	Cached bool `json:"cached,omitempty"`
+	Stale  bool `json:"stale,omitempty"`
+	// Provider names the price provider(s) the price came from.
+	Provider string `json:"provider,omitempty"`
+	// Outlier marks a price that moved further from recent history than
+	// the sanity checks allow and was recorded anyway (see Anomaly).
+	Outlier bool `json:"outlier,omitempty"`
 }
 
 type Crypto struct {
@@ -17,6 +27,17 @@ type Crypto struct {
 	CurrentPrice float64       `json:"current_price"`
 	LastUpdated  time.Time     `json:"last_updated"`
 	History      []PriceRecord `json:"history"`
+	// Version counts the changes of the coin since it was created:
+	// creation, recorded prices, failed refreshes, metadata edits,
+	// deletion and restore.
+	Version int64 `json:"version"`
+	// LastRefreshAt is when a price was last fetched for the coin,
+	// successfully or not; LastRefreshError says why that failed.
+	LastRefreshAt    time.Time `json:"last_refresh_at"`
+	LastRefreshError string    `json:"last_refresh_error,omitempty"`
+	// DeletedAt is set on a deleted coin that can still be restored.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	Metadata
 }
 
 type PriceStats struct {
@@ -36,19 +57,75 @@ type CryptoRepository interface {
 	RefreshPrice(symbol string) (Crypto, error)
 	History(symbol string) ([]PriceRecord, error)
 	Stats(symbol string) (PriceStats, error)
+	// Anomalies lists the prices that failed sanity checks, oldest first.
+	Anomalies(symbol string) ([]Anomaly, error)
+}
+
+// PriceSource is the upstream the repository resolves names and prices
+// from. Errors wrap the geckoclient sentinels.
+type PriceSource interface {
+	GetName(symbol string) (string, error)
+	GetPrice(symbol string) (float64, error)
+}
+
+// Quote is a price together with where it came from.
+type Quote struct {
+	Price    float64
+	Cached   bool
+	Stale    bool
+	Provider string
+}
+
+// QuoteSource is implemented by price sources that can tell cached prices
+// from fresh ones (see pricecache); the repository prefers it over GetPrice.
+type QuoteSource interface {
+	GetQuote(symbol string) (Quote, error)
+}
+
+// HealthChecker is implemented by backends that can verify their storage
+// is usable; readiness probes call it when available.
+type HealthChecker interface {
+	CheckHealth() error
+}
+
+// SoftDeleter is implemented by repositories whose Delete leaves a
+// tombstone: the coin disappears from reads but can be restored, history
+// intact, until it is purged.
+type SoftDeleter interface {
+	// Restore brings back a deleted coin; ErrNotDeleted if it is live.
+	Restore(symbol string) (Crypto, error)
+	// ListDeleted lists the tombstoned coins.
+	ListDeleted() ([]Crypto, error)
+	// PurgeExpired drops the tombstones whose purge delay has passed at
+	// now and returns their symbols.
+	PurgeExpired(now time.Time) []string
 }
 
 func (c Crypto) Copy() Crypto {
 	out := c
 	out.History = slices.Clone(c.History)
+	out.Metadata = c.Metadata.copy()
+	if c.DeletedAt != nil {
+		t := *c.DeletedAt
+		out.DeletedAt = &t
+	}
 	return out
 }
 
 var (
     ErrAlreadyExists = errors.New("crypto already exists")
+    ErrNotDeleted    = errors.New("crypto is not deleted")
     ErrNotFound      = errors.New("crypto not found")
     ErrInvalidSymbol = errors.New("invalid symbol")
     ErrNameUnavailable  = errors.New("name unavailable")
     ErrPriceUnavailable = errors.New("price unavailable")
+    ErrPriceRejected    = errors.New("price rejected")
     ErrServiceUnavailable = errors.New("service unavailable")
+    ErrRateLimited        = errors.New("upstream rate limited")
+    ErrNoEventLog         = errors.New("repository keeps no event log")
+    ErrEventsTrimmed      = errors.New("event log trimmed")
+    ErrPreconditionFailed = errors.New("crypto changed since the precondition was taken")
+    ErrInvalidSort        = errors.New("unknown sort field")
+    ErrInvalidCursor      = errors.New("invalid or mismatched cursor")
+    ErrInvalidMetadata    = errors.New("invalid metadata")
 )
@@ -0,0 +1,307 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"cryptoserver/audit"
+	"cryptoserver/config"
+)
+
+// Tenants keeps a separate CryptoRepository per tenant, so one team's
+// DELETE never touches another's coins. Repositories are built by newRepo
+// when a tenant first creates a coin; reads of an unknown tenant see an
+// empty repository without allocating one.
+//
+// Upstream fetches are shared by giving every tenant the same PriceSource:
+// with a pricecache in front, tenants refreshing the same symbol cost one
+// upstream call.
+type Tenants struct {
+	newRepo func(tenant string) CryptoRepository
+
+	mu    sync.Mutex
+	repos map[string]CryptoRepository
+	// blank is built by newRepo and never written to; see blankRepo.
+	blank CryptoRepository
+}
+
+// NewTenants builds tenant repositories with newRepo.
+func NewTenants(newRepo func(tenant string) CryptoRepository) *Tenants {
+	return &Tenants{newRepo: newRepo, repos: make(map[string]CryptoRepository)}
+}
+
+// NewMemoryTenants keeps every tenant in memory, all fetching from src.
+func NewMemoryTenants(cfg config.RepositoryConfig, src PriceSource) *Tenants {
+	return NewTenants(func(string) CryptoRepository {
+		return NewMemoryCryptoRepoWithConfig(cfg, src)
+	})
+}
+
+// For returns the repository of tenant; the empty name means
+// config.DefaultTenant.
+func (t *Tenants) For(tenant string) CryptoRepository {
+	tenant = strings.ToLower(strings.TrimSpace(tenant))
+	if tenant == "" {
+		tenant = config.DefaultTenant
+	}
+	return tenantRepo{t: t, name: tenant}
+}
+
+// Names lists the tenants that have created coins, sorted.
+func (t *Tenants) Names() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	names := make([]string, 0, len(t.repos))
+	for name := range t.repos {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// lookup returns the repository of tenant, building it if create is set;
+// nil means the tenant has none yet.
+func (t *Tenants) lookup(tenant string, create bool) CryptoRepository {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.repos[tenant]
+	if !ok && create {
+		r = t.newRepo(tenant)
+		t.repos[tenant] = r
+	}
+	return r
+}
+
+// blankRepo returns an empty repository of the kind newRepo builds, for
+// reads of tenants without one that depend on the storage, such as
+// whether there is an event log.
+func (t *Tenants) blankRepo() CryptoRepository {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.blank == nil {
+		t.blank = t.newRepo(config.DefaultTenant)
+	}
+	return t.blank
+}
+
+// PurgeExpired purges the expired tombstones of every tenant and returns
+// how many coins were purged.
+func (t *Tenants) PurgeExpired(now time.Time) int {
+	t.mu.Lock()
+	repos := slices.Collect(maps.Values(t.repos))
+	t.mu.Unlock()
+	n := 0
+	for _, r := range repos {
+		if sd, ok := r.(SoftDeleter); ok {
+			n += len(sd.PurgeExpired(now))
+		}
+	}
+	return n
+}
+
+// RunPurger calls PurgeExpired every interval until ctx is done.
+func (t *Tenants) RunPurger(ctx context.Context, every time.Duration) {
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-tick.C:
+			if n := t.PurgeExpired(now); n > 0 {
+				slog.Info("purged deleted coins", "count", n)
+			}
+		}
+	}
+}
+
+// CheckHealth checks every tenant repository that can be checked.
+func (t *Tenants) CheckHealth() error {
+	t.mu.Lock()
+	repos := make(map[string]CryptoRepository, len(t.repos))
+	for name, r := range t.repos {
+		repos[name] = r
+	}
+	t.mu.Unlock()
+	var errs []error
+	for name, r := range repos {
+		if hc, ok := r.(HealthChecker); ok {
+			if err := hc.CheckHealth(); err != nil {
+				errs = append(errs, fmt.Errorf("tenant %s: %w", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// tenantRepo is the CryptoRepository view of one tenant.
+type tenantRepo struct {
+	t     *Tenants
+	name  string
+	actor *audit.Actor
+}
+
+// As attributes changes to actor when the tenant repositories record
+// who made them (see Audited).
+func (v tenantRepo) As(actor audit.Actor) CryptoRepository {
+	v.actor = &actor
+	return v
+}
+
+// repo returns the tenant's repository, building it if create is set, as
+// seen by v's actor; nil means the tenant has none yet.
+func (v tenantRepo) repo(create bool) CryptoRepository {
+	r := v.t.lookup(v.name, create)
+	if ar, ok := r.(ActorRepository); ok && v.actor != nil {
+		return ar.As(*v.actor)
+	}
+	return r
+}
+
+func (v tenantRepo) Create(symbol string) (Crypto, error) {
+	return v.repo(true).Create(symbol)
+}
+
+func (v tenantRepo) Get(symbol string) (Crypto, error) {
+	if r := v.repo(false); r != nil {
+		return r.Get(symbol)
+	}
+	return Crypto{}, missing(symbol)
+}
+
+func (v tenantRepo) List() ([]Crypto, error) {
+	if r := v.repo(false); r != nil {
+		return r.List()
+	}
+	return []Crypto{}, nil
+}
+
+func (v tenantRepo) Find(q ListQuery) (Page, error) {
+	if r := v.repo(false); r != nil {
+		return Find(r, q)
+	}
+	return q.Apply(nil)
+}
+
+func (v tenantRepo) Delete(symbol string) error {
+	if r := v.repo(false); r != nil {
+		return r.Delete(symbol)
+	}
+	return missing(symbol)
+}
+
+func (v tenantRepo) RefreshPrice(symbol string) (Crypto, error) {
+	if r := v.repo(false); r != nil {
+		return r.RefreshPrice(symbol)
+	}
+	return Crypto{}, missing(symbol)
+}
+
+func (v tenantRepo) DeleteIf(symbol string, ok Precondition) error {
+	if r := v.repo(false); r != nil {
+		return DeleteIf(r, symbol, ok)
+	}
+	return missing(symbol)
+}
+
+func (v tenantRepo) RefreshPriceIf(symbol string, ok Precondition) (Crypto, error) {
+	if r := v.repo(false); r != nil {
+		return RefreshPriceIf(r, symbol, ok)
+	}
+	return Crypto{}, missing(symbol)
+}
+
+func (v tenantRepo) History(symbol string) ([]PriceRecord, error) {
+	if r := v.repo(false); r != nil {
+		return r.History(symbol)
+	}
+	return nil, missing(symbol)
+}
+
+func (v tenantRepo) Stats(symbol string) (PriceStats, error) {
+	if r := v.repo(false); r != nil {
+		return r.Stats(symbol)
+	}
+	return PriceStats{}, missing(symbol)
+}
+
+func (v tenantRepo) Anomalies(symbol string) ([]Anomaly, error) {
+	if r := v.repo(false); r != nil {
+		return r.Anomalies(symbol)
+	}
+	return nil, missing(symbol)
+}
+
+func (v tenantRepo) UpdateMetadata(symbol string, p MetadataPatch, ok Precondition) (Crypto, error) {
+	if me, is := v.repo(false).(MetadataEditor); is {
+		return me.UpdateMetadata(symbol, p, ok)
+	}
+	return Crypto{}, missing(symbol)
+}
+
+func (v tenantRepo) Restore(symbol string) (Crypto, error) {
+	if sd, ok := v.repo(false).(SoftDeleter); ok {
+		return sd.Restore(symbol)
+	}
+	return Crypto{}, missing(symbol)
+}
+
+func (v tenantRepo) ListDeleted() ([]Crypto, error) {
+	if sd, ok := v.repo(false).(SoftDeleter); ok {
+		return sd.ListDeleted()
+	}
+	return []Crypto{}, nil
+}
+
+// PurgeExpired of a view purges its tenant only; Tenants.PurgeExpired
+// covers all.
+func (v tenantRepo) PurgeExpired(now time.Time) []string {
+	if sd, ok := v.repo(false).(SoftDeleter); ok {
+		return sd.PurgeExpired(now)
+	}
+	return nil
+}
+
+// ListAt and Events see a tenant without a repository as an empty one of
+// the configured storage: its log is empty, or there is none.
+func (v tenantRepo) ListAt(t time.Time) ([]Crypto, error) {
+	r := v.repo(false)
+	if r == nil {
+		r = v.t.blankRepo()
+	}
+	if el, ok := r.(EventLog); ok {
+		return el.ListAt(t)
+	}
+	return nil, ErrNoEventLog
+}
+
+func (v tenantRepo) Events(after int64, limit int) ([]Event, error) {
+	r := v.repo(false)
+	if r == nil {
+		r = v.t.blankRepo()
+	}
+	if el, ok := r.(EventLog); ok {
+		return el.Events(after, limit)
+	}
+	return nil, ErrNoEventLog
+}
+
+// CheckHealth covers all tenants, so readiness probes on any tenant's view
+// see a wedged one.
+func (v tenantRepo) CheckHealth() error { return v.t.CheckHealth() }
+
+// missing is what a tenant without a repository answers for symbol,
+// matching MemoryCryptoRepo.
+func missing(symbol string) error {
+	if strings.TrimSpace(symbol) == "" {
+		return ErrInvalidSymbol
+	}
+	return ErrNotFound
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"cryptoserver/config"
+)
+
+func TestTenantsIsolateCoins(t *testing.T) {
+	src := &scriptedSource{quotes: []Quote{{Price: 100}}}
+	tenants := NewMemoryTenants(config.Default().Repository, src)
+	a, b := tenants.For("team-a"), tenants.For("team-b")
+
+	if _, err := a.Create("btc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Create("btc"); err != nil {
+		t.Fatalf("second tenant creating the same coin: %v", err)
+	}
+	if _, err := b.RefreshPrice("btc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Delete("btc"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.Get("btc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted coin Get error = %v, want ErrNotFound", err)
+	}
+	hist, err := b.History("btc")
+	if err != nil || len(hist) != 2 {
+		t.Errorf("other tenant's history = %d records, %v; want 2 untouched", len(hist), err)
+	}
+	if got := tenants.Names(); !slices.Equal(got, []string{"team-a", "team-b"}) {
+		t.Errorf("Names() = %v", got)
+	}
+}
+
+func TestTenantsUnknownTenantIsEmpty(t *testing.T) {
+	src := &scriptedSource{quotes: []Quote{{Price: 100}}}
+	tenants := NewMemoryTenants(config.Default().Repository, src)
+	if _, err := tenants.For("").Create("btc"); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := tenants.For(config.DefaultTenant).List(); err != nil || len(list) != 1 {
+		t.Errorf("default tenant list = %v, %v; want the coin created without a tenant", list, err)
+	}
+
+	ghost := tenants.For("ghost")
+	if list, err := ghost.List(); err != nil || list == nil || len(list) != 0 {
+		t.Errorf("List() = %#v, %v; want empty", list, err)
+	}
+	if _, err := ghost.Get("btc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get error = %v, want ErrNotFound", err)
+	}
+	if err := ghost.Delete(" "); !errors.Is(err, ErrInvalidSymbol) {
+		t.Errorf("Delete(blank) error = %v, want ErrInvalidSymbol", err)
+	}
+	if slices.Contains(tenants.Names(), "ghost") {
+		t.Error("reads allocated a repository for an unknown tenant")
+	}
+	if err := ghost.(HealthChecker).CheckHealth(); err != nil {
+		t.Errorf("CheckHealth: %v", err)
+	}
+
+	// Whether there is an event log depends on the storage, not on
+	// whether the tenant has coins yet.
+	if _, err := ghost.(EventLog).Events(0, 10); !errors.Is(err, ErrNoEventLog) {
+		t.Errorf("memory Events error = %v, want ErrNoEventLog", err)
+	}
+	if _, err := ghost.(EventLog).ListAt(time.Now()); !errors.Is(err, ErrNoEventLog) {
+		t.Errorf("memory ListAt error = %v, want ErrNoEventLog", err)
+	}
+	events := NewTenants(func(string) CryptoRepository { return NewEventCryptoRepoWithConfig(config.Default().Repository, src) })
+	if list, err := events.For("ghost").(EventLog).Events(0, 10); err != nil || list == nil || len(list) != 0 {
+		t.Errorf("events Events = %#v, %v; want empty", list, err)
+	}
+	if list, err := events.For("ghost").(EventLog).ListAt(time.Now()); err != nil || len(list) != 0 {
+		t.Errorf("events ListAt = %#v, %v; want empty", list, err)
+	}
+	if len(events.Names()) != 0 {
+		t.Error("event log reads allocated a repository for an unknown tenant")
+	}
+}
@@ -0,0 +1,19 @@
+package server
+
+import (
+	"net/http"
+)
+
+// GET /crypto/{symbol}/anomalies
+func (s *Server) handleAnomalies(w http.ResponseWriter, r *http.Request) {
+	sym, ok := symbolParam(w, r)
+	if !ok {
+		return
+	}
+	list, err := s.repoFor(r).Anomalies(sym)
+	if err != nil {
+		writeErr(w, symbolError(err, sym))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"symbol": sym, "anomalies": list})
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cryptoserver/audit"
+	"cryptoserver/auth"
+)
+
+// Bounds of the limit parameter of GET /audit.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// actorOf is who a change made by r is attributed to in the audit log.
+func (s *Server) actorOf(r *http.Request) audit.Actor {
+	a := audit.Actor{
+		RequestID: RequestIDFromContext(r.Context()),
+		Client:    clientIP(r, s.rateLimit.TrustProxy),
+	}
+	if id, ok := auth.IdentityFromContext(r.Context()); ok {
+		a.Subject, a.Method = id.Subject, id.Method
+	}
+	return a
+}
+
+// GET /audit?symbol=&from=&to=&limit= — changes to the caller's tenant,
+// oldest first; limit keeps the newest.
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	q := audit.Query{Tenant: s.tenantOf(r), Limit: defaultAuditLimit}
+	params := r.URL.Query()
+	q.Symbol = strings.ToLower(strings.TrimSpace(params.Get("symbol")))
+	for name, dst := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		if v := params.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeErr(w, errInvalidQuery.WithDetail("param", name).WithDetail("value", v))
+				return
+			}
+			*dst = t
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			writeErr(w, errInvalidQuery.WithDetail("param", "limit").WithDetail("value", v))
+			return
+		}
+		q.Limit = n
+	}
+	entries := []audit.Entry{}
+	if s.audit != nil {
+		var err error
+		if entries, err = s.audit.Find(q); err != nil {
+			writeErr(w, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"entries": entries})
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"cryptoserver/audit"
+	"cryptoserver/auth"
+	"cryptoserver/config"
+	"cryptoserver/repository"
+)
+
+func TestAuditRecordsCaller(t *testing.T) {
+	log := audit.NewMemoryStore(100)
+	tenants := repository.NewTenants(func(tenant string) repository.CryptoRepository {
+		return repository.NewAudited(newStubRepo(), log, tenant)
+	})
+	ks := auth.NewKeyStore(config.AuthConfig{Enabled: true, Keys: []config.APIKeyConfig{
+		{Name: "a-writer", Scope: config.ScopeWrite, Key: testWriteKey, Tenant: "team-a"},
+		{Name: "ops", Scope: config.ScopeAdmin, Key: testAdminKey},
+	}})
+	logger, _ := newTestLogger()
+	h := NewWithConfig(config.Default().Server, tenants.For(config.DefaultTenant), &fakeUpstream{coins: 3},
+		WithTenants(tenants), WithKeyStore(ks), WithAuditLog(log)).Handler(logger)
+
+	for _, step := range []struct{ method, path, key, body string }{
+		{"POST", "/crypto", testWriteKey, `{"symbol":"btc"}`},
+		{"PUT", "/crypto/btc/refresh", testWriteKey, ""},
+		{"POST", "/crypto", testAdminKey, `{"symbol":"eth"}`},
+	} {
+		if rec := doTenant(h, step.method, step.path, step.key, "", step.body); rec.Code >= 300 {
+			t.Fatalf("%s %s: %d %s", step.method, step.path, rec.Code, rec.Body)
+		}
+	}
+
+	rec := doTenant(h, "GET", "/audit?symbol=BTC", testAdminKey, "team-a", "")
+	var body struct{ Entries []audit.Entry }
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("GET /audit: %d %s", rec.Code, rec.Body)
+	}
+	if len(body.Entries) != 2 {
+		t.Fatalf("team-a entries = %+v, want create and refresh", body.Entries)
+	}
+	for _, e := range body.Entries {
+		if e.Tenant != "team-a" || e.Subject != "a-writer" || e.Method != "api_key" || e.RequestID == "" || e.Client == "" {
+			t.Errorf("entry = %+v, want the caller recorded", e)
+		}
+	}
+
+	if rec := doTenant(h, "GET", "/audit", testWriteKey, "", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("write key reading the audit log: %d, want 403", rec.Code)
+	}
+	rec = doTenant(h, "GET", "/audit?to=2000-01-01T00:00:00Z", testAdminKey, "", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "{\"entries\":[]}\n" {
+		t.Errorf("empty window: %d %q", rec.Code, rec.Body)
+	}
+	if rec := doTenant(h, "GET", "/audit?limit=5000", testAdminKey, "", ""); rec.Code != http.StatusBadRequest || errCode(rec) != CodeInvalidQuery {
+		t.Errorf("limit over max: %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"cryptoserver/auth"
+)
+
+// apiKeyHeader carries the API key of a request.
+const apiKeyHeader = "X-API-Key"
+
+// Authenticate rejects requests without an API key or bearer token of the
+// scope their route needs, when the key store is enabled, and stores the
+// caller's identity in the request context (see auth.IdentityFromContext).
+// Failed attempts are charged to the client IP's rate limit budget.
+// Unknown routes pass through to the 404/405 answers.
+func (s *Server) Authenticate() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !s.keys.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+			_, pattern := s.mux.Handler(r)
+			need, known := s.scopes[pattern]
+			if !known || need == auth.Public {
+				next.ServeHTTP(w, r)
+				return
+			}
+			id, apiErr := s.identify(r)
+			if apiErr != nil {
+				if !s.chargeIP(w, r) {
+					return
+				}
+				s.challenge(w, apiErr)
+				writeErr(w, apiErr)
+				return
+			}
+			if !id.Scope.Allows(need) {
+				writeErr(w, errForbidden.WithDetail("required_scope", need).WithDetail("scope", id.Scope))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), id)))
+		})
+	}
+}
+
+// identify authenticates r by its X-API-Key or, failing that, its bearer
+// token.
+func (s *Server) identify(r *http.Request) (auth.Identity, *APIError) {
+	if presented := r.Header.Get(apiKeyHeader); presented != "" {
+		key, ok := s.keys.Authenticate(presented)
+		if !ok {
+			return auth.Identity{}, errBadCredentials
+		}
+		return auth.Identity{Subject: key.Name, Scope: key.Scope, Method: "api_key", Tenant: key.Tenant}, nil
+	}
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" || s.jwt == nil {
+		return auth.Identity{}, errMissingCredentials
+	}
+	id, err := s.jwt.Verify(strings.TrimSpace(token), time.Now())
+	switch {
+	case errors.Is(err, auth.ErrTokenExpired):
+		return auth.Identity{}, withCause(errTokenExpired, err)
+	case err != nil:
+		return auth.Identity{}, withCause(errBadToken, err)
+	}
+	return id, nil
+}
+
+// challenge sets WWW-Authenticate for the schemes the server accepts,
+// flagging a presented but rejected bearer token.
+func (s *Server) challenge(w http.ResponseWriter, e *APIError) {
+	w.Header().Add("WWW-Authenticate", `ApiKey header="`+apiKeyHeader+`"`)
+	if s.jwt == nil {
+		return
+	}
+	c := `Bearer realm="cryptoserver"`
+	if e.Err != nil {
+		c += `, error="invalid_token"`
+	}
+	w.Header().Add("WWW-Authenticate", c)
+}
+
+// GET /admin/keys — keys without their secrets; a tenant-bound admin sees
+// its own tenant's keys only.
+func (s *Server) handleListKeys(w http.ResponseWriter, r *http.Request) {
+	keys := s.keys.List()
+	if tenant := boundTenant(r); tenant != "" {
+		keys = slices.DeleteFunc(keys, func(k auth.Key) bool { return k.Tenant != tenant })
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"keys": keys})
+}
+
+// boundTenant is the tenant r's caller is bound to, or "" for callers that
+// may act on every tenant.
+func boundTenant(r *http.Request) string {
+	id, _ := auth.IdentityFromContext(r.Context())
+	return id.Tenant
+}
+
+// createdKey is the POST /admin/keys answer; Key is shown only here.
+type createdKey struct {
+	auth.Key
+	Secret string `json:"key"`
+}
+
+// POST /admin/keys {name, scope, tenant}
+func (s *Server) handleCreateKey(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name   string     `json:"name"`
+		Scope  auth.Scope `json:"scope"`
+		Tenant string     `json:"tenant"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, errInvalidJSON)
+		return
+	}
+	// A tenant-bound admin only hands out keys for its own tenant.
+	if tenant := boundTenant(r); tenant != "" {
+		if req.Tenant != "" && req.Tenant != tenant {
+			writeErr(w, errTenantForbidden.WithDetail("tenant", req.Tenant))
+			return
+		}
+		req.Tenant = tenant
+	}
+	k, secret, err := s.keys.Create(req.Name, req.Scope, req.Tenant)
+	if err != nil {
+		writeErr(w, mapRepoError(err).WithDetail("name", req.Name))
+		return
+	}
+	writeJSON(w, http.StatusCreated, createdKey{Key: k, Secret: secret})
+}
+
+// DELETE /admin/keys/{name} — a tenant-bound admin can only revoke its
+// own tenant's keys; others are answered as unknown.
+func (s *Server) handleRevokeKey(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := s.keys.RevokeFor(name, boundTenant(r)); err != nil {
+		writeErr(w, mapRepoError(err).WithDetail("name", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, nil)
+}
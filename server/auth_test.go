@@ -0,0 +1,229 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cryptoserver/auth"
+	"cryptoserver/config"
+)
+
+const (
+	testReadKey  = "read-key-0123456789"
+	testWriteKey = "write-key-0123456789"
+	testAdminKey = "admin-key-0123456789"
+)
+
+// newAuthServer serves a stub repo holding btc behind the full middleware
+// stack with one key per scope.
+func newAuthServer(t *testing.T) http.Handler {
+	t.Helper()
+	keys := auth.NewKeyStore(config.AuthConfig{Enabled: true, Keys: []config.APIKeyConfig{
+		{Name: "reader", Scope: config.ScopeRead, Key: testReadKey},
+		{Name: "writer", Scope: config.ScopeWrite, Key: testWriteKey},
+		{Name: "admin", Scope: config.ScopeAdmin, Key: testAdminKey},
+	}})
+	repo := newStubRepo()
+	if _, err := repo.Create("btc"); err != nil {
+		t.Fatal(err)
+	}
+	logger, _ := newTestLogger()
+	return NewWithConfig(config.Default().Server, repo, &fakeUpstream{coins: 3}, WithKeyStore(keys)).Handler(logger)
+}
+
+func doAuth(h http.Handler, method, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(apiKeyHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthScopes(t *testing.T) {
+	h := newAuthServer(t)
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		key    string
+		body   string
+		status int
+		code   ErrorCode
+	}{
+		{name: "public health", method: "GET", path: "/healthz", status: 200},
+		{name: "public docs", method: "GET", path: "/openapi.json", status: 200},
+		{name: "no key", method: "GET", path: "/crypto", status: 401, code: CodeUnauthenticated},
+		{name: "unknown key", method: "GET", path: "/crypto", key: "guess-0123456789", status: 401, code: CodeUnauthenticated},
+		{name: "read get", method: "GET", path: "/crypto/btc", key: testReadKey, status: 200},
+		{name: "read metrics", method: "GET", path: "/metrics", key: testReadKey, status: 403},
+		{name: "admin metrics", method: "GET", path: "/metrics", key: testAdminKey, status: 200},
+		{name: "read delete", method: "DELETE", path: "/crypto/btc", key: testReadKey, status: 403, code: CodeForbidden},
+		{name: "read refresh", method: "PUT", path: "/crypto/btc/refresh", key: testReadKey, status: 403, code: CodeForbidden},
+		{name: "write refresh", method: "PUT", path: "/crypto/btc/refresh", key: testWriteKey, status: 200},
+		{name: "write create", method: "POST", path: "/crypto", key: testWriteKey, body: `{"symbol":"eth"}`, status: 201},
+		{name: "write admin", method: "GET", path: "/admin/cache", key: testWriteKey, status: 403, code: CodeForbidden},
+		{name: "admin cache", method: "GET", path: "/admin/cache", key: testAdminKey, status: 200},
+		{name: "admin delete", method: "DELETE", path: "/crypto/eth", key: testAdminKey, status: 200},
+		{name: "unknown route", method: "GET", path: "/nope", status: 404, code: CodeRouteNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := doAuth(h, tc.method, tc.path, tc.key, tc.body)
+			if rec.Code != tc.status {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tc.status, rec.Body)
+			}
+			if tc.code == "" {
+				return
+			}
+			var body errorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Code != tc.code {
+				t.Errorf("body = %s, want code %s", rec.Body, tc.code)
+			}
+			if body.RequestID == "" {
+				t.Errorf("error envelope lacks request_id: %s", rec.Body)
+			}
+			if tc.status == 401 && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+			if tc.status == 403 && body.Details["required_scope"] == nil {
+				t.Errorf("403 does not name the required scope: %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestAuthKeyLifecycle(t *testing.T) {
+	h := newAuthServer(t)
+
+	rec := doAuth(h, "POST", "/admin/keys", testWriteKey, `{"name":"ci","scope":"write"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("create key with write scope: status %d, want 403", rec.Code)
+	}
+	rec = doAuth(h, "POST", "/admin/keys", testAdminKey, `{"name":"ci","scope":"write"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create key: status %d (%s)", rec.Code, rec.Body)
+	}
+	var created struct {
+		Name string `json:"name"`
+		Key  string `json:"key"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || created.Key == "" {
+		t.Fatalf("create key body = %s", rec.Body)
+	}
+
+	if rec := doAuth(h, "PUT", "/crypto/btc/refresh", created.Key, ""); rec.Code != http.StatusOK {
+		t.Fatalf("new key refresh: status %d (%s)", rec.Code, rec.Body)
+	}
+	rec = doAuth(h, "GET", "/admin/keys", testAdminKey, "")
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), created.Key) || !strings.Contains(rec.Body.String(), `"ci"`) {
+		t.Fatalf("list keys = %d %s; want ci listed without its secret", rec.Code, rec.Body)
+	}
+
+	if rec := doAuth(h, "DELETE", "/admin/keys/ci", testAdminKey, ""); rec.Code != http.StatusOK {
+		t.Fatalf("revoke: status %d (%s)", rec.Code, rec.Body)
+	}
+	if rec := doAuth(h, "GET", "/crypto", created.Key, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked key: status %d, want 401", rec.Code)
+	}
+}
+
+func TestAuthDisabledByDefault(t *testing.T) {
+	logger, _ := newTestLogger()
+	h := newTestServer(newStubRepo()).Handler(logger)
+	if rec := doAuth(h, "POST", "/crypto", "", `{"symbol":"btc"}`); rec.Code != http.StatusCreated {
+		t.Errorf("create without key on default server: status %d", rec.Code)
+	}
+}
+
+const testJWTSecret = "server-test-secret-0123456789abcdef"
+
+// hs256Token signs claims with testJWTSecret.
+func hs256Token(claims map[string]any) string {
+	enc := base64.RawURLEncoding
+	cb, _ := json.Marshal(claims)
+	signed := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc.EncodeToString(cb)
+	mac := hmac.New(sha256.New, []byte(testJWTSecret))
+	mac.Write([]byte(signed))
+	return signed + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuthBearerToken(t *testing.T) {
+	cfg := config.Default().Auth
+	cfg.Enabled = true
+	cfg.JWT.HS256Secret = testJWTSecret
+	jwt, err := auth.NewJWTVerifier(cfg.JWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newStubRepo()
+	if _, err := repo.Create("btc"); err != nil {
+		t.Fatal(err)
+	}
+	s := NewWithConfig(config.Default().Server, repo, &fakeUpstream{coins: 3}, WithKeyStore(auth.NewKeyStore(cfg)), WithJWTVerifier(jwt))
+	var seen auth.Identity
+	h := s.Authenticate()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = auth.IdentityFromContext(r.Context())
+		s.mux.ServeHTTP(w, r)
+	}))
+
+	exp := time.Now().Add(time.Hour).Unix()
+	cases := []struct {
+		name      string
+		method    string
+		auth      string
+		status    int
+		code      ErrorCode
+		challenge string
+	}{
+		{name: "reader token", method: "GET", auth: "Bearer " + hs256Token(map[string]any{"sub": "alice", "exp": exp, "roles": "read"}), status: 200},
+		{name: "reader token write", method: "PUT", auth: "Bearer " + hs256Token(map[string]any{"sub": "alice", "exp": exp, "roles": "read"}), status: 403, code: CodeForbidden},
+		{name: "writer token write", method: "PUT", auth: "bearer " + hs256Token(map[string]any{"sub": "bob", "exp": exp, "roles": []string{"read", "write"}}), status: 200},
+		{name: "no roles", method: "GET", auth: "Bearer " + hs256Token(map[string]any{"sub": "carol", "exp": exp}), status: 403, code: CodeForbidden},
+		{name: "expired", method: "GET", auth: "Bearer " + hs256Token(map[string]any{"sub": "alice", "exp": time.Now().Add(-time.Hour).Unix(), "roles": "read"}),
+			status: 401, code: CodeTokenExpired, challenge: `error="invalid_token"`},
+		{name: "tampered", method: "GET", auth: "Bearer " + hs256Token(map[string]any{"sub": "alice", "exp": exp, "roles": "read"}) + "x",
+			status: 401, code: CodeUnauthenticated, challenge: `error="invalid_token"`},
+		{name: "missing", method: "GET", status: 401, code: CodeUnauthenticated, challenge: `Bearer realm="cryptoserver"`},
+		{name: "basic scheme", method: "GET", auth: "Basic YWxpY2U6c2VjcmV0", status: 401, code: CodeUnauthenticated},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			seen = auth.Identity{}
+			path := "/crypto/btc"
+			if tc.method == "PUT" {
+				path += "/refresh"
+			}
+			req := httptest.NewRequest(tc.method, path, nil)
+			if tc.auth != "" {
+				req.Header.Set("Authorization", tc.auth)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tc.status {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tc.status, rec.Body)
+			}
+			if tc.challenge != "" && !strings.Contains(strings.Join(rec.Header().Values("WWW-Authenticate"), "\n"), tc.challenge) {
+				t.Errorf("WWW-Authenticate = %q, want it to contain %q", rec.Header().Values("WWW-Authenticate"), tc.challenge)
+			}
+			if tc.code != "" {
+				var body errorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Code != tc.code {
+					t.Errorf("body = %s, want code %s", rec.Body, tc.code)
+				}
+				return
+			}
+			if seen.Method != "jwt" || seen.Subject == "" {
+				t.Errorf("handler identity = %+v, want a jwt subject", seen)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"net/http"
+
+	"cryptoserver/pricecache"
+)
+
+// cacheStatus is the GET /admin/cache body; stats are omitted when the
+// server runs without a price cache.
+type cacheStatus struct {
+	Enabled bool `json:"enabled"`
+	*pricecache.Stats
+}
+
+// GET /admin/cache — hit/miss counters of the price cache.
+func (s *Server) handleCacheStats(w http.ResponseWriter, r *http.Request) {
+	if s.cache == nil {
+		writeJSON(w, http.StatusOK, cacheStatus{})
+		return
+	}
+	st := s.cache.Stats()
+	writeJSON(w, http.StatusOK, cacheStatus{Enabled: true, Stats: &st})
+}
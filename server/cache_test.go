@@ -0,0 +1,42 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cryptoserver/pricecache"
+)
+
+type staticCache pricecache.Stats
+
+func (c staticCache) Stats() pricecache.Stats { return pricecache.Stats(c) }
+
+func TestCacheStats(t *testing.T) {
+	srv := newTestServer(newStubRepo())
+
+	get := func() map[string]any {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/cache", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", rec.Code)
+		}
+		var body map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+
+	if body := get(); body["enabled"] != false || len(body) != 1 {
+		t.Errorf("without cache: %v, want only enabled=false", body)
+	}
+
+	srv.cache = staticCache{Hits: 3, Misses: 1, HitRatio: 0.75}
+	body := get()
+	if body["enabled"] != true || body["hits"] != 3.0 || body["misses"] != 1.0 || body["hit_ratio"] != 0.75 {
+		t.Errorf("with cache: %v", body)
+	}
+}
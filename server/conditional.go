@@ -0,0 +1,102 @@
+package server
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"cryptoserver/repository"
+)
+
+// etagOf is the strong entity tag of a coin's representations: its
+// version, plus its last update to tell a coin created anew after a purge
+// from the one before.
+func etagOf(c repository.Crypto) string {
+	return fmt.Sprintf(`"%d-%x"`, c.Version, c.LastUpdated.UnixNano())
+}
+
+// modifiedAt is when the view of c last changed: its latest refresh,
+// failed or not, or metadata edit. History and stats change with the
+// price only.
+func modifiedAt(c repository.Crypto) time.Time {
+	t := c.LastUpdated
+	if c.LastRefreshAt.After(t) {
+		t = c.LastRefreshAt
+	}
+	if m := c.MetadataUpdatedAt; m != nil && m.After(t) {
+		t = *m
+	}
+	return t
+}
+
+// listETag is the tag of a list of coins. It is weak because the list
+// order is not stable, so equal tags do not mean equal bytes.
+func listETag(items []repository.Crypto) string {
+	tags := make([]string, 0, len(items))
+	for _, c := range items {
+		tags = append(tags, c.Symbol+etagOf(c))
+	}
+	slices.Sort(tags)
+	h := fnv.New64a()
+	for _, tag := range tags {
+		h.Write([]byte(tag))
+	}
+	return fmt.Sprintf(`W/"%x"`, h.Sum64())
+}
+
+// etagMatches reports whether the If-Match or If-None-Match header value
+// list names etag. Strong comparison, as If-Match needs, fails on weak
+// tags.
+func etagMatches(list, etag string, strong bool) bool {
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		switch {
+		case tag == "*":
+			return true
+		case strong:
+			if tag == etag && !strings.HasPrefix(tag, "W/") {
+				return true
+			}
+		case strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/"):
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the ETag and, unless modified is zero, Last-Modified
+// headers, and answers 304 if r shows the client already has that
+// representation. If-None-Match takes precedence over If-Modified-Since.
+func notModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	h := w.Header()
+	h.Set("ETag", etag)
+	if !modified.IsZero() {
+		h.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !etagMatches(inm, etag, false) {
+			return false
+		}
+	} else {
+		t, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		// Last-Modified has one-second resolution.
+		if err != nil || modified.IsZero() || modified.Truncate(time.Second).After(t) {
+			return false
+		}
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// ifMatch is the precondition r's If-Match header sets on a write, nil
+// without one.
+func ifMatch(r *http.Request) repository.Precondition {
+	list := r.Header.Get("If-Match")
+	if list == "" {
+		return nil
+	}
+	return func(c repository.Crypto) bool { return etagMatches(list, etagOf(c), true) }
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cryptoserver/config"
+	"cryptoserver/repository"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	srv := newTestServer(repository.NewMemoryCryptoRepoWithConfig(config.Default().Repository, stubSource{price: 100}))
+	do := func(method, path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	create := httptest.NewRecorder()
+	srv.ServeHTTP(create, httptest.NewRequest("POST", "/crypto", strings.NewReader(`{"symbol":"btc"}`)))
+	get := do("GET", "/crypto/btc")
+	etag, modified := get.Header().Get("ETag"), get.Header().Get("Last-Modified")
+	if etag == "" || etag != create.Header().Get("ETag") || modified == "" {
+		t.Fatalf("validators: ETag %q (create %q), Last-Modified %q", etag, create.Header().Get("ETag"), modified)
+	}
+	list := do("GET", "/crypto").Header().Get("ETag")
+	if !strings.HasPrefix(list, `W/"`) {
+		t.Errorf("list ETag = %q, want a weak tag", list)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		path   string
+		header []string
+		want   int
+	}{
+		{"same etag", "/crypto/btc", []string{"If-None-Match", etag}, http.StatusNotModified},
+		{"other etag", "/crypto/btc", []string{"If-None-Match", `"0-0"`}, http.StatusOK},
+		{"history", "/crypto/btc/history", []string{"If-None-Match", `"0-0", ` + etag}, http.StatusNotModified},
+		{"not modified since", "/crypto/btc/stats", []string{"If-Modified-Since", modified}, http.StatusNotModified},
+		{"modified since", "/crypto/btc", []string{"If-Modified-Since", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)}, http.StatusOK},
+		{"etag wins", "/crypto/btc", []string{"If-None-Match", `"0-0"`, "If-Modified-Since", modified}, http.StatusOK},
+		{"list", "/crypto", []string{"If-None-Match", list}, http.StatusNotModified},
+	} {
+		if rec := do("GET", tc.path, tc.header...); rec.Code != tc.want {
+			t.Errorf("%s: %d, want %d", tc.name, rec.Code, tc.want)
+		} else if rec.Code == http.StatusNotModified && rec.Body.Len() != 0 {
+			t.Errorf("%s: 304 with a body %s", tc.name, rec.Body)
+		}
+	}
+
+	refresh := do("PUT", "/crypto/btc/refresh", "If-Match", etag)
+	if refresh.Code != http.StatusOK || refresh.Header().Get("ETag") == etag {
+		t.Fatalf("refresh: %d, ETag %q", refresh.Code, refresh.Header().Get("ETag"))
+	}
+	if rec := do("GET", "/crypto/btc", "If-None-Match", etag); rec.Code != http.StatusOK {
+		t.Errorf("old etag after refresh: %d, want 200", rec.Code)
+	}
+	if rec := do("GET", "/crypto", "If-None-Match", list); rec.Code != http.StatusOK {
+		t.Errorf("old list etag after refresh: %d, want 200", rec.Code)
+	}
+	for _, method := range []string{"PUT", "DELETE"} {
+		path := "/crypto/btc"
+		if method == "PUT" {
+			path += "/refresh"
+		}
+		if rec := do(method, path, "If-Match", etag); rec.Code != http.StatusPreconditionFailed || errCode(rec) != CodePreconditionFailed {
+			t.Errorf("%s with stale If-Match: %d %s", method, rec.Code, rec.Body)
+		}
+	}
+	if rec := do("DELETE", "/crypto/btc", "If-Match", refresh.Header().Get("ETag")); rec.Code != http.StatusOK {
+		t.Errorf("delete with current If-Match: %d %s", rec.Code, rec.Body)
+	}
+}
@@ -10,18 +10,19 @@ import (
 func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
     var req struct{ Symbol string `json:"symbol"` }
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        writeErr(w, http.StatusBadRequest, "invalid json")
+        writeErr(w, errInvalidJSON)
         return
     }
     sym := strings.TrimSpace(req.Symbol)
     if sym == "" {
-        writeErr(w, http.StatusBadRequest, "symbol required")
+        writeErr(w, errSymbolRequired)
         return
     }
-    c, err := s.repo.Create(sym)
+    c, err := s.repoFor(r).Create(sym)
     if err != nil {
-        writeMappedError(w, err, nil)
+        writeErr(w, symbolError(err, sym))
         return
     }
+    w.Header().Set("ETag", etagOf(c))
     writeCrypto(w, http.StatusCreated, toCryptoView(c))
 }
@@ -2,19 +2,19 @@ package server
 
 import (
     "net/http"
-    "strings"
+
+    "cryptoserver/repository"
 )
 
-// DELETE /crypto/{symbol}
+// DELETE /crypto/{symbol} — with If-Match, only while the coin still has
+// that ETag.
 func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
-    // Ensure no extra segments after symbol
-    sym := strings.TrimPrefix(r.URL.Path, "/crypto/")
-    if sym == "" || strings.Contains(sym, "/") {
-        writeErr(w, http.StatusNotFound, "not found")
+    sym, ok := symbolParam(w, r)
+    if !ok {
         return
     }
-    if err := s.repo.Delete(sym); err != nil {
-        writeMappedError(w, err, map[int]string{http.StatusNotFound: "not found"})
+    if err := repository.DeleteIf(s.repoFor(r), sym, ifMatch(r)); err != nil {
+        writeErr(w, symbolError(err, sym))
         return
     }
     writeJSON(w, http.StatusOK, map[string]any{})
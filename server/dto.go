@@ -11,14 +11,50 @@ type CryptoView struct {
     Name         string    `json:"name"`
     CurrentPrice float64   `json:"current_price"`
     LastUpdated  time.Time `json:"last_updated"`
+    // Cached, Stale and Provider describe the latest price record (see
+    // PriceRecord).
+    Cached   bool   `json:"cached,omitempty"`
+    Stale    bool   `json:"stale,omitempty"`
+    Provider string `json:"provider,omitempty"`
+    // DeletedAt is set on deleted coins listed with include_deleted.
+    DeletedAt *time.Time `json:"deleted_at,omitempty"`
+    // DisplayName, Tags and Notes are the user's metadata (see
+    // repository.Metadata).
+    DisplayName string   `json:"display_name,omitempty"`
+    Tags        []string `json:"tags,omitempty"`
+    Notes       string   `json:"notes,omitempty"`
+    // RefreshPolicy is omitted for coins refreshed on request only.
+    RefreshPolicy *repository.RefreshPolicy `json:"refresh_policy,omitempty"`
+    // LastRefreshError says why the latest refresh failed.
+    LastRefreshError string `json:"last_refresh_error,omitempty"`
+    // NextRefreshAt is when the automatic refresher is due to refresh the
+    // coin; a past time means at its next run outside quiet hours.
+    NextRefreshAt *time.Time `json:"next_refresh_at,omitempty"`
 }
 
 func toCryptoView(c repository.Crypto) CryptoView {
-    return CryptoView{
-        Symbol:       c.Symbol,
-        Name:         c.Name,
-        CurrentPrice: c.CurrentPrice,
-        LastUpdated:  c.LastUpdated,
+    v := CryptoView{
+        Symbol:           c.Symbol,
+        Name:             c.Name,
+        CurrentPrice:     c.CurrentPrice,
+        LastUpdated:      c.LastUpdated,
+        DeletedAt:        c.DeletedAt,
+        DisplayName:      c.DisplayName,
+        Tags:             c.Tags,
+        Notes:            c.Notes,
+        LastRefreshError: c.LastRefreshError,
     }
+    if c.RefreshPolicy != (repository.RefreshPolicy{}) {
+        p := c.RefreshPolicy
+        v.RefreshPolicy = &p
+    }
+    if next, ok := c.NextRefreshAt(); ok {
+        v.NextRefreshAt = &next
+    }
+    if n := len(c.History); n > 0 {
+        last := c.History[n-1]
+        v.Cached, v.Stale, v.Provider = last.Cached, last.Stale, last.Provider
+    }
+    return v
 }
 
@@ -2,37 +2,203 @@ package server
 
 import (
     "errors"
+    "fmt"
+    "log/slog"
+    "maps"
+    "math"
     "net/http"
+    "strconv"
+    "time"
 
+    "cryptoserver/auth"
+    "cryptoserver/gecko/geckoclient"
     "cryptoserver/repository"
 )
 
-// mapRepoError converts repository/domain errors into HTTP status + default message.
-func mapRepoError(err error) (int, string) {
+// ErrorCode is a stable machine-readable identifier of an API error.
+// Clients should branch on the code, never on the human message.
+type ErrorCode string
+
+const (
+    CodeInvalidJSON         ErrorCode = "INVALID_JSON"
+    CodeSymbolRequired      ErrorCode = "SYMBOL_REQUIRED"
+    CodeInvalidSymbol       ErrorCode = "INVALID_SYMBOL"
+    CodeCoinAlreadyExists   ErrorCode = "COIN_ALREADY_EXISTS"
+    CodeCoinNotFound        ErrorCode = "COIN_NOT_FOUND"
+    CodeCoinNotDeleted      ErrorCode = "COIN_NOT_DELETED"
+    CodeRouteNotFound       ErrorCode = "ROUTE_NOT_FOUND"
+    CodeMethodNotAllowed    ErrorCode = "METHOD_NOT_ALLOWED"
+    CodeNameUnavailable     ErrorCode = "NAME_UNAVAILABLE"
+    CodePriceUnavailable    ErrorCode = "PRICE_UNAVAILABLE"
+    CodePriceRejected       ErrorCode = "PRICE_REJECTED"
+    CodeUpstreamUnavailable ErrorCode = "UPSTREAM_UNAVAILABLE"
+    CodeUpstreamRateLimited ErrorCode = "UPSTREAM_RATE_LIMITED"
+    CodeUnauthenticated     ErrorCode = "UNAUTHENTICATED"
+    CodeTokenExpired        ErrorCode = "TOKEN_EXPIRED"
+    CodeForbidden           ErrorCode = "FORBIDDEN"
+    CodeKeyAlreadyExists    ErrorCode = "KEY_ALREADY_EXISTS"
+    CodeKeyNotFound         ErrorCode = "KEY_NOT_FOUND"
+    CodeInvalidKeyRequest   ErrorCode = "INVALID_KEY_REQUEST"
+    CodeInvalidTenant       ErrorCode = "INVALID_TENANT"
+    CodeRateLimited         ErrorCode = "RATE_LIMITED"
+    CodeInvalidQuery        ErrorCode = "INVALID_QUERY"
+    CodeEventLogUnavailable ErrorCode = "EVENT_LOG_UNAVAILABLE"
+    CodeEventsTrimmed       ErrorCode = "EVENTS_TRIMMED"
+    CodePreconditionFailed  ErrorCode = "PRECONDITION_FAILED"
+    CodeInvalidMetadata     ErrorCode = "INVALID_METADATA"
+    CodeInternal            ErrorCode = "INTERNAL_ERROR"
+)
+
+// APIError is the typed error model shared by mapRepoError and all handlers.
+// Message is safe to show to clients; the wrapped cause is only logged.
+type APIError struct {
+    Status  int
+    Code    ErrorCode
+    Message string
+    Details map[string]any
+    Err     error
+    // RetryAfter, when set, is sent as the Retry-After header.
+    RetryAfter time.Duration
+}
+
+func newAPIError(status int, code ErrorCode, msg string) *APIError {
+    return &APIError{Status: status, Code: code, Message: msg}
+}
+
+func (e *APIError) Error() string {
+    if e.Err != nil {
+        return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Err)
+    }
+    return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *APIError) Unwrap() error { return e.Err }
+
+// WithDetail returns a copy of e with key set in Details.
+func (e *APIError) WithDetail(key string, v any) *APIError {
+    out := *e
+    out.Details = maps.Clone(e.Details)
+    if out.Details == nil {
+        out.Details = make(map[string]any, 1)
+    }
+    out.Details[key] = v
+    return &out
+}
+
+// Errors produced by handlers themselves (not by the repository).
+var (
+    errInvalidJSON      = newAPIError(http.StatusBadRequest, CodeInvalidJSON, "invalid json")
+    errSymbolRequired   = newAPIError(http.StatusBadRequest, CodeSymbolRequired, "symbol required")
+    errRouteNotFound    = newAPIError(http.StatusNotFound, CodeRouteNotFound, "not found")
+    errMethodNotAllowed = newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method not allowed")
+    errInternal         = newAPIError(http.StatusInternalServerError, CodeInternal, "internal error")
+
+    errMissingCredentials = newAPIError(http.StatusUnauthorized, CodeUnauthenticated, "api key required")
+    errBadCredentials     = newAPIError(http.StatusUnauthorized, CodeUnauthenticated, "invalid api key")
+    errBadToken           = newAPIError(http.StatusUnauthorized, CodeUnauthenticated, "invalid bearer token")
+    errTokenExpired       = newAPIError(http.StatusUnauthorized, CodeTokenExpired, "bearer token expired or not yet valid")
+    errForbidden          = newAPIError(http.StatusForbidden, CodeForbidden, "insufficient scope")
+    errTenantForbidden    = newAPIError(http.StatusForbidden, CodeForbidden, "credentials are bound to another tenant")
+    errInvalidTenant      = newAPIError(http.StatusBadRequest, CodeInvalidTenant, "invalid tenant")
+    errRateLimited        = newAPIError(http.StatusTooManyRequests, CodeRateLimited, "too many requests")
+    errInvalidQuery       = newAPIError(http.StatusBadRequest, CodeInvalidQuery, "invalid query parameter")
+)
+
+// withCause returns a copy of e carrying err for the logs.
+func withCause(e *APIError, err error) *APIError {
+    out := *e
+    out.Err = err
+    return &out
+}
+
+// mapRepoError converts repository/domain errors into the API error model.
+// Messages are fixed per code so wrapped upstream text never reaches clients.
+func mapRepoError(err error) *APIError {
+    var apiErr *APIError
+    if errors.As(err, &apiErr) {
+        return apiErr
+    }
+    var e *APIError
     switch {
     case errors.Is(err, repository.ErrInvalidSymbol):
-        return http.StatusBadRequest, err.Error()
+        e = newAPIError(http.StatusBadRequest, CodeInvalidSymbol, repository.ErrInvalidSymbol.Error())
     case errors.Is(err, repository.ErrAlreadyExists):
-        return http.StatusConflict, err.Error()
+        e = newAPIError(http.StatusConflict, CodeCoinAlreadyExists, repository.ErrAlreadyExists.Error())
     case errors.Is(err, repository.ErrNotFound):
-        return http.StatusNotFound, "not found"
-    case errors.Is(err, repository.ErrNameUnavailable), errors.Is(err, repository.ErrPriceUnavailable):
-        return http.StatusBadGateway, err.Error()
+        e = newAPIError(http.StatusNotFound, CodeCoinNotFound, "not found")
+    case errors.Is(err, repository.ErrNotDeleted):
+        e = newAPIError(http.StatusConflict, CodeCoinNotDeleted, repository.ErrNotDeleted.Error())
+    case errors.Is(err, repository.ErrNameUnavailable):
+        e = newAPIError(http.StatusBadGateway, CodeNameUnavailable, repository.ErrNameUnavailable.Error())
+    case errors.Is(err, repository.ErrPriceUnavailable):
+        e = newAPIError(http.StatusBadGateway, CodePriceUnavailable, repository.ErrPriceUnavailable.Error())
+    case errors.Is(err, repository.ErrPriceRejected):
+        e = newAPIError(http.StatusBadGateway, CodePriceRejected, repository.ErrPriceRejected.Error())
+    case errors.Is(err, repository.ErrRateLimited):
+        e = newAPIError(http.StatusServiceUnavailable, CodeUpstreamRateLimited, repository.ErrRateLimited.Error())
+        e.RetryAfter = minRetryAfter
     case errors.Is(err, repository.ErrServiceUnavailable):
-        return http.StatusServiceUnavailable, err.Error()
+        e = newAPIError(http.StatusServiceUnavailable, CodeUpstreamUnavailable, repository.ErrServiceUnavailable.Error())
+    case errors.Is(err, repository.ErrNoEventLog):
+        e = newAPIError(http.StatusBadRequest, CodeEventLogUnavailable, repository.ErrNoEventLog.Error())
+    case errors.Is(err, repository.ErrEventsTrimmed):
+        e = newAPIError(http.StatusGone, CodeEventsTrimmed, repository.ErrEventsTrimmed.Error())
+    case errors.Is(err, repository.ErrPreconditionFailed):
+        e = newAPIError(http.StatusPreconditionFailed, CodePreconditionFailed, repository.ErrPreconditionFailed.Error())
+    case errors.Is(err, repository.ErrInvalidMetadata):
+        e = newAPIError(http.StatusBadRequest, CodeInvalidMetadata, repository.ErrInvalidMetadata.Error())
+    case errors.Is(err, auth.ErrKeyExists):
+        e = newAPIError(http.StatusConflict, CodeKeyAlreadyExists, auth.ErrKeyExists.Error())
+    case errors.Is(err, auth.ErrKeyNotFound):
+        e = newAPIError(http.StatusNotFound, CodeKeyNotFound, auth.ErrKeyNotFound.Error())
+    case errors.Is(err, auth.ErrInvalidKey):
+        e = newAPIError(http.StatusBadRequest, CodeInvalidKeyRequest, auth.ErrInvalidKey.Error())
     default:
-        return http.StatusInternalServerError, err.Error()
+        e = newAPIError(errInternal.Status, errInternal.Code, errInternal.Message)
+    }
+    var ra *geckoclient.RetryAfterError
+    if errors.As(err, &ra) && ra.After > 0 {
+        e.RetryAfter = max(ra.After, minRetryAfter)
     }
+    e.Err = err
+    return e
 }
 
-// writeMappedError writes a JSON error using mapping rules and optional per-status overrides for message.
-func writeMappedError(w http.ResponseWriter, err error, overrides map[int]string) {
-    status, msg := mapRepoError(err)
-    if overrides != nil {
-        if m, ok := overrides[status]; ok && m != "" {
-            msg = m
-        }
-    }
-    writeErr(w, status, msg)
+// minRetryAfter is the Retry-After sent for rate-limited requests when the
+// upstream gave no better hint; the header has one-second resolution.
+const minRetryAfter = time.Second
+
+// symbolError maps a repository error and attaches the requested symbol.
+func symbolError(err error, sym string) *APIError {
+    return mapRepoError(err).WithDetail("symbol", sym)
+}
+
+// errorResponse is the JSON error envelope. Error duplicates Message for
+// clients written against the original {"error": "..."} shape.
+type errorResponse struct {
+    Error     string         `json:"error"`
+    Code      ErrorCode      `json:"code"`
+    Message   string         `json:"message"`
+    RequestID string         `json:"request_id,omitempty"`
+    Details   map[string]any `json:"details,omitempty"`
 }
 
+// writeErr writes err as a JSON error envelope. Errors that are not an
+// *APIError are classified with mapRepoError first.
+func writeErr(w http.ResponseWriter, err error) {
+    e := mapRepoError(err)
+    reqID := w.Header().Get(requestIDHeader)
+    if e.Status >= http.StatusInternalServerError && e.Err != nil {
+        slog.Error("request failed", "request_id", reqID, "code", e.Code, "err", e.Err)
+    }
+    if e.RetryAfter > 0 {
+        w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+    }
+    writeJSON(w, e.Status, errorResponse{
+        Error:     e.Message,
+        Code:      e.Code,
+        Message:   e.Message,
+        RequestID: reqID,
+        Details:   e.Details,
+    })
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cryptoserver/gecko/geckoclient"
+	"cryptoserver/repository"
+)
+
+func TestMapRepoErrorCodes(t *testing.T) {
+	upstream := errors.New(`Get "http://127.0.0.1:5050/simple/price": dial tcp: connection refused`)
+	cases := []struct {
+		err    error
+		status int
+		code   ErrorCode
+	}{
+		{repository.ErrInvalidSymbol, http.StatusBadRequest, CodeInvalidSymbol},
+		{repository.ErrAlreadyExists, http.StatusConflict, CodeCoinAlreadyExists},
+		{repository.ErrNotFound, http.StatusNotFound, CodeCoinNotFound},
+		{fmt.Errorf("%w: %v", repository.ErrNameUnavailable, upstream), http.StatusBadGateway, CodeNameUnavailable},
+		{fmt.Errorf("%w: %v", repository.ErrPriceUnavailable, upstream), http.StatusBadGateway, CodePriceUnavailable},
+		{fmt.Errorf("%w: non_finite: NaN", repository.ErrPriceRejected), http.StatusBadGateway, CodePriceRejected},
+		{fmt.Errorf("%w: %v", repository.ErrServiceUnavailable, upstream), http.StatusServiceUnavailable, CodeUpstreamUnavailable},
+		{fmt.Errorf("%w: %v", repository.ErrRateLimited, upstream), http.StatusServiceUnavailable, CodeUpstreamRateLimited},
+		{upstream, http.StatusInternalServerError, CodeInternal},
+		{errSymbolRequired, http.StatusBadRequest, CodeSymbolRequired},
+	}
+	for _, tc := range cases {
+		e := mapRepoError(tc.err)
+		if e.Status != tc.status || e.Code != tc.code {
+			t.Errorf("mapRepoError(%v) = %d %s, want %d %s", tc.err, e.Status, e.Code, tc.status, tc.code)
+		}
+		if strings.Contains(e.Message, "dial tcp") {
+			t.Errorf("mapRepoError(%v) leaked upstream text in message %q", tc.err, e.Message)
+		}
+	}
+}
+
+func TestWriteErrEnvelope(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set(requestIDHeader, "req-1")
+	err := fmt.Errorf("%w: %v", repository.ErrServiceUnavailable, errors.New("dial tcp: refused"))
+	writeErr(rec, symbolError(err, "btc"))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	var body errorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Code != CodeUpstreamUnavailable {
+		t.Errorf("code = %q, want %q", body.Code, CodeUpstreamUnavailable)
+	}
+	if body.Error == "" || body.Error != body.Message {
+		t.Errorf("error = %q, message = %q; want equal and non-empty", body.Error, body.Message)
+	}
+	if body.RequestID != "req-1" {
+		t.Errorf("request_id = %q, want %q", body.RequestID, "req-1")
+	}
+	if body.Details["symbol"] != "btc" {
+		t.Errorf("details.symbol = %v, want btc", body.Details["symbol"])
+	}
+}
+
+func TestWriteErrRetryAfter(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "upstream hint",
+			err: fmt.Errorf("%w: %w", repository.ErrRateLimited,
+				&geckoclient.RetryAfterError{Err: geckoclient.ErrRateLimited, After: 2500 * time.Millisecond}),
+			want: "3",
+		},
+		{name: "no hint", err: fmt.Errorf("%w: 429", repository.ErrRateLimited), want: "1"},
+		{
+			name: "outage with hint",
+			err: fmt.Errorf("%w: %w", repository.ErrServiceUnavailable,
+				&geckoclient.RetryAfterError{Err: geckoclient.ErrServiceUnavailable, After: 10 * time.Second}),
+			want: "10",
+		},
+		{name: "outage", err: fmt.Errorf("%w: dial tcp", repository.ErrServiceUnavailable), want: ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeErr(rec, tc.err)
+			if rec.Code != http.StatusServiceUnavailable {
+				t.Errorf("status = %d, want 503", rec.Code)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tc.want {
+				t.Errorf("Retry-After = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"cryptoserver/repository"
+)
+
+// Bounds of the limit parameter of GET /events.
+const (
+	defaultEventsLimit = 100
+	maxEventsLimit     = 1000
+)
+
+// GET /events?after=&limit= — the tenant's events with a sequence number
+// above after, oldest first. Consumers pass the seq of the last event
+// they saw to continue.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	var after int64
+	if v := params.Get("after"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			writeErr(w, errInvalidQuery.WithDetail("param", "after").WithDetail("value", v))
+			return
+		}
+		after = n
+	}
+	limit := defaultEventsLimit
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxEventsLimit {
+			writeErr(w, errInvalidQuery.WithDetail("param", "limit").WithDetail("value", v))
+			return
+		}
+		limit = n
+	}
+	el, ok := s.repoFor(r).(repository.EventLog)
+	if !ok {
+		writeErr(w, repository.ErrNoEventLog)
+		return
+	}
+	events, err := el.Events(after, limit)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"events": events})
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"cryptoserver/config"
+	"cryptoserver/repository"
+)
+
+func TestListAsOfAndEvents(t *testing.T) {
+	repo := repository.NewEventCryptoRepoWithConfig(config.Default().Repository, stubSource{price: 100})
+	srv := newTestServer(repo)
+	get := func(path string, out any) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: %d %s", path, rec.Code, rec.Body)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := repo.Create("btc"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	onlyBTC := time.Now()
+	time.Sleep(time.Millisecond)
+	if _, err := repo.Create("eth"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete("btc"); err != nil {
+		t.Fatal(err)
+	}
+
+	var list struct{ Cryptos []CryptoView }
+	get("/crypto?as_of="+url.QueryEscape(onlyBTC.Format(time.RFC3339Nano)), &list)
+	if len(list.Cryptos) != 1 || list.Cryptos[0].Symbol != "btc" {
+		t.Errorf("as_of before eth was added = %+v, want btc only", list.Cryptos)
+	}
+	get("/crypto", &list)
+	if len(list.Cryptos) != 1 || list.Cryptos[0].Symbol != "eth" {
+		t.Errorf("current list = %+v, want eth only", list.Cryptos)
+	}
+
+	var page struct{ Events []repository.Event }
+	get("/events?after=1&limit=1", &page)
+	if len(page.Events) != 1 || page.Events[0].Seq != 2 || page.Events[0].Type != repository.EventCoinCreated || page.Events[0].Symbol != "eth" {
+		t.Fatalf("second event = %+v", page.Events)
+	}
+	get("/events?after=2", &page)
+	if len(page.Events) != 1 || page.Events[0].Type != repository.EventCoinDeleted || page.Events[0].Symbol != "btc" {
+		t.Errorf("events after 2 = %+v, want the btc deletion", page.Events)
+	}
+	get("/events?after=3", &page)
+	if len(page.Events) != 0 {
+		t.Errorf("events after the last = %+v, want none", page.Events)
+	}
+}
@@ -2,20 +2,20 @@ package server
 
 import (
     "net/http"
-    "strings"
 )
 
 // GET /crypto/{symbol}
 func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
-    sym := strings.TrimPrefix(r.URL.Path, "/crypto/")
-    sym = strings.TrimSpace(sym)
-    if sym == "" || strings.Contains(sym, "/") {
-        writeErr(w, http.StatusNotFound, "not found")
+    sym, ok := symbolParam(w, r)
+    if !ok {
         return
     }
-    c, err := s.repo.Get(sym)
+    c, err := s.repoFor(r).Get(sym)
     if err != nil {
-        writeMappedError(w, err, map[int]string{http.StatusNotFound: "not found"})
+        writeErr(w, symbolError(err, sym))
+        return
+    }
+    if notModified(w, r, etagOf(c), modifiedAt(c)) {
         return
     }
     // Do not include history in this view
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"cryptoserver/gecko/geckoclient"
+	"cryptoserver/repository"
+)
+
+// Upstream is what the health endpoints need from the price source;
+// *geckoclient.Client implements it.
+type Upstream interface {
+	Ping(ctx context.Context) error
+	CoinCount() int
+	Status() geckoclient.Status
+}
+
+// GET /healthz — the process is up and serving.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ok"})
+}
+
+type readyCheck struct {
+	Name       string  `json:"name"`
+	OK         bool    `json:"ok"`
+	Detail     string  `json:"detail,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// GET /readyz — coin list loaded, storage writable, upstream reachable.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if s.draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{
+			"status": "not_ready",
+			"checks": []readyCheck{{Name: "shutdown", Detail: "server is draining"}},
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.readyTimeout)
+	defer cancel()
+
+	checks := []struct {
+		name string
+		fn   func(context.Context) (string, error)
+	}{
+		{"coin_list", func(context.Context) (string, error) {
+			n := s.upstream.CoinCount()
+			if n == 0 {
+				return "", fmt.Errorf("coin list is empty")
+			}
+			return fmt.Sprintf("%d symbols", n), nil
+		}},
+		{"storage", func(context.Context) (string, error) {
+			hc, ok := s.repo.(repository.HealthChecker)
+			if !ok {
+				return "no health check", nil
+			}
+			return "", hc.CheckHealth()
+		}},
+		{"upstream", func(ctx context.Context) (string, error) {
+			return "", s.upstream.Ping(ctx)
+		}},
+	}
+
+	results := make([]readyCheck, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runCheck(ctx, c.name, c.fn)
+		}()
+	}
+	wg.Wait()
+
+	status, code := "ready", http.StatusOK
+	for _, c := range results {
+		if !c.OK {
+			status, code = "not_ready", http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, code, map[string]any{"status": status, "checks": results})
+}
+
+// runCheck runs fn, giving up when ctx expires even if fn does not.
+func runCheck(ctx context.Context, name string, fn func(context.Context) (string, error)) readyCheck {
+	start := time.Now()
+	type result struct {
+		detail string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		d, err := fn(ctx)
+		done <- result{d, err}
+	}()
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		res.err = fmt.Errorf("timed out: %w", ctx.Err())
+	}
+	c := readyCheck{Name: name, OK: res.err == nil, Detail: res.detail}
+	if res.err != nil {
+		c.Detail = res.err.Error()
+	}
+	c.DurationMs = float64(time.Since(start)) / float64(time.Millisecond)
+	return c
+}
+
+// GET /status/upstream
+func (s *Server) handleUpstreamStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.upstream.Status())
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"cryptoserver/gecko/geckoclient"
+)
+
+// fakeUpstream is a controllable Upstream for health endpoint tests.
+type fakeUpstream struct {
+	mu      sync.Mutex
+	coins   int
+	pingErr error
+	// hang makes Ping block until its context is done.
+	hang bool
+}
+
+func (f *fakeUpstream) setPingErr(err error) {
+	f.mu.Lock()
+	f.pingErr = err
+	f.mu.Unlock()
+}
+
+func (f *fakeUpstream) Ping(ctx context.Context) error {
+	f.mu.Lock()
+	hang, err := f.hang, f.pingErr
+	f.mu.Unlock()
+	if hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return err
+}
+
+func (f *fakeUpstream) CoinCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.coins
+}
+
+func (f *fakeUpstream) Status() geckoclient.Status {
+	return geckoclient.Status{
+		BaseURL: "http://fake",
+		Coins:   f.CoinCount(),
+		Calls:   map[string]geckoclient.CallStatus{"price": {Requests: 4, Failures: 1, Retries: 2, ErrorRate: 0.25}},
+		Breaker: geckoclient.BreakerStatus{State: "closed", ConsecutiveFailures: 1},
+	}
+}
+
+// unhealthyRepo is a stubRepo whose storage check fails.
+type unhealthyRepo struct{ *stubRepo }
+
+func (unhealthyRepo) CheckHealth() error { return errors.New("disk full") }
+
+type readyBody struct {
+	Status string       `json:"status"`
+	Checks []readyCheck `json:"checks"`
+}
+
+func getReady(t *testing.T, srv *Server) (int, readyBody) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var body readyBody
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("readyz body: %v", err)
+	}
+	return rec.Code, body
+}
+
+func failedChecks(b readyBody) []string {
+	var out []string
+	for _, c := range b.Checks {
+		if !c.OK {
+			out = append(out, c.Name)
+		}
+	}
+	return out
+}
+
+func TestHealthz(t *testing.T) {
+	srv := newTestServer(newStubRepo())
+	srv.upstream = &fakeUpstream{pingErr: errors.New("down")}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("healthz status = %d, want 200 even when upstream is down", rec.Code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	cases := []struct {
+		name     string
+		server   func() *Server
+		upstream *fakeUpstream
+		timeout  time.Duration
+		status   int
+		failed   []string
+	}{
+		{name: "all good", upstream: &fakeUpstream{coins: 10}, status: 200},
+		{name: "coin list empty", upstream: &fakeUpstream{}, status: 503, failed: []string{"coin_list"}},
+		{name: "upstream down", upstream: &fakeUpstream{coins: 10, pingErr: errors.New("dial tcp")}, status: 503, failed: []string{"upstream"}},
+		{name: "upstream slow", upstream: &fakeUpstream{coins: 10, hang: true}, timeout: 20 * time.Millisecond, status: 503, failed: []string{"upstream"}},
+		{
+			name:     "storage broken",
+			server:   func() *Server { return newTestServer(unhealthyRepo{newStubRepo()}) },
+			upstream: &fakeUpstream{coins: 10},
+			status:   503,
+			failed:   []string{"storage"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newTestServer(newStubRepo())
+			if tc.server != nil {
+				srv = tc.server()
+			}
+			srv.upstream = tc.upstream
+			if tc.timeout > 0 {
+				srv.readyTimeout = tc.timeout
+			}
+			start := time.Now()
+			code, body := getReady(t, srv)
+			if code != tc.status {
+				t.Fatalf("status = %d, want %d (%+v)", code, tc.status, body)
+			}
+			if len(body.Checks) != 3 {
+				t.Fatalf("got %d checks, want 3", len(body.Checks))
+			}
+			got := failedChecks(body)
+			if len(got) != len(tc.failed) || (len(got) > 0 && got[0] != tc.failed[0]) {
+				t.Errorf("failed checks = %v, want %v", got, tc.failed)
+			}
+			if tc.timeout > 0 && time.Since(start) > tc.timeout+time.Second {
+				t.Errorf("readyz took %v, budget was %v", time.Since(start), tc.timeout)
+			}
+		})
+	}
+}
+
+func TestReadyzFailsWhileDraining(t *testing.T) {
+	srv := newTestServer(newStubRepo())
+	srv.upstream = &fakeUpstream{coins: 10}
+	if code, _ := getReady(t, srv); code != http.StatusOK {
+		t.Fatalf("status before Drain = %d, want 200", code)
+	}
+	srv.Drain()
+	code, body := getReady(t, srv)
+	if code != http.StatusServiceUnavailable || body.Status != "not_ready" {
+		t.Fatalf("after Drain: %d %+v, want 503 not_ready", code, body)
+	}
+	if got := failedChecks(body); len(got) != 1 || got[0] != "shutdown" {
+		t.Errorf("failed checks = %v, want [shutdown]", got)
+	}
+}
+
+func TestUpstreamStatus(t *testing.T) {
+	srv := newTestServer(newStubRepo())
+	srv.upstream = &fakeUpstream{coins: 7}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status/upstream", nil))
+	var body geckoclient.Status
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Coins != 7 || body.Calls["price"].ErrorRate != 0.25 || body.Breaker.State != "closed" {
+		t.Errorf("status = %+v", body)
+	}
+}
@@ -2,26 +2,23 @@ package server
 
 import (
     "net/http"
-    "strings"
 )
 
 // GET /crypto/{symbol}/history
 func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
-    if !strings.HasSuffix(r.URL.Path, "/history") {
-        writeErr(w, http.StatusNotFound, "not found")
+    sym, ok := symbolParam(w, r)
+    if !ok {
         return
     }
-    sym := strings.TrimPrefix(strings.TrimSuffix(r.URL.Path, "/history"), "/crypto/")
-    sym = strings.TrimSpace(sym)
-    if sym == "" || strings.Contains(sym, "/") {
-        writeErr(w, http.StatusNotFound, "not found")
+    // The coin carries its history and the version it is tagged with.
+    c, err := s.repoFor(r).Get(sym)
+    if err != nil {
+        writeErr(w, symbolError(err, sym))
         return
     }
-    hist, err := s.repo.History(sym)
-    if err != nil {
-        writeMappedError(w, err, map[int]string{http.StatusNotFound: "not found"})
+    if notModified(w, r, etagOf(c), c.LastUpdated) {
         return
     }
-    writeJSON(w, http.StatusOK, map[string]any{"symbol": sym, "history": hist})
+    writeJSON(w, http.StatusOK, map[string]any{"symbol": sym, "history": c.History})
 }
 
@@ -15,10 +15,6 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
     _ = json.NewEncoder(w).Encode(v)
 }
 
-func writeErr(w http.ResponseWriter, status int, msg string) {
-    writeJSON(w, status, map[string]any{"error": msg})
-}
-
 // writeCrypto wraps a CryptoView into {"crypto": ...} envelope.
 func writeCrypto(w http.ResponseWriter, status int, v CryptoView) {
     writeJSON(w, status, map[string]any{"crypto": v})
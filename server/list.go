@@ -1,19 +1,136 @@
 package server
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"cryptoserver/repository"
 )
 
-// GET /crypto
+// Bounds of the limit parameter of GET /crypto; without it the whole list
+// is returned.
+const maxListLimit = 1000
+
+// GET /crypto?sort=&order=&min_price=&max_price=&q=&tag=&stale_since=&cursor=&limit=&as_of=&include_deleted=
+// — the tenant's coins, filtered, ordered (by symbol unless sort says
+// otherwise) and paged; next_cursor continues a page cut by limit. With
+// as_of, the list as it was at that time, replayed from the repository's
+// event log; with include_deleted, restorable deleted coins too. The list
+// is tagged with a weak ETag only: a deletion leaves no time to send as
+// Last-Modified.
 func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
-	items, err := s.repo.List()
+	params := r.URL.Query()
+	q, apiErr := listQuery(params)
+	if apiErr != nil {
+		writeErr(w, apiErr)
+		return
+	}
+	var page repository.Page
+	var err error
+	repo := s.repoFor(r)
+	if v := params.Get("as_of"); v != "" {
+		t, perr := time.Parse(time.RFC3339, v)
+		if perr != nil {
+			writeErr(w, errInvalidQuery.WithDetail("param", "as_of").WithDetail("value", v))
+			return
+		}
+		el, ok := repo.(repository.EventLog)
+		if !ok {
+			writeErr(w, repository.ErrNoEventLog)
+			return
+		}
+		var items []repository.Crypto
+		if items, err = el.ListAt(t); err == nil {
+			page, err = q.Apply(items)
+		}
+	} else {
+		page, err = repository.Find(repo, q)
+	}
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		writeErr(w, errInvalidQuery.WithDetail("param", "cursor").WithDetail("value", q.Cursor))
+		return
+	}
 	if err != nil {
-		writeMappedError(w, err, nil)
+		writeErr(w, err)
+		return
+	}
+	if notModified(w, r, listETag(page.Items), time.Time{}) {
 		return
 	}
-	views := make([]CryptoView, 0, len(items))
-	for _, c := range items {
+	views := make([]CryptoView, 0, len(page.Items))
+	for _, c := range page.Items {
 		views = append(views, toCryptoView(c))
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"cryptos": views})
+	resp := map[string]any{"cryptos": views}
+	if page.Next != "" {
+		resp["next_cursor"] = page.Next
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// listQuery reads the filter, order and paging parameters of GET /crypto.
+func listQuery(params url.Values) (repository.ListQuery, *APIError) {
+	invalid := func(param string) (repository.ListQuery, *APIError) {
+		return repository.ListQuery{}, errInvalidQuery.WithDetail("param", param).WithDetail("value", params.Get(param))
+	}
+	q := repository.ListQuery{
+		Sort:   repository.SortField(params.Get("sort")),
+		Text:   params.Get("q"),
+		Cursor: params.Get("cursor"),
+	}
+	if !q.Sort.Valid() {
+		return invalid("sort")
+	}
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return invalid("order")
+	}
+	for _, bound := range []struct {
+		param string
+		dst   **float64
+	}{{"min_price", &q.MinPrice}, {"max_price", &q.MaxPrice}} {
+		if v := params.Get(bound.param); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+				return invalid(bound.param)
+			}
+			*bound.dst = &f
+		}
+	}
+	if tags := params["tag"]; len(tags) > 0 {
+		norm, err := repository.NormalizeTags(tags)
+		if err != nil {
+			return invalid("tag")
+		}
+		q.Tags = norm
+	}
+	if v := params.Get("stale_since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return invalid("stale_since")
+		}
+		q.StaleSince = t
+	}
+	if v := params.Get("include_deleted"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return invalid("include_deleted")
+		}
+		q.IncludeDeleted = b
+	}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxListLimit {
+			return invalid("limit")
+		}
+		q.Limit = n
+	}
+	return q, nil
 }
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestListPagesByCursor(t *testing.T) {
+	srv := newTestServer(newStubRepo())
+	for _, sym := range []string{"stats", "btc", "history", "eth"} {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest("POST", "/crypto", strings.NewReader(`{"symbol":"`+sym+`"}`)))
+	}
+
+	var names []string
+	path := "/crypto?sort=name&order=desc&limit=3"
+	for pages := 0; path != ""; pages++ {
+		if pages > 2 {
+			t.Fatal("paging does not end")
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", path, rec.Code, rec.Body)
+		}
+		var body struct {
+			Cryptos []CryptoView `json:"cryptos"`
+			Next    string       `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range body.Cryptos {
+			names = append(names, c.Name)
+		}
+		path = ""
+		if body.Next != "" {
+			path = "/crypto?sort=name&order=desc&limit=3&cursor=" + url.QueryEscape(body.Next)
+		}
+	}
+	if want := []string{"Stats", "History", "Ethereum", "Bitcoin"}; !slices.Equal(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest("GET", "/crypto?limit=0", nil))
+	if rec.Code != http.StatusBadRequest || errCode(rec) != CodeInvalidQuery {
+		t.Errorf("limit=0: %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"cryptoserver/metrics"
+	"cryptoserver/repository"
+)
+
+// serverMetrics owns the per-Server registry. Process-wide metrics such as
+// upstream call counters live in metrics.Default and are exposed alongside.
+type serverMetrics struct {
+	reg      *metrics.Registry
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+	// route resolves the route pattern a request is counted under.
+	route func(*http.Request) string
+}
+
+func (s *Server) newMetrics() *serverMetrics {
+	reg := metrics.NewRegistry()
+	m := &serverMetrics{
+		reg:   reg,
+		route: s.routeOf,
+		requests: reg.NewCounterVec(
+			"cryptoserver_http_requests_total",
+			"HTTP requests by method, route pattern and status code.",
+			"method", "route", "status",
+		),
+		duration: reg.NewHistogramVec(
+			"cryptoserver_http_request_duration_seconds",
+			"HTTP request latency in seconds by method and route pattern.",
+			metrics.DefaultBuckets,
+			"method", "route",
+		),
+	}
+	reg.NewGaugeFunc("cryptoserver_tracked_coins", "Number of tracked coins.", nil,
+		func(emit func(float64, ...string)) {
+			n := 0
+			s.eachTenant(func(_ string, repo repository.CryptoRepository) {
+				items, _ := repo.List()
+				n += len(items)
+			})
+			emit(float64(n))
+		})
+	reg.NewGaugeFunc("cryptoserver_history_length", "Price history records kept per coin.", []string{"symbol", "tenant"},
+		func(emit func(float64, ...string)) {
+			s.eachTenant(func(tenant string, repo repository.CryptoRepository) {
+				items, _ := repo.List()
+				for _, c := range items {
+					emit(float64(len(c.History)), c.Symbol, tenant)
+				}
+			})
+		})
+	reg.NewGaugeFunc("cryptoserver_last_refresh_age_seconds", "Seconds since the price of a coin was last updated.", []string{"symbol", "tenant"},
+		func(emit func(float64, ...string)) {
+			now := time.Now()
+			s.eachTenant(func(tenant string, repo repository.CryptoRepository) {
+				items, _ := repo.List()
+				for _, c := range items {
+					emit(now.Sub(c.LastUpdated).Seconds(), c.Symbol, tenant)
+				}
+			})
+		})
+	return m
+}
+
+// Instrument records request counts and latency per route pattern.
+// Unmatched requests share one label value to keep cardinality bounded.
+func (m *serverMetrics) Instrument() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := recordResponse(w)
+			next.ServeHTTP(rec, r)
+			route := m.route(r)
+			if route == "" {
+				route = "unmatched"
+			}
+			m.requests.Inc(r.Method, route, strconv.Itoa(rec.Status()))
+			m.duration.Observe(time.Since(start).Seconds(), r.Method, route)
+		})
+	}
+}
+
+// GET /metrics — the series cover every tenant, so callers bound to one
+// are refused.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if tenant := boundTenant(r); tenant != "" {
+		writeErr(w, errTenantForbidden.WithDetail("tenant", tenant))
+		return
+	}
+	w.Header().Set("Content-Type", metrics.ContentType)
+	w.WriteHeader(http.StatusOK)
+	_ = metrics.WriteText(w, s.metrics.reg, metrics.Default)
+}
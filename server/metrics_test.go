@@ -0,0 +1,76 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cryptoserver/config"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	repo := newStubRepo()
+	srv := newTestServer(repo)
+	h := srv.Handler(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	do := func(method, path, body string) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	}
+	do("POST", "/crypto", `{"symbol":"btc"}`)
+	do("PUT", "/crypto/btc/refresh", "")
+	do("GET", "/crypto/btc", "")
+	do("GET", "/crypto/eth", "")
+	do("GET", "/no/such/route", "")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`cryptoserver_http_requests_total{method="POST",route="POST /crypto",status="201"} 1`,
+		`cryptoserver_http_requests_total{method="PUT",route="PUT /crypto/{symbol}/refresh",status="200"} 1`,
+		`cryptoserver_http_requests_total{method="GET",route="GET /crypto/{symbol}",status="200"} 1`,
+		`cryptoserver_http_requests_total{method="GET",route="GET /crypto/{symbol}",status="404"} 1`,
+		`cryptoserver_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`cryptoserver_http_request_duration_seconds_count{method="PUT",route="PUT /crypto/{symbol}/refresh"} 1`,
+		"cryptoserver_tracked_coins 1",
+		`cryptoserver_history_length{symbol="btc",tenant="default"} 2`,
+		`cryptoserver_last_refresh_age_seconds{symbol="btc",tenant="default"} `,
+		"# TYPE cryptoserver_upstream_requests_total counter",
+		"# TYPE cryptoserver_upstream_request_duration_seconds histogram",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+}
+
+// Authenticate and ResolveTenant hand the mux a copy of the request, so the
+// route label must not depend on r.Pattern.
+func TestMetricsRouteBehindTenants(t *testing.T) {
+	h := newTenantServer(
+		config.APIKeyConfig{Name: "a-writer", Scope: config.ScopeWrite, Key: testWriteKey, Tenant: "team-a"},
+		config.APIKeyConfig{Name: "ops", Scope: config.ScopeAdmin, Key: testAdminKey},
+	)
+	doTenant(h, "POST", "/crypto", testWriteKey, "", `{"symbol":"btc"}`)
+	doTenant(h, "GET", "/crypto/btc", testWriteKey, "", "")
+
+	body := doTenant(h, "GET", "/metrics", testAdminKey, "", "").Body.String()
+	for _, want := range []string{
+		`cryptoserver_http_requests_total{method="POST",route="POST /crypto",status="201"} 1`,
+		`cryptoserver_http_requests_total{method="GET",route="GET /crypto/{symbol}",status="200"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output missing %q:\n%s", want, body)
+		}
+	}
+}
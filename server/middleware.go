@@ -0,0 +1,157 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// Middleware decorates an http.Handler.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h so that the first middleware is the outermost one.
+func Chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// Handler returns s wrapped in the default middleware stack:
+// request ids, access logs, metrics, panic recovery, authentication, rate
+// limiting and tenant resolution.
+func (s *Server) Handler(logger *slog.Logger) http.Handler {
+	return Chain(s,
+		RequestID(),
+		AccessLog(logger, s.routeOf),
+		s.metrics.Instrument(),
+		Recover(logger),
+		s.Authenticate(),
+		s.RateLimit(),
+		s.ResolveTenant(),
+	)
+}
+
+// RequestID assigns every request an X-Request-ID (reusing the caller's if
+// present), echoes it on the response and stores it in the request context.
+func RequestID() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, withRequestID(w, r))
+		})
+	}
+}
+
+// routeOf returns the pattern of the route r matches, or "". Middleware
+// outside Authenticate and ResolveTenant cannot read r.Pattern: ServeMux
+// sets it on the request copy those hand on.
+func (s *Server) routeOf(r *http.Request) string {
+	_, pattern := s.mux.Handler(r)
+	return pattern
+}
+
+// AccessLog writes one structured log record per request, naming the
+// route pattern route resolves; a nil route logs r.Pattern.
+func AccessLog(logger *slog.Logger, route func(*http.Request) string) Middleware {
+	if route == nil {
+		route = func(r *http.Request) string { return r.Pattern }
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := recordResponse(w)
+			next.ServeHTTP(rec, r)
+			logger.LogAttrs(r.Context(), slog.LevelInfo, "http request",
+				slog.String("request_id", RequestIDFromContext(r.Context())),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("route", route(r)),
+				slog.Int("status", rec.Status()),
+				slog.Duration("duration", time.Since(start)),
+				slog.Int64("bytes", rec.bytes),
+				slog.String("remote_addr", r.RemoteAddr),
+			)
+		})
+	}
+}
+
+// Recover turns a handler panic into a logged JSON 500 instead of a
+// silently dropped connection. http.ErrAbortHandler is re-raised so the
+// server can abort the response as intended.
+func Recover(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := recordResponse(w)
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+				logger.LogAttrs(r.Context(), slog.LevelError, "handler panic",
+					slog.String("request_id", RequestIDFromContext(r.Context())),
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.Any("panic", v),
+					slog.String("stack", string(debug.Stack())),
+				)
+				if rec.wroteHeader {
+					// Too late for a clean error; make the client see a broken response.
+					panic(http.ErrAbortHandler)
+				}
+				e := *errInternal
+				e.Err = fmt.Errorf("panic: %v", v)
+				writeErr(rec, &e)
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// responseRecorder captures the status and size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+// recordResponse wraps w, reusing an existing recorder from an outer middleware.
+func recordResponse(w http.ResponseWriter) *responseRecorder {
+	if rec, ok := w.(*responseRecorder); ok {
+		return rec
+	}
+	return &responseRecorder{ResponseWriter: w}
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Status is the response status, 200 if the handler wrote nothing.
+func (r *responseRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *responseRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestLogger() (*slog.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return slog.New(slog.NewJSONHandler(&buf, nil)), &buf
+}
+
+// logRecords decodes the JSON lines written by a slog JSON handler.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("log line is not JSON: %q", line)
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func TestRequestIDGeneratedAndPropagated(t *testing.T) {
+	var seen string
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}), RequestID())
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/crypto", nil))
+	id := rec.Header().Get(requestIDHeader)
+	if id == "" || id != seen {
+		t.Fatalf("generated id: header %q, context %q", id, seen)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/crypto", nil)
+	req.Header.Set(requestIDHeader, "client-42")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Header().Get(requestIDHeader); got != "client-42" || seen != "client-42" {
+		t.Fatalf("propagated id: header %q, context %q, want client-42", got, seen)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/crypto", nil)
+	req.Header.Set(requestIDHeader, strings.Repeat("x", maxRequestIDLen+1))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Header().Get(requestIDHeader); len(got) > maxRequestIDLen {
+		t.Fatalf("oversized client id was echoed back (%d bytes)", len(got))
+	}
+}
+
+func TestAccessLogRecordsRequest(t *testing.T) {
+	logger, buf := newTestLogger()
+	repo := newStubRepo()
+	if _, err := repo.Create("btc"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	h := newTestServer(repo).Handler(logger)
+
+	req := httptest.NewRequest(http.MethodGet, "/crypto/btc", nil)
+	req.Header.Set(requestIDHeader, "log-1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	recs := logRecords(t, buf)
+	if len(recs) != 1 {
+		t.Fatalf("got %d log records, want 1: %s", len(recs), buf)
+	}
+	got := recs[0]
+	want := map[string]any{
+		"msg":        "http request",
+		"request_id": "log-1",
+		"method":     "GET",
+		"path":       "/crypto/btc",
+		"route":      "GET /crypto/{symbol}",
+		"status":     float64(200),
+		"bytes":      float64(rec.Body.Len()),
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("log %s = %v, want %v", k, got[k], v)
+		}
+	}
+	if _, ok := got["duration"]; !ok {
+		t.Errorf("log record has no duration: %v", got)
+	}
+}
+
+func TestRecoverReturnsJSON500(t *testing.T) {
+	logger, buf := newTestLogger()
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), RequestID(), AccessLog(logger, nil), Recover(logger))
+
+	req := httptest.NewRequest(http.MethodGet, "/crypto", nil)
+	req.Header.Set(requestIDHeader, "panic-1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	var body errorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if body.Code != CodeInternal || body.RequestID != "panic-1" {
+		t.Errorf("body = %+v, want code %s and request_id panic-1", body, CodeInternal)
+	}
+	if strings.Contains(rec.Body.String(), "boom") {
+		t.Errorf("panic value leaked to client: %s", rec.Body)
+	}
+
+	var sawPanic, sawAccess bool
+	for _, r := range logRecords(t, buf) {
+		switch r["msg"] {
+		case "handler panic":
+			sawPanic = r["panic"] == "boom" && r["stack"] != ""
+		case "http request":
+			sawAccess = r["status"] == float64(500)
+		}
+	}
+	if !sawPanic || !sawAccess {
+		t.Errorf("expected panic and access log records with status 500, got %s", buf)
+	}
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// openAPISpec is the contract for every route served by Server.
+// openapi_test.go checks handlers against it, so update both together.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// GET /openapi.json
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(openAPISpec)
+}
+
+// specDoc is the subset of the OpenAPI document the docs page renders.
+type specDoc struct {
+	Info  specInfo                              `json:"info"`
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+type specInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+}
+
+type specOperation struct {
+	OperationID string `json:"operationId"`
+	Summary     string `json:"summary"`
+	Responses   map[string]struct {
+		Description string `json:"description"`
+		Ref         string `json:"$ref"`
+	} `json:"responses"`
+}
+
+// docsOperation is one row of the docs page.
+type docsOperation struct {
+	Method    string
+	Path      string
+	ID        string
+	Summary   string
+	Responses []docsResponse
+}
+
+type docsResponse struct {
+	Status      string
+	Description string
+}
+
+var specMethods = []string{"get", "post", "put", "patch", "delete"}
+
+// specOperations flattens the spec into a stable, path-sorted list.
+func specOperations(spec []byte) (specDoc, []docsOperation, error) {
+	var doc specDoc
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return doc, nil, err
+	}
+	paths := make([]string, 0, len(doc.Paths))
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+
+	var ops []docsOperation
+	for _, p := range paths {
+		for _, m := range specMethods {
+			raw, ok := doc.Paths[p][m]
+			if !ok {
+				continue
+			}
+			var op specOperation
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return doc, nil, err
+			}
+			codes := make([]string, 0, len(op.Responses))
+			for c := range op.Responses {
+				codes = append(codes, c)
+			}
+			slices.Sort(codes)
+			resps := make([]docsResponse, 0, len(codes))
+			for _, c := range codes {
+				desc := op.Responses[c].Description
+				if ref := op.Responses[c].Ref; ref != "" {
+					desc = strings.TrimPrefix(ref, "#/components/responses/")
+				}
+				resps = append(resps, docsResponse{Status: c, Description: desc})
+			}
+			ops = append(ops, docsOperation{
+				Method:    strings.ToUpper(m),
+				Path:      p,
+				ID:        op.OperationID,
+				Summary:   op.Summary,
+				Responses: resps,
+			})
+		}
+	}
+	return doc, ops, nil
+}
+
+var docsTemplate = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Info.Title}} {{.Info.Version}}</title>
+<style>
+body { font-family: sans-serif; max-width: 960px; margin: 2em auto; color: #222; }
+.op { border: 1px solid #ddd; border-radius: 4px; margin: 1em 0; padding: .5em 1em; }
+.method { display: inline-block; min-width: 5em; font-weight: bold; }
+code { background: #f4f4f4; padding: 0 .3em; }
+ul { margin: .3em 0; }
+</style>
+</head>
+<body>
+<h1>{{.Info.Title}} <small>{{.Info.Version}}</small></h1>
+<p>{{.Info.Description}}</p>
+<p>Machine-readable spec: <a href="/openapi.json"><code>/openapi.json</code></a></p>
+{{range .Ops}}<div class="op" id="{{.ID}}">
+<span class="method">{{.Method}}</span> <code>{{.Path}}</code> — {{.Summary}}
+<ul>{{range .Responses}}<li><code>{{.Status}}</code> {{.Description}}</li>{{end}}</ul>
+</div>
+{{end}}</body>
+</html>
+`))
+
+// GET /docs
+func (s *Server) handleDocs(w http.ResponseWriter, r *http.Request) {
+	doc, ops, err := specOperations(openAPISpec)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_ = docsTemplate.Execute(w, struct {
+		Info specInfo
+		Ops  []docsOperation
+	}{doc.Info, ops})
+}
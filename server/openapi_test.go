@@ -0,0 +1,509 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"cryptoserver/audit"
+	"cryptoserver/config"
+	"cryptoserver/repository"
+)
+
+// openAPIValidator checks JSON values against the schemas of openapi.json.
+// It understands the subset of OpenAPI 3 schema objects the spec uses:
+// $ref, type, properties, required, additionalProperties, items, enum, format.
+type openAPIValidator struct {
+	doc map[string]any
+}
+
+func loadOpenAPI(t *testing.T) *openAPIValidator {
+	t.Helper()
+	var doc map[string]any
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	if v, _ := doc["openapi"].(string); !strings.HasPrefix(v, "3.") {
+		t.Fatalf("openapi version = %q, want 3.x", v)
+	}
+	return &openAPIValidator{doc: doc}
+}
+
+// resolve follows a local JSON pointer reference such as
+// "#/components/schemas/CryptoView".
+func (v *openAPIValidator) resolve(ref string) (map[string]any, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	var cur any = v.doc
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("$ref %q: %q is not an object", ref, part)
+		}
+		if cur, ok = m[part]; !ok {
+			return nil, fmt.Errorf("$ref %q: missing %q", ref, part)
+		}
+	}
+	m, ok := cur.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("$ref %q does not point to an object", ref)
+	}
+	return m, nil
+}
+
+func (v *openAPIValidator) deref(m map[string]any) (map[string]any, error) {
+	for {
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return m, nil
+		}
+		next, err := v.resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		m = next
+	}
+}
+
+func (v *openAPIValidator) validate(schema map[string]any, val any, at string) error {
+	schema, err := v.deref(schema)
+	if err != nil {
+		return err
+	}
+	if val == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable {
+			return nil
+		}
+		return fmt.Errorf("%s: null is not allowed", at)
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, val) {
+		return fmt.Errorf("%s: %v is not one of %v", at, val, enum)
+	}
+	typ, _ := schema["type"].(string)
+	switch typ {
+	case "object":
+		obj, ok := val.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: want object, got %T", at, val)
+		}
+		props, _ := schema["properties"].(map[string]any)
+		if req, ok := schema["required"].([]any); ok {
+			for _, name := range req {
+				if _, ok := obj[name.(string)]; !ok {
+					return fmt.Errorf("%s: missing required property %q", at, name)
+				}
+			}
+		}
+		for name, pv := range obj {
+			if ps, ok := props[name].(map[string]any); ok {
+				if err := v.validate(ps, pv, at+"."+name); err != nil {
+					return err
+				}
+				continue
+			}
+			switch ap := schema["additionalProperties"].(type) {
+			case bool:
+				if !ap {
+					return fmt.Errorf("%s: unexpected property %q", at, name)
+				}
+			case map[string]any:
+				if err := v.validate(ap, pv, at+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		arr, ok := val.([]any)
+		if !ok {
+			return fmt.Errorf("%s: want array, got %T", at, val)
+		}
+		items, _ := schema["items"].(map[string]any)
+		for i, item := range arr {
+			if items == nil {
+				break
+			}
+			if err := v.validate(items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		s, ok := val.(string)
+		if !ok {
+			return fmt.Errorf("%s: want string, got %T", at, val)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				return fmt.Errorf("%s: %q is not a date-time", at, s)
+			}
+		}
+	case "number":
+		if _, ok := val.(float64); !ok {
+			return fmt.Errorf("%s: want number, got %T", at, val)
+		}
+	case "integer":
+		f, ok := val.(float64)
+		if !ok || f != math.Trunc(f) {
+			return fmt.Errorf("%s: want integer, got %v", at, val)
+		}
+	case "boolean":
+		if _, ok := val.(bool); !ok {
+			return fmt.Errorf("%s: want boolean, got %T", at, val)
+		}
+	case "":
+	default:
+		return fmt.Errorf("%s: unsupported schema type %q", at, typ)
+	}
+	return nil
+}
+
+// operation finds the spec path template and operation object for a
+// concrete request path. Literal segments win over {param} segments.
+func (v *openAPIValidator) operation(method, path string) (string, map[string]any, bool) {
+	paths := v.doc["paths"].(map[string]any)
+	path, _, _ = strings.Cut(path, "?")
+	segs := strings.Split(path, "/")
+	best, bestScore := "", -1
+	for tmpl := range paths {
+		tsegs := strings.Split(tmpl, "/")
+		if len(tsegs) != len(segs) {
+			continue
+		}
+		score := 0
+		for i := range tsegs {
+			switch {
+			case strings.HasPrefix(tsegs[i], "{"):
+			case tsegs[i] == segs[i]:
+				score++
+			default:
+				score = -1
+			}
+			if score < 0 {
+				break
+			}
+		}
+		if score > bestScore {
+			best, bestScore = tmpl, score
+		}
+	}
+	if best == "" {
+		return "", nil, false
+	}
+	op, ok := paths[best].(map[string]any)[strings.ToLower(method)].(map[string]any)
+	return best, op, ok
+}
+
+func (v *openAPIValidator) bodySchema(holder map[string]any, contentType string) (map[string]any, error) {
+	holder, err := v.deref(holder)
+	if err != nil {
+		return nil, err
+	}
+	content, ok := holder["content"].(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	media, ok := content[contentType].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("content type %q not documented", contentType)
+	}
+	schema, _ := media["schema"].(map[string]any)
+	return schema, nil
+}
+
+type contractCase struct {
+	name   string
+	method string
+	path   string
+	body   string
+	header map[string]string
+	// badRequest marks bodies that intentionally violate the request schema.
+	badRequest bool
+	setup      func()
+	status     int
+}
+
+func TestHandlersMatchOpenAPI(t *testing.T) {
+	v := loadOpenAPI(t)
+	repo := newStubRepo()
+	upstream := &fakeUpstream{coins: 3}
+	srv := newTestServer(repo)
+	srv.upstream = upstream
+
+	cases := []contractCase{
+		{name: "spec", method: "GET", path: "/openapi.json", status: 200},
+		{name: "docs", method: "GET", path: "/docs", status: 200},
+		{name: "metrics", method: "GET", path: "/metrics", status: 200},
+		{name: "healthz", method: "GET", path: "/healthz", status: 200},
+		{name: "ready", method: "GET", path: "/readyz", status: 200},
+		{
+			name: "not ready", method: "GET", path: "/readyz",
+			setup:  func() { upstream.setPingErr(repository.ErrServiceUnavailable) },
+			status: 503,
+		},
+		{name: "upstream status", method: "GET", path: "/status/upstream", status: 200},
+		{name: "cache disabled", method: "GET", path: "/admin/cache", status: 200},
+		{
+			name: "cache stats", method: "GET", path: "/admin/cache",
+			setup:  func() { srv.cache = staticCache{Hits: 3, Misses: 1, HitRatio: 0.75, TTL: "5s", StaleTTL: "10m0s"} },
+			status: 200,
+		},
+		{name: "create key", method: "POST", path: "/admin/keys", body: `{"name":"ci","scope":"write"}`, status: 201},
+		{name: "create key twice", method: "POST", path: "/admin/keys", body: `{"name":"ci","scope":"read"}`, status: 409},
+		{name: "create key bad scope", method: "POST", path: "/admin/keys", body: `{"name":"x","scope":"root"}`, badRequest: true, status: 400},
+		{name: "list keys", method: "GET", path: "/admin/keys", status: 200},
+		{name: "revoke key", method: "DELETE", path: "/admin/keys/ci", status: 200},
+		{name: "revoke missing key", method: "DELETE", path: "/admin/keys/ci", status: 404},
+		{name: "audit disabled", method: "GET", path: "/audit", status: 200},
+		{name: "empty list", method: "GET", path: "/crypto", status: 200},
+		{name: "create", method: "POST", path: "/crypto", body: `{"symbol":"BTC"}`, status: 201},
+		{name: "create eth", method: "POST", path: "/crypto", body: `{"symbol":"eth"}`, status: 201},
+		{name: "create duplicate", method: "POST", path: "/crypto", body: `{"symbol":"btc"}`, status: 409},
+		{name: "create blank", method: "POST", path: "/crypto", body: `{"symbol":"  "}`, status: 400},
+		{name: "create bad json", method: "POST", path: "/crypto", body: `{`, badRequest: true, status: 400},
+		{name: "create unknown", method: "POST", path: "/crypto", body: `{"symbol":"nope"}`, status: 400},
+		{
+			name: "create upstream down", method: "POST", path: "/crypto", body: `{"symbol":"history"}`,
+			setup:  func() { repo.fail(fmt.Errorf("%w: dial tcp", repository.ErrServiceUnavailable)) },
+			status: 503,
+		},
+		{
+			name: "create no price", method: "POST", path: "/crypto", body: `{"symbol":"history"}`,
+			setup:  func() { repo.fail(fmt.Errorf("%w: not found", repository.ErrPriceUnavailable)) },
+			status: 502,
+		},
+		{name: "list", method: "GET", path: "/crypto", status: 200},
+		{name: "list page", method: "GET", path: "/crypto?sort=price&order=desc&min_price=1&q=e&limit=1", status: 200},
+		{name: "list bad sort", method: "GET", path: "/crypto?sort=volume", status: 400},
+		{name: "list bad cursor", method: "GET", path: "/crypto?cursor=nope", status: 400},
+		{name: "get", method: "GET", path: "/crypto/BTC", status: 200},
+		{name: "get missing", method: "GET", path: "/crypto/xyz", status: 404},
+		{name: "get blank symbol", method: "GET", path: "/crypto/%20", status: 400},
+		{name: "refresh", method: "PUT", path: "/crypto/btc/refresh", status: 200},
+		{name: "refresh missing", method: "PUT", path: "/crypto/xyz/refresh", status: 404},
+		{
+			name: "refresh upstream down", method: "PUT", path: "/crypto/btc/refresh",
+			setup:  func() { repo.fail(fmt.Errorf("%w: dial tcp", repository.ErrServiceUnavailable)) },
+			status: 503,
+		},
+		{
+			name: "refresh rate limited", method: "PUT", path: "/crypto/btc/refresh",
+			setup:  func() { repo.fail(fmt.Errorf("%w: 429", repository.ErrRateLimited)) },
+			status: 503,
+		},
+		{
+			name: "refresh no price", method: "PUT", path: "/crypto/btc/refresh",
+			setup:  func() { repo.fail(fmt.Errorf("%w: not found", repository.ErrPriceUnavailable)) },
+			status: 502,
+		},
+		{
+			name: "refresh rejected", method: "PUT", path: "/crypto/btc/refresh",
+			setup:  func() { repo.fail(fmt.Errorf("%w: non_positive: 0", repository.ErrPriceRejected)) },
+			status: 502,
+		},
+		{name: "no anomalies", method: "GET", path: "/crypto/btc/anomalies", status: 200},
+		{
+			name: "anomalies", method: "GET", path: "/crypto/btc/anomalies",
+			setup: func() {
+				repo.mu.Lock()
+				repo.anomalies["btc"] = []repository.Anomaly{
+					{Raw: "NaN", Timestamp: time.Now(), Provider: "coingecko", Reason: repository.ReasonNonFinite, Quarantined: true},
+					{Price: 1e6, Timestamp: time.Now(), Reason: repository.ReasonDeviation, Reference: 100, Deviation: 9999, Quarantined: true},
+				}
+				repo.mu.Unlock()
+			},
+			status: 200,
+		},
+		{name: "anomalies missing", method: "GET", path: "/crypto/xyz/anomalies", status: 404},
+		{name: "history", method: "GET", path: "/crypto/btc/history", status: 200},
+		{name: "get not modified", method: "GET", path: "/crypto/btc", header: map[string]string{"If-None-Match": "*"}, status: 304},
+		{name: "list not modified", method: "GET", path: "/crypto", header: map[string]string{"If-None-Match": "*"}, status: 304},
+		{name: "history not modified", method: "GET", path: "/crypto/btc/history", header: map[string]string{"If-None-Match": "*"}, status: 304},
+		{name: "stats not modified", method: "GET", path: "/crypto/btc/stats", header: map[string]string{"If-None-Match": "*"}, status: 304},
+		{name: "refresh stale", method: "PUT", path: "/crypto/btc/refresh", header: map[string]string{"If-Match": `"0-0"`}, status: 412},
+		{name: "delete stale", method: "DELETE", path: "/crypto/eth", header: map[string]string{"If-Match": `"0-0"`}, status: 412},
+		{name: "history missing", method: "GET", path: "/crypto/xyz/history", status: 404},
+		{name: "stats", method: "GET", path: "/crypto/btc/stats", status: 200},
+		{name: "stats missing", method: "GET", path: "/crypto/xyz/stats", status: 404},
+		{name: "delete", method: "DELETE", path: "/crypto/eth", status: 200},
+		{name: "delete missing", method: "DELETE", path: "/crypto/eth", status: 404},
+		{
+			name: "audit", method: "GET", path: "/audit?symbol=eth&from=2000-01-01T00:00:00Z&limit=10",
+			setup: func() {
+				log := audit.NewMemoryStore(10)
+				price := 100.0
+				_, _ = log.Append(audit.Entry{Time: time.Now(), Action: audit.ActionCreate, Tenant: config.DefaultTenant, Symbol: "eth", Actor: audit.Actor{Subject: "ci", Method: "api_key", RequestID: "r1", Client: "10.0.0.1"}, PriceAfter: &price})
+				_, _ = log.Append(audit.Entry{Time: time.Now(), Action: audit.ActionDelete, Tenant: config.DefaultTenant, Symbol: "eth", Actor: audit.Actor{Subject: audit.SystemActor}, PriceBefore: &price})
+				srv.audit = log
+			},
+			status: 200,
+		},
+		{name: "audit bad time", method: "GET", path: "/audit?from=yesterday", status: 400},
+		{name: "audit bad limit", method: "GET", path: "/audit?limit=0", status: 400},
+		{name: "events without log", method: "GET", path: "/events", status: 400},
+		{name: "restore missing", method: "POST", path: "/crypto/eth/restore", status: 404},
+		{name: "as_of without log", method: "GET", path: "/crypto?as_of=2026-01-01T00:00:00Z", status: 400},
+		{
+			name: "events", method: "GET", path: "/events?after=0&limit=10",
+			setup: func() {
+				events := repository.NewEventCryptoRepoWithConfig(config.Default().Repository, stubSource{price: 100})
+				_, _ = events.Create("eth")
+				_, _ = events.RefreshPrice("eth")
+				_ = events.Delete("eth")
+				_, _ = events.Create("btc")
+				srv.repo = events
+			},
+			status: 200,
+		},
+		{name: "list with deleted", method: "GET", path: "/crypto?include_deleted=true", status: 200},
+		{name: "restore", method: "POST", path: "/crypto/eth/restore", status: 200},
+		{name: "restore live", method: "POST", path: "/crypto/btc/restore", status: 409},
+		{name: "update", method: "PATCH", path: "/crypto/btc", body: `{"display_name":"Bitcoin (cold)","tags":["DeFi","watch"],"notes":"ledger"}`, status: 200},
+		{name: "update refresh policy", method: "PATCH", path: "/crypto/btc", body: `{"refresh_policy":{"interval":"5m","quiet_hours":{"start":"22:00","end":"06:00"}}}`, status: 200},
+		{name: "update bad interval", method: "PATCH", path: "/crypto/btc", body: `{"refresh_policy":{"interval":"1s"}}`, badRequest: true, status: 400},
+		{name: "update bad tag", method: "PATCH", path: "/crypto/btc", body: `{"tags":["no spaces"]}`, badRequest: true, status: 400},
+		{name: "update unknown field", method: "PATCH", path: "/crypto/btc", body: `{"tag":"defi"}`, badRequest: true, status: 400},
+		{name: "update missing", method: "PATCH", path: "/crypto/xyz", body: `{}`, status: 404},
+		{name: "update stale", method: "PATCH", path: "/crypto/btc", body: `{}`, header: map[string]string{"If-Match": `"0-0"`}, status: 412},
+		{name: "list by tag", method: "GET", path: "/crypto?tag=defi&tag=watch", status: 200},
+		{name: "include_deleted bad", method: "GET", path: "/crypto?include_deleted=maybe", status: 400},
+		{name: "as_of", method: "GET", path: "/crypto?as_of=" + time.Now().Add(time.Hour).Format(time.RFC3339), status: 200},
+		{name: "as_of bad time", method: "GET", path: "/crypto?as_of=now", status: 400},
+		{name: "events bad after", method: "GET", path: "/events?after=-1", status: 400},
+		{
+			name: "events trimmed", method: "GET", path: "/events?after=0",
+			setup: func() {
+				cfg := config.Default().Repository
+				cfg.EventLimit = 1
+				events := repository.NewEventCryptoRepoWithConfig(cfg, stubSource{price: 100})
+				_, _ = events.Create("eth")
+				_, _ = events.Create("btc")
+				srv.repo = events
+			},
+			status: 410,
+		},
+		{name: "as_of trimmed", method: "GET", path: "/crypto?as_of=2000-01-01T00:00:00Z", status: 410},
+	}
+
+	covered := make(map[string]bool)
+	for _, tc := range cases {
+		tmpl, op, ok := v.operation(tc.method, tc.path)
+		if !ok {
+			t.Errorf("%s: %s %s is not documented in openapi.json", tc.name, tc.method, tc.path)
+			continue
+		}
+		covered[tc.method+" "+tmpl] = true
+
+		if rb, ok := op["requestBody"].(map[string]any); ok && !tc.badRequest {
+			schema, err := v.bodySchema(rb, "application/json")
+			if err != nil {
+				t.Fatalf("%s: request body schema: %v", tc.name, err)
+			}
+			var body any
+			if err := json.Unmarshal([]byte(tc.body), &body); err != nil {
+				t.Fatalf("%s: test body is not JSON: %v", tc.name, err)
+			}
+			if err := v.validate(schema, body, "request"); err != nil {
+				t.Errorf("%s: request does not match spec: %v", tc.name, err)
+			}
+		}
+
+		if tc.setup != nil {
+			tc.setup()
+		}
+		req := httptest.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+		for k, val := range tc.header {
+			req.Header.Set(k, val)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+
+		if rec.Code != tc.status {
+			t.Errorf("%s: status = %d, want %d (body %s)", tc.name, rec.Code, tc.status, rec.Body)
+			continue
+		}
+		responses := op["responses"].(map[string]any)
+		resp, ok := responses[strconv.Itoa(rec.Code)].(map[string]any)
+		if !ok {
+			t.Errorf("%s: status %d is not documented for %s %s", tc.name, rec.Code, tc.method, tmpl)
+			continue
+		}
+		if rec.Code == http.StatusNotModified {
+			if rec.Body.Len() != 0 {
+				t.Errorf("%s: 304 with a body: %s", tc.name, rec.Body)
+			}
+			continue
+		}
+		mediaType, _, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+		if err != nil {
+			t.Errorf("%s: bad Content-Type %q", tc.name, rec.Header().Get("Content-Type"))
+			continue
+		}
+		schema, err := v.bodySchema(resp, mediaType)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if schema == nil || mediaType != "application/json" {
+			continue
+		}
+		var body any
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s: response is not JSON: %v", tc.name, err)
+			continue
+		}
+		if err := v.validate(schema, body, "response"); err != nil {
+			t.Errorf("%s: response does not match spec: %v\n%s", tc.name, err, rec.Body)
+		}
+	}
+
+	for tmpl, item := range v.doc["paths"].(map[string]any) {
+		for _, m := range specMethods {
+			if _, ok := item.(map[string]any)[m]; ok && !covered[strings.ToUpper(m)+" "+tmpl] {
+				t.Errorf("%s %s is documented but not exercised by this test", strings.ToUpper(m), tmpl)
+			}
+		}
+	}
+}
+
+func TestRoutesAreDocumented(t *testing.T) {
+	v := loadOpenAPI(t)
+	paths := v.doc["paths"].(map[string]any)
+	for _, rt := range newTestServer(newStubRepo()).routes() {
+		method, path, _ := strings.Cut(rt.pattern, " ")
+		item, ok := paths[path].(map[string]any)
+		if !ok {
+			t.Errorf("route %q: path %s missing from openapi.json", rt.pattern, path)
+			continue
+		}
+		if _, ok := item[strings.ToLower(method)]; !ok {
+			t.Errorf("route %q: method %s missing from openapi.json", rt.pattern, method)
+		}
+	}
+}
+
+func TestDocsPageListsEveryOperation(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newTestServer(newStubRepo()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	_, ops, err := specOperations(openAPISpec)
+	if err != nil {
+		t.Fatalf("specOperations: %v", err)
+	}
+	page := rec.Body.String()
+	for _, op := range ops {
+		if !strings.Contains(page, `id="`+op.ID+`"`) {
+			t.Errorf("docs page is missing operation %s (%s %s)", op.ID, op.Method, op.Path)
+		}
+	}
+}
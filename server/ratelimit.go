@@ -0,0 +1,224 @@
+package server
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cryptoserver/auth"
+	"cryptoserver/config"
+)
+
+// rateClass names the budget a route draws from when no per-route budget
+// is configured.
+type rateClass string
+
+const (
+	// rateNone routes are never limited: probes and docs.
+	rateNone rateClass = ""
+	// rateRead routes only touch local state.
+	rateRead rateClass = "read"
+	// rateRefresh routes fetch prices upstream.
+	rateRefresh rateClass = "refresh"
+)
+
+// sweepEvery is how often buckets that have refilled are dropped, which
+// bounds memory by the clients seen within one refill period.
+const sweepEvery = time.Minute
+
+// rateLimiter keeps one token bucket per client and budget.
+type rateLimiter struct {
+	// budgets maps route patterns to their budget name and size.
+	budgets    map[string]namedBudget
+	trustProxy bool
+	now        func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[bucketKey]*bucket
+	lastSweep time.Time
+}
+
+type namedBudget struct {
+	name string
+	config.RateBudget
+}
+
+type bucketKey struct{ client, budget string }
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter resolves the budget of every route: its own entry in
+// cfg.Routes, else that of its class.
+func newRateLimiter(cfg config.RateLimitConfig, routes []route) *rateLimiter {
+	l := &rateLimiter{
+		budgets:    make(map[string]namedBudget),
+		trustProxy: cfg.TrustProxy,
+		now:        time.Now,
+		buckets:    make(map[bucketKey]*bucket),
+	}
+	known := make(map[string]bool, len(routes))
+	for _, rt := range routes {
+		known[rt.pattern] = true
+		if b, ok := cfg.Routes[rt.pattern]; ok {
+			l.budgets[rt.pattern] = namedBudget{rt.pattern, b}
+			continue
+		}
+		switch rt.rate {
+		case rateRead:
+			l.budgets[rt.pattern] = namedBudget{string(rateRead), cfg.Read}
+		case rateRefresh:
+			l.budgets[rt.pattern] = namedBudget{string(rateRefresh), cfg.Refresh}
+		}
+	}
+	for pattern := range cfg.Routes {
+		if !known[pattern] {
+			slog.Warn("rate limit for unknown route ignored", "route", pattern)
+		}
+	}
+	return l
+}
+
+// rateDecision is the state of one bucket after a request drew from it.
+type rateDecision struct {
+	allowed   bool
+	limit     int
+	remaining int
+	// reset is how long until the bucket is full again; retry how long
+	// until the next request would be allowed.
+	reset, retry time.Duration
+}
+
+// take draws a token for client from budget b.
+func (l *rateLimiter) take(client string, b namedBudget) rateDecision {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) >= sweepEvery {
+		l.sweep(now)
+	}
+	burst := float64(b.Burst)
+	k := bucketKey{client, b.name}
+	bk, ok := l.buckets[k]
+	if !ok {
+		bk = &bucket{tokens: burst, last: now}
+		l.buckets[k] = bk
+	}
+	bk.tokens = min(burst, bk.tokens+now.Sub(bk.last).Seconds()*b.Rate)
+	bk.last = now
+
+	d := rateDecision{limit: b.Burst}
+	if bk.tokens >= 1 {
+		bk.tokens--
+		d.allowed = true
+	} else {
+		d.retry = seconds((1 - bk.tokens) / b.Rate)
+	}
+	d.remaining = int(bk.tokens)
+	d.reset = seconds((burst - bk.tokens) / b.Rate)
+	return d
+}
+
+// sweep drops buckets that have refilled; a new bucket starts full, so
+// forgetting them changes nothing. Callers hold l.mu.
+func (l *rateLimiter) sweep(now time.Time) {
+	for k, bk := range l.buckets {
+		b := l.budgetNamed(k.budget)
+		if b.Rate <= 0 || bk.tokens+now.Sub(bk.last).Seconds()*b.Rate >= float64(b.Burst) {
+			delete(l.buckets, k)
+		}
+	}
+	l.lastSweep = now
+}
+
+// budgetNamed finds a budget by name; budgets are few.
+func (l *rateLimiter) budgetNamed(name string) namedBudget {
+	for _, b := range l.budgets {
+		if b.name == name {
+			return b
+		}
+	}
+	return namedBudget{}
+}
+
+// clientOf identifies who a request is charged to: the authenticated key
+// or token subject, else the client IP.
+func (l *rateLimiter) clientOf(r *http.Request) string {
+	if id, ok := auth.IdentityFromContext(r.Context()); ok {
+		return id.Method + ":" + id.Subject
+	}
+	return "ip:" + clientIP(r, l.trustProxy)
+}
+
+// clientIP is the address r came from: with trustProxy the last
+// X-Forwarded-For entry, which the proxy in front appended.
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			hops := strings.Split(xff, ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
+
+// RateLimit answers 429 RATE_LIMITED with Retry-After once a client has
+// used up the budget of a route, and reports the budget in X-RateLimit-*
+// headers on every limited route. It runs after Authenticate so callers
+// are charged per key rather than per IP; requests that fail
+// authentication are charged to their IP by Authenticate instead.
+func (s *Server) RateLimit() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s.limiter == nil || s.charge(w, r, s.limiter.clientOf(r)) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// charge draws a token of r's route budget for client and sets the
+// X-RateLimit-* headers. Once the budget is used up it answers 429 and
+// returns false.
+func (s *Server) charge(w http.ResponseWriter, r *http.Request, client string) bool {
+	_, pattern := s.mux.Handler(r)
+	b, limited := s.limiter.budgets[pattern]
+	if !limited || b.Rate <= 0 {
+		return true
+	}
+	d := s.limiter.take(client, b)
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(d.limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(d.remaining))
+	h.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(d.reset.Seconds()))))
+	if !d.allowed {
+		e := errRateLimited.WithDetail("budget", b.name)
+		e.RetryAfter = d.retry
+		writeErr(w, e)
+		return false
+	}
+	return true
+}
+
+// chargeIP charges a request that failed authentication to its client IP,
+// so cycling through bad keys or tokens is throttled too.
+func (s *Server) chargeIP(w http.ResponseWriter, r *http.Request) bool {
+	return s.limiter == nil || s.charge(w, r, "ip:"+clientIP(r, s.limiter.trustProxy))
+}
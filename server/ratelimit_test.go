@@ -0,0 +1,174 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cryptoserver/auth"
+	"cryptoserver/config"
+)
+
+// newLimitedServer serves btc with cfg's rate limits on a clock the test
+// advances.
+func newLimitedServer(t *testing.T, cfg config.RateLimitConfig, opts ...Option) (http.Handler, *time.Time) {
+	t.Helper()
+	repo := newStubRepo()
+	if _, err := repo.Create("btc"); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Enabled = true
+	s := NewWithConfig(config.Default().Server, repo, &fakeUpstream{coins: 3}, append(opts, WithRateLimit(cfg))...)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.limiter.now = func() time.Time { return now }
+	logger, _ := newTestLogger()
+	return s.Handler(logger), &now
+}
+
+func doFrom(h http.Handler, method, path, addr string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(`{"symbol":"eth"}`))
+	req.RemoteAddr = addr
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimitBudgets(t *testing.T) {
+	h, now := newLimitedServer(t, config.RateLimitConfig{
+		Read:    config.RateBudget{Rate: 10, Burst: 3},
+		Refresh: config.RateBudget{Rate: 0.5, Burst: 2},
+	})
+	const client = "10.0.0.1:5000"
+
+	for i := range 2 {
+		rec := doFrom(h, "PUT", "/crypto/btc/refresh", client)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("refresh %d: %d %s", i, rec.Code, rec.Body)
+		}
+		if got := rec.Header().Get("X-RateLimit-Remaining"); got != []string{"1", "0"}[i] {
+			t.Errorf("refresh %d: X-RateLimit-Remaining = %q", i, got)
+		}
+	}
+	rec := doFrom(h, "PUT", "/crypto/btc/refresh", client)
+	if rec.Code != http.StatusTooManyRequests || errCode(rec) != CodeRateLimited {
+		t.Fatalf("over budget: %d %s", rec.Code, rec.Body)
+	}
+	for k, want := range map[string]string{"Retry-After": "2", "X-RateLimit-Limit": "2", "X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "4"} {
+		if got := rec.Header().Get(k); got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+	if rec := doFrom(h, "POST", "/crypto", client); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("create shares the refresh budget: %d", rec.Code)
+	}
+	if rec := doFrom(h, "GET", "/crypto/btc", client); rec.Code != http.StatusOK || rec.Header().Get("X-RateLimit-Limit") != "3" {
+		t.Errorf("read budget drained by refreshes: %d", rec.Code)
+	}
+	if rec := doFrom(h, "PUT", "/crypto/btc/refresh", "10.0.0.2:5000"); rec.Code != http.StatusOK {
+		t.Errorf("other client limited: %d", rec.Code)
+	}
+	for range 5 {
+		if rec := doFrom(h, "GET", "/healthz", client); rec.Code != http.StatusOK || rec.Header().Get("X-RateLimit-Limit") != "" {
+			t.Fatalf("healthz limited: %d %v", rec.Code, rec.Header())
+		}
+	}
+
+	*now = now.Add(2 * time.Second)
+	if rec := doFrom(h, "PUT", "/crypto/btc/refresh", client); rec.Code != http.StatusOK {
+		t.Errorf("after Retry-After: %d", rec.Code)
+	}
+}
+
+func TestRateLimitRouteOverride(t *testing.T) {
+	h, _ := newLimitedServer(t, config.RateLimitConfig{
+		Read:    config.RateBudget{Rate: 10, Burst: 10},
+		Refresh: config.RateBudget{Rate: 10, Burst: 10},
+		Routes: map[string]config.RateBudget{
+			"GET /crypto/{symbol}/history": {Rate: 1, Burst: 1},
+			"GET /crypto/{symbol}/stats":   {Rate: 0, Burst: 1},
+		},
+	})
+	doFrom(h, "GET", "/crypto/btc/history", "10.0.0.1:1")
+	rec := doFrom(h, "GET", "/crypto/btc/history", "10.0.0.1:1")
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), `"budget":"GET /crypto/{symbol}/history"`) {
+		t.Errorf("overridden route: %d %s", rec.Code, rec.Body)
+	}
+	if rec := doFrom(h, "GET", "/crypto/btc", "10.0.0.1:1"); rec.Code != http.StatusOK {
+		t.Errorf("read budget: %d", rec.Code)
+	}
+	for range 3 {
+		if rec := doFrom(h, "GET", "/crypto/btc/stats", "10.0.0.1:1"); rec.Code != http.StatusOK {
+			t.Fatalf("unlimited route: %d", rec.Code)
+		}
+	}
+}
+
+func TestRateLimitClients(t *testing.T) {
+	keys := auth.NewKeyStore(config.AuthConfig{Enabled: true, Keys: []config.APIKeyConfig{
+		{Name: "a", Scope: config.ScopeWrite, Key: testWriteKey},
+		{Name: "b", Scope: config.ScopeWrite, Key: testAdminKey},
+	}})
+	budget := config.RateBudget{Rate: 1, Burst: 1}
+	h, _ := newLimitedServer(t, config.RateLimitConfig{Read: budget, Refresh: budget, TrustProxy: true}, WithKeyStore(keys))
+
+	const proxy = "192.168.0.1:443"
+	doFrom(h, "GET", "/crypto", proxy, apiKeyHeader, testWriteKey)
+	if rec := doFrom(h, "GET", "/crypto", proxy, apiKeyHeader, testAdminKey); rec.Code != http.StatusOK {
+		t.Errorf("second key behind the same IP: %d", rec.Code)
+	}
+	if rec := doFrom(h, "GET", "/crypto", "192.168.0.9:1", apiKeyHeader, testWriteKey); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("same key from another IP: %d, want 429", rec.Code)
+	}
+
+	open, _ := newLimitedServer(t, config.RateLimitConfig{Read: budget, Refresh: budget, TrustProxy: true})
+	doFrom(open, "GET", "/crypto", proxy, "X-Forwarded-For", "spoofed, 203.0.113.7")
+	if rec := doFrom(open, "GET", "/crypto", proxy, "X-Forwarded-For", "203.0.113.8"); rec.Code != http.StatusOK {
+		t.Errorf("other forwarded client: %d", rec.Code)
+	}
+	if rec := doFrom(open, "GET", "/crypto", proxy, "X-Forwarded-For", "other, 203.0.113.7"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("same forwarded client: %d, want 429", rec.Code)
+	}
+}
+
+func TestRateLimitSweepsRefilledBuckets(t *testing.T) {
+	l := newRateLimiter(config.RateLimitConfig{Read: config.RateBudget{Rate: 1, Burst: 5}}, []route{{pattern: "GET /x", rate: rateRead}})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	for _, c := range []string{"a", "b", "c"} {
+		l.take(c, l.budgets["GET /x"])
+	}
+	now = now.Add(sweepEvery)
+	l.take("d", l.budgets["GET /x"])
+	if len(l.buckets) != 1 {
+		t.Errorf("buckets after sweep = %d, want only the new client's", len(l.buckets))
+	}
+}
+
+func TestRateLimitFailedAuthentication(t *testing.T) {
+	keys := auth.NewKeyStore(config.AuthConfig{Enabled: true, Keys: []config.APIKeyConfig{
+		{Name: "a", Scope: config.ScopeWrite, Key: testWriteKey},
+	}})
+	budget := config.RateBudget{Rate: 1, Burst: 2}
+	h, _ := newLimitedServer(t, config.RateLimitConfig{Read: budget, Refresh: budget}, WithKeyStore(keys))
+
+	for i, key := range []string{"guess-1", "guess-2"} {
+		if rec := doFrom(h, "GET", "/crypto", "10.0.0.1:1", apiKeyHeader, key); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("bad key %d: %d, want 401", i, rec.Code)
+		}
+	}
+	rec := doFrom(h, "GET", "/crypto", "10.0.0.1:1", apiKeyHeader, "guess-3")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("third bad key from one IP: %d, want 429", rec.Code)
+	}
+	if rec := doFrom(h, "GET", "/crypto", "10.0.0.1:1", apiKeyHeader, testWriteKey); rec.Code != http.StatusOK {
+		t.Errorf("valid key from the throttled IP: %d, want it charged to the key", rec.Code)
+	}
+	if rec := doFrom(h, "GET", "/crypto", "10.0.0.2:1"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("missing key from another IP: %d, want 401", rec.Code)
+	}
+}
@@ -2,25 +2,22 @@ package server
 
 import (
     "net/http"
-    "strings"
+
+    "cryptoserver/repository"
 )
 
-// PUT /crypto/{symbol}/refresh
+// PUT /crypto/{symbol}/refresh — with If-Match, only while the coin still
+// has that ETag.
 func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
-    parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/crypto/"), "/")
-    if len(parts) != 2 || parts[1] != "refresh" {
-        writeErr(w, http.StatusNotFound, "not found")
-        return
-    }
-    sym := strings.TrimSpace(parts[0])
-    if sym == "" {
-        writeErr(w, http.StatusBadRequest, "symbol required")
+    sym, ok := symbolParam(w, r)
+    if !ok {
         return
     }
-    c, err := s.repo.RefreshPrice(sym)
+    c, err := repository.RefreshPriceIf(s.repoFor(r), sym, ifMatch(r))
     if err != nil {
-        writeMappedError(w, err, nil)
+        writeErr(w, symbolError(err, sym))
         return
     }
+    w.Header().Set("ETag", etagOf(c))
     writeCrypto(w, http.StatusOK, toCryptoView(c))
 }
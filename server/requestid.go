@@ -0,0 +1,42 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen bounds client-supplied ids so they can't bloat logs.
+const maxRequestIDLen = 128
+
+type requestIDKey struct{}
+
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// RequestIDFromContext returns the id assigned by RequestID, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withRequestID reuses the caller's X-Request-ID when it looks sane,
+// otherwise generates one, echoes it on the response and stores it in the
+// request context. Requests that already carry an id are returned as is.
+func withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		return r
+	}
+	id := r.Header.Get(requestIDHeader)
+	if id == "" || len(id) > maxRequestIDLen {
+		id = newRequestID()
+	}
+	w.Header().Set(requestIDHeader, id)
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+}
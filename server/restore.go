@@ -0,0 +1,27 @@
+package server
+
+import (
+	"net/http"
+
+	"cryptoserver/repository"
+)
+
+// POST /crypto/{symbol}/restore
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	sym, ok := symbolParam(w, r)
+	if !ok {
+		return
+	}
+	sd, ok := s.repoFor(r).(repository.SoftDeleter)
+	if !ok {
+		writeErr(w, symbolError(repository.ErrNotFound, sym))
+		return
+	}
+	c, err := sd.Restore(sym)
+	if err != nil {
+		writeErr(w, symbolError(err, sym))
+		return
+	}
+	w.Header().Set("ETag", etagOf(c))
+	writeCrypto(w, http.StatusOK, toCryptoView(c))
+}
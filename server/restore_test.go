@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cryptoserver/config"
+	"cryptoserver/repository"
+)
+
+func TestDeleteAndRestore(t *testing.T) {
+	srv := newTestServer(repository.NewMemoryCryptoRepoWithConfig(config.Default().Repository, stubSource{price: 100}))
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	do("POST", "/crypto", `{"symbol":"btc"}`)
+	do("PUT", "/crypto/btc/refresh", "")
+	if rec := do("DELETE", "/crypto/btc", ""); rec.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do("GET", "/crypto", ""); strings.Contains(rec.Body.String(), "btc") {
+		t.Errorf("deleted coin listed: %s", rec.Body)
+	}
+	if rec := do("GET", "/crypto?include_deleted=true", ""); !strings.Contains(rec.Body.String(), `"deleted_at"`) {
+		t.Errorf("include_deleted list lacks the tombstone: %s", rec.Body)
+	}
+	if rec := do("POST", "/crypto/btc/restore", ""); rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "deleted_at") {
+		t.Fatalf("restore: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do("GET", "/crypto/btc/history", ""); strings.Count(rec.Body.String(), `"price"`) != 2 {
+		t.Errorf("history after restore: %s, want both records", rec.Body)
+	}
+	if rec := do("POST", "/crypto/btc/restore", ""); rec.Code != http.StatusConflict || errCode(rec) != CodeCoinNotDeleted {
+		t.Errorf("restoring a live coin: %d %s", rec.Code, rec.Body)
+	}
+}
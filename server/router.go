@@ -3,31 +3,99 @@ package server
 import (
     "net/http"
     "strings"
+
+    "cryptoserver/auth"
 )
 
+// route binds a ServeMux pattern ("METHOD /path/{wildcard}") to a handler,
+// the scope a caller needs when authentication is enabled and the rate
+// limit budget it draws from.
+type route struct {
+    pattern string
+    handler http.HandlerFunc
+    scope   auth.Scope
+    rate    rateClass
+}
+
+// routes is the single source of truth for the API surface; openapi.json
+// must document every entry (see openapi_test.go).
+func (s *Server) routes() []route {
+    return []route{
+        {"GET /openapi.json", s.handleOpenAPI, auth.Public, rateNone},
+        {"GET /docs", s.handleDocs, auth.Public, rateNone},
+        {"GET /metrics", s.handleMetrics, auth.Admin, rateRead},
+        {"GET /healthz", s.handleHealthz, auth.Public, rateNone},
+        {"GET /readyz", s.handleReadyz, auth.Public, rateNone},
+        {"GET /status/upstream", s.handleUpstreamStatus, auth.Read, rateRead},
+        {"GET /admin/cache", s.handleCacheStats, auth.Admin, rateRead},
+        {"GET /admin/keys", s.handleListKeys, auth.Admin, rateRead},
+        {"POST /admin/keys", s.handleCreateKey, auth.Admin, rateRead},
+        {"DELETE /admin/keys/{name}", s.handleRevokeKey, auth.Admin, rateRead},
+        {"GET /audit", s.handleAudit, auth.Admin, rateRead},
+        {"GET /events", s.handleEvents, auth.Read, rateRead},
+        {"GET /crypto", s.handleList, auth.Read, rateRead},
+        {"POST /crypto", s.handleCreate, auth.Write, rateRefresh},
+        {"GET /crypto/{symbol}", s.handleGet, auth.Read, rateRead},
+        {"PATCH /crypto/{symbol}", s.handleUpdate, auth.Write, rateRead},
+        {"DELETE /crypto/{symbol}", s.handleDelete, auth.Write, rateRead},
+        {"PUT /crypto/{symbol}/refresh", s.handleRefresh, auth.Write, rateRefresh},
+        {"POST /crypto/{symbol}/restore", s.handleRestore, auth.Write, rateRead},
+        {"GET /crypto/{symbol}/history", s.handleHistory, auth.Read, rateRead},
+        {"GET /crypto/{symbol}/stats", s.handleStats, auth.Read, rateRead},
+        {"GET /crypto/{symbol}/anomalies", s.handleAnomalies, auth.Read, rateRead},
+    }
+}
+
+func (s *Server) buildMux() *http.ServeMux {
+    mux := http.NewServeMux()
+    s.scopes = make(map[string]auth.Scope)
+    for _, rt := range s.routes() {
+        mux.HandleFunc(rt.pattern, rt.handler)
+        s.scopes[rt.pattern] = rt.scope
+    }
+    return mux
+}
+
+// allowMethods is the probe order for the Allow header on 405 responses.
+var allowMethods = []string{
+    http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+}
+
+// allowedMethods lists methods that have a route for r's path.
+func (s *Server) allowedMethods(r *http.Request) []string {
+    var out []string
+    probe := r.Clone(r.Context())
+    for _, m := range allowMethods {
+        probe.Method = m
+        if _, pattern := s.mux.Handler(probe); pattern != "" {
+            out = append(out, m)
+        }
+    }
+    return out
+}
+
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-    switch {
-    case r.Method == http.MethodGet && r.URL.Path == "/crypto":
-        s.handleList(w, r)
-        return
-    case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/crypto/") && strings.HasSuffix(r.URL.Path, "/history"):
-        s.handleHistory(w, r)
-        return
-    case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/crypto/") && strings.HasSuffix(r.URL.Path, "/stats"):
-        s.handleStats(w, r)
-        return
-    case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/crypto/") && strings.HasSuffix(r.URL.Path, "/refresh"):
-        s.handleRefresh(w, r)
-        return
-    case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/crypto/"):
-        s.handleDelete(w, r)
-        return
-    case r.Method == http.MethodPost && r.URL.Path == "/crypto":
-        s.handleCreate(w, r)
-        return
-    case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/crypto/"):
-        s.handleGet(w, r)
+    r = withRequestID(w, r)
+    // ServeMux answers misses with plain text; resolve first so 404 and 405
+    // go through the JSON error envelope instead.
+    if _, pattern := s.mux.Handler(r); pattern == "" {
+        if allow := s.allowedMethods(r); len(allow) > 0 {
+            w.Header().Set("Allow", strings.Join(allow, ", "))
+            writeErr(w, errMethodNotAllowed)
+            return
+        }
+        writeErr(w, errRouteNotFound)
         return
     }
-    writeErr(w, http.StatusNotFound, "not found")
+    s.mux.ServeHTTP(w, r)
+}
+
+// symbolParam returns the trimmed {symbol} path value, writing a 400 when blank.
+func symbolParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+    sym := strings.TrimSpace(r.PathValue("symbol"))
+    if sym == "" {
+        writeErr(w, errSymbolRequired)
+        return "", false
+    }
+    return sym, true
 }
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouterMatrix(t *testing.T) {
+	repo := newStubRepo()
+	srv := newTestServer(repo)
+	for _, sym := range []string{"btc", "history", "stats"} {
+		if _, err := repo.Create(sym); err != nil {
+			t.Fatalf("Create(%s): %v", sym, err)
+		}
+	}
+
+	cases := []struct {
+		method string
+		path   string
+		status int
+		code   ErrorCode
+		allow  string
+		// symbol, when set, is the coin the handler must have resolved.
+		symbol string
+	}{
+		{method: "GET", path: "/crypto", status: 200},
+		{method: "GET", path: "/crypto/btc", status: 200, symbol: "btc"},
+		{method: "GET", path: "/crypto/BTC", status: 200, symbol: "btc"},
+		{method: "HEAD", path: "/crypto/btc", status: 200},
+
+		// Symbols that collide with sub-resource names stay reachable.
+		{method: "GET", path: "/crypto/history", status: 200, symbol: "history"},
+		{method: "GET", path: "/crypto/stats", status: 200, symbol: "stats"},
+		{method: "GET", path: "/crypto/history/history", status: 200, symbol: "history"},
+		{method: "GET", path: "/crypto/stats/stats", status: 200, symbol: "stats"},
+		{method: "GET", path: "/crypto/history/stats", status: 200, symbol: "history"},
+		{method: "PUT", path: "/crypto/stats/refresh", status: 200, symbol: "stats"},
+
+		// Wrong method on a known path is 405 with Allow.
+		{method: "POST", path: "/crypto/btc", status: 405, code: CodeMethodNotAllowed, allow: "GET, HEAD, PATCH, DELETE"},
+		{method: "PATCH", path: "/crypto", status: 405, code: CodeMethodNotAllowed, allow: "GET, HEAD, POST"},
+		{method: "DELETE", path: "/crypto", status: 405, code: CodeMethodNotAllowed, allow: "GET, HEAD, POST"},
+		{method: "GET", path: "/crypto/btc/refresh", status: 405, code: CodeMethodNotAllowed, allow: "PUT"},
+		{method: "POST", path: "/crypto/btc/refresh", status: 405, code: CodeMethodNotAllowed, allow: "PUT"},
+		{method: "DELETE", path: "/crypto/btc/history", status: 405, code: CodeMethodNotAllowed, allow: "GET, HEAD"},
+		{method: "PUT", path: "/crypto/btc/stats", status: 405, code: CodeMethodNotAllowed, allow: "GET, HEAD"},
+		{method: "POST", path: "/openapi.json", status: 405, code: CodeMethodNotAllowed, allow: "GET, HEAD"},
+
+		// Unknown shapes are 404 regardless of method.
+		{method: "GET", path: "/", status: 404, code: CodeRouteNotFound},
+		{method: "GET", path: "/nope", status: 404, code: CodeRouteNotFound},
+		{method: "GET", path: "/crypto/", status: 404, code: CodeRouteNotFound},
+		{method: "GET", path: "/crypto/btc/", status: 404, code: CodeRouteNotFound},
+		{method: "GET", path: "/crypto/btc/unknown", status: 404, code: CodeRouteNotFound},
+		{method: "GET", path: "/crypto/btc/history/extra", status: 404, code: CodeRouteNotFound},
+		{method: "PUT", path: "/crypto/btc/refresh/now", status: 404, code: CodeRouteNotFound},
+		{method: "DELETE", path: "/crypto/btc/x", status: 404, code: CodeRouteNotFound},
+
+		// Path values are validated by the handler, not the router.
+		{method: "GET", path: "/crypto/%20", status: 400, code: CodeSymbolRequired},
+		{method: "PUT", path: "/crypto/%20/refresh", status: 400, code: CodeSymbolRequired},
+		{method: "GET", path: "/crypto/a%2Fb", status: 404, code: CodeCoinNotFound},
+		{method: "GET", path: "/crypto/xyz/stats", status: 404, code: CodeCoinNotFound},
+		{method: "DELETE", path: "/crypto/xyz", status: 404, code: CodeCoinNotFound},
+
+		{method: "DELETE", path: "/crypto/history", status: 200},
+		{method: "GET", path: "/crypto/history", status: 404, code: CodeCoinNotFound},
+	}
+
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+		name := tc.method + " " + tc.path
+		if rec.Code != tc.status {
+			t.Errorf("%s: status = %d, want %d (body %s)", name, rec.Code, tc.status, rec.Body)
+			continue
+		}
+		if got := rec.Header().Get("Allow"); got != tc.allow {
+			t.Errorf("%s: Allow = %q, want %q", name, got, tc.allow)
+		}
+		if rec.Header().Get(requestIDHeader) == "" {
+			t.Errorf("%s: missing %s header", name, requestIDHeader)
+		}
+		if tc.method == http.MethodHead {
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+			t.Errorf("%s: Content-Type = %q, want JSON", name, ct)
+			continue
+		}
+		var body map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s: body is not JSON: %v", name, err)
+			continue
+		}
+		if tc.code != "" && body["code"] != string(tc.code) {
+			t.Errorf("%s: code = %v, want %s", name, body["code"], tc.code)
+		}
+		if tc.symbol != "" {
+			got, _ := body["symbol"].(string)
+			if got != tc.symbol {
+				if c, ok := body["crypto"].(map[string]any); ok {
+					got, _ = c["symbol"].(string)
+				}
+			}
+			if got != tc.symbol {
+				t.Errorf("%s: resolved symbol %q, want %q", name, got, tc.symbol)
+			}
+		}
+	}
+}
@@ -2,30 +2,27 @@ package server
 
 import (
     "net/http"
-    "strings"
 )
 
 // GET /crypto/{symbol}/stats
 func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
-    if !strings.HasSuffix(r.URL.Path, "/stats") {
-        writeErr(w, http.StatusNotFound, "not found")
-        return
-    }
-    sym := strings.TrimPrefix(strings.TrimSuffix(r.URL.Path, "/stats"), "/crypto/")
-    sym = strings.TrimSpace(sym)
-    if sym == "" || strings.Contains(sym, "/") {
-        writeErr(w, http.StatusNotFound, "not found")
+    sym, ok := symbolParam(w, r)
+    if !ok {
         return
     }
+    repo := s.repoFor(r)
     // Get current price and history length
-    c, err := s.repo.Get(sym)
+    c, err := repo.Get(sym)
     if err != nil {
-        writeMappedError(w, err, map[int]string{http.StatusNotFound: "not found"})
+        writeErr(w, symbolError(err, sym))
+        return
+    }
+    if notModified(w, r, etagOf(c), c.LastUpdated) {
         return
     }
-    st, err := s.repo.Stats(sym)
+    st, err := repo.Stats(sym)
     if err != nil {
-        writeMappedError(w, err, map[int]string{http.StatusNotFound: "not found"})
+        writeErr(w, symbolError(err, sym))
         return
     }
     // Build response with domain stats directly (tags match external contract)
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"cryptoserver/config"
+	"cryptoserver/repository"
+)
+
+// newTestServer serves repo with default settings and a healthy fake
+// upstream, so tests never probe or call CoinGecko.
+func newTestServer(repo repository.CryptoRepository) *Server {
+	return NewWithConfig(config.Default().Server, repo, &fakeUpstream{coins: 3})
+}
+
+// stubRepo is an in-memory CryptoRepository with a fixed coin universe and
+// injectable upstream failures, so handler tests don't need CoinGecko.
+type stubRepo struct {
+	mu    sync.Mutex
+	names map[string]string
+	data  map[string]repository.Crypto
+	price float64
+	// anomalies is returned as is by Anomalies; tests fill it directly.
+	anomalies map[string][]repository.Anomaly
+	// failNext, when set, is returned by the next call that would hit upstream.
+	failNext error
+}
+
+func newStubRepo() *stubRepo {
+	return &stubRepo{
+		names:     map[string]string{"btc": "Bitcoin", "eth": "Ethereum", "history": "History", "stats": "Stats"},
+		data:      make(map[string]repository.Crypto),
+		price:     100,
+		anomalies: make(map[string][]repository.Anomaly),
+	}
+}
+
+func (s *stubRepo) fail(err error) {
+	s.mu.Lock()
+	s.failNext = err
+	s.mu.Unlock()
+}
+
+func (s *stubRepo) upstream() error {
+	err := s.failNext
+	s.failNext = nil
+	return err
+}
+
+func (s *stubRepo) Create(symbol string) (repository.Crypto, error) {
+	symbol = strings.ToLower(strings.TrimSpace(symbol))
+	if symbol == "" {
+		return repository.Crypto{}, repository.ErrInvalidSymbol
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data[symbol]; ok {
+		return repository.Crypto{}, repository.ErrAlreadyExists
+	}
+	if err := s.upstream(); err != nil {
+		return repository.Crypto{}, err
+	}
+	name, ok := s.names[symbol]
+	if !ok {
+		return repository.Crypto{}, fmt.Errorf("%w: name not found for %s", repository.ErrInvalidSymbol, symbol)
+	}
+	now := time.Now()
+	c := repository.Crypto{
+		Symbol:       symbol,
+		Name:         name,
+		CurrentPrice: s.price,
+		LastUpdated:  now,
+		History:      []repository.PriceRecord{{Price: s.price, Timestamp: now}},
+	}
+	s.data[symbol] = c
+	return c.Copy(), nil
+}
+
+func (s *stubRepo) Get(symbol string) (repository.Crypto, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.data[strings.ToLower(strings.TrimSpace(symbol))]
+	if !ok {
+		return repository.Crypto{}, repository.ErrNotFound
+	}
+	return c.Copy(), nil
+}
+
+func (s *stubRepo) List() ([]repository.Crypto, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]repository.Crypto, 0, len(s.data))
+	for _, c := range s.data {
+		out = append(out, c.Copy())
+	}
+	return out, nil
+}
+
+func (s *stubRepo) Delete(symbol string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	symbol = strings.ToLower(strings.TrimSpace(symbol))
+	if _, ok := s.data[symbol]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(s.data, symbol)
+	return nil
+}
+
+func (s *stubRepo) RefreshPrice(symbol string) (repository.Crypto, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	symbol = strings.ToLower(strings.TrimSpace(symbol))
+	c, ok := s.data[symbol]
+	if !ok {
+		return repository.Crypto{}, repository.ErrNotFound
+	}
+	if err := s.upstream(); err != nil {
+		return repository.Crypto{}, err
+	}
+	s.price++
+	now := time.Now()
+	c.CurrentPrice = s.price
+	c.LastUpdated = now
+	c.History = append(c.History, repository.PriceRecord{Price: s.price, Timestamp: now})
+	s.data[symbol] = c
+	return c.Copy(), nil
+}
+
+func (s *stubRepo) History(symbol string) ([]repository.PriceRecord, error) {
+	c, err := s.Get(symbol)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(c.History), nil
+}
+
+func (s *stubRepo) Stats(symbol string) (repository.PriceStats, error) {
+	c, err := s.Get(symbol)
+	if err != nil {
+		return repository.PriceStats{}, err
+	}
+	h := c.History
+	first, last := h[0].Price, h[len(h)-1].Price
+	st := repository.PriceStats{MinPrice: first, MaxPrice: first, RecordsCount: len(h), PriceChange: last - first}
+	sum := 0.0
+	for _, rec := range h {
+		st.MinPrice = min(st.MinPrice, rec.Price)
+		st.MaxPrice = max(st.MaxPrice, rec.Price)
+		sum += rec.Price
+	}
+	st.AvgPrice = sum / float64(len(h))
+	st.PriceChangePct = st.PriceChange / first * 100
+	return st, nil
+}
+
+func (s *stubRepo) Anomalies(symbol string) ([]repository.Anomaly, error) {
+	if _, err := s.Get(symbol); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]repository.Anomaly{}, s.anomalies[strings.ToLower(strings.TrimSpace(symbol))]...), nil
+}
+
+// stubSource is a PriceSource that knows every symbol at one price, for
+// tests that need a real repository.
+type stubSource struct{ price float64 }
+
+func (s stubSource) GetName(symbol string) (string, error) { return strings.ToUpper(symbol), nil }
+
+func (s stubSource) GetPrice(string) (float64, error) { return s.price, nil }
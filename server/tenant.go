@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"cryptoserver/auth"
+	"cryptoserver/config"
+	"cryptoserver/repository"
+)
+
+// tenantHeader picks the tenant of callers not bound to one and echoes the
+// tenant a request was served for.
+const tenantHeader = "X-Tenant"
+
+type tenantKey struct{}
+
+// ResolveTenant decides whose coins a request works on, when the server
+// has tenants: the tenant of the caller's API key or token, else the
+// X-Tenant header, else config.DefaultTenant. A bound caller naming
+// another tenant is refused. Public and unknown routes pass through.
+func (s *Server) ResolveTenant() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s.tenants == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			_, pattern := s.mux.Handler(r)
+			if need, known := s.scopes[pattern]; !known || need == auth.Public {
+				next.ServeHTTP(w, r)
+				return
+			}
+			asked := strings.ToLower(strings.TrimSpace(r.Header.Get(tenantHeader)))
+			if asked != "" && !config.ValidTenant(asked) {
+				writeErr(w, errInvalidTenant.WithDetail("tenant", asked))
+				return
+			}
+			tenant := asked
+			if id, ok := auth.IdentityFromContext(r.Context()); ok && id.Tenant != "" {
+				if asked != "" && asked != id.Tenant {
+					writeErr(w, errTenantForbidden.WithDetail("tenant", asked))
+					return
+				}
+				tenant = id.Tenant
+			}
+			if tenant == "" {
+				tenant = config.DefaultTenant
+			}
+			w.Header().Set(tenantHeader, tenant)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantKey{}, tenant)))
+		})
+	}
+}
+
+// tenantOf returns the tenant r was resolved to.
+func (s *Server) tenantOf(r *http.Request) string {
+	if tenant, _ := r.Context().Value(tenantKey{}).(string); tenant != "" {
+		return tenant
+	}
+	return config.DefaultTenant
+}
+
+// repoFor returns the repository of the tenant r was resolved to, with
+// changes attributed to r's caller when the repository audits them.
+func (s *Server) repoFor(r *http.Request) repository.CryptoRepository {
+	repo := s.repo
+	if s.tenants != nil {
+		repo = s.tenants.For(s.tenantOf(r))
+	}
+	if ar, ok := repo.(repository.ActorRepository); ok {
+		return ar.As(s.actorOf(r))
+	}
+	return repo
+}
+
+// eachTenant calls fn with every tenant that has coins; without tenants
+// s.repo is the only, default, one.
+func (s *Server) eachTenant(fn func(tenant string, repo repository.CryptoRepository)) {
+	if s.tenants == nil {
+		fn(config.DefaultTenant, s.repo)
+		return
+	}
+	for _, name := range s.tenants.Names() {
+		fn(name, s.tenants.For(name))
+	}
+}
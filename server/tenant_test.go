@@ -0,0 +1,136 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cryptoserver/auth"
+	"cryptoserver/config"
+	"cryptoserver/repository"
+)
+
+// newTenantServer serves stub repositories per tenant; keys, when given,
+// enable authentication.
+func newTenantServer(keys ...config.APIKeyConfig) http.Handler {
+	tenants := repository.NewTenants(func(string) repository.CryptoRepository { return newStubRepo() })
+	ks := auth.NewKeyStore(config.AuthConfig{Enabled: len(keys) > 0, Keys: keys})
+	logger, _ := newTestLogger()
+	return NewWithConfig(config.Default().Server, tenants.For(config.DefaultTenant), &fakeUpstream{coins: 3},
+		WithTenants(tenants), WithKeyStore(ks)).Handler(logger)
+}
+
+func doTenant(h http.Handler, method, path, key, tenant, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(apiKeyHeader, key)
+	}
+	if tenant != "" {
+		req.Header.Set(tenantHeader, tenant)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func errCode(rec *httptest.ResponseRecorder) ErrorCode {
+	var body errorResponse
+	_ = json.Unmarshal(rec.Body.Bytes(), &body)
+	return body.Code
+}
+
+func TestTenantHeaderIsolatesCoins(t *testing.T) {
+	h := newTenantServer()
+
+	for _, tenant := range []string{"team-a", "Team-B"} {
+		if rec := doTenant(h, "POST", "/crypto", "", tenant, `{"symbol":"btc"}`); rec.Code != http.StatusCreated {
+			t.Fatalf("%s create: %d %s", tenant, rec.Code, rec.Body)
+		}
+	}
+	rec := doTenant(h, "DELETE", "/crypto/btc", "", "team-a", "")
+	if rec.Code != http.StatusOK || rec.Header().Get(tenantHeader) != "team-a" {
+		t.Fatalf("delete: %d, %s = %q", rec.Code, tenantHeader, rec.Header().Get(tenantHeader))
+	}
+	if rec := doTenant(h, "GET", "/crypto/btc", "", "team-b", ""); rec.Code != http.StatusOK {
+		t.Errorf("other tenant's coin after delete: %d %s", rec.Code, rec.Body)
+	}
+	if rec := doTenant(h, "GET", "/crypto/btc", "", "team-a", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("deleted coin: %d, want 404", rec.Code)
+	}
+
+	rec = doTenant(h, "GET", "/crypto", "", "", "")
+	if rec.Code != http.StatusOK || rec.Header().Get(tenantHeader) != config.DefaultTenant || !strings.Contains(rec.Body.String(), `"cryptos":[]`) {
+		t.Errorf("default tenant list = %d %s %s", rec.Code, rec.Header().Get(tenantHeader), rec.Body)
+	}
+	if rec := doTenant(h, "GET", "/crypto", "", "../etc", ""); rec.Code != http.StatusBadRequest || errCode(rec) != CodeInvalidTenant {
+		t.Errorf("bad tenant: %d %s", rec.Code, rec.Body)
+	}
+	if rec := doTenant(h, "GET", "/healthz", "", "../etc", ""); rec.Code != http.StatusOK {
+		t.Errorf("public route with bad tenant: %d", rec.Code)
+	}
+
+	rec = doTenant(h, "GET", "/metrics", "", "", "")
+	if !strings.Contains(rec.Body.String(), `cryptoserver_history_length{symbol="btc",tenant="team-b"} 1`) ||
+		!strings.Contains(rec.Body.String(), "cryptoserver_tracked_coins 1") {
+		t.Errorf("metrics lack per-tenant series:\n%s", rec.Body)
+	}
+}
+
+func TestTenantBoundKeys(t *testing.T) {
+	h := newTenantServer(
+		config.APIKeyConfig{Name: "a-writer", Scope: config.ScopeWrite, Key: testWriteKey, Tenant: "team-a"},
+		config.APIKeyConfig{Name: "a-admin", Scope: config.ScopeAdmin, Key: "a-admin-key-0123456789", Tenant: "team-a"},
+		config.APIKeyConfig{Name: "b-reader", Scope: config.ScopeRead, Key: testReadKey, Tenant: "team-b"},
+		config.APIKeyConfig{Name: "ops", Scope: config.ScopeAdmin, Key: testAdminKey},
+	)
+
+	if rec := doTenant(h, "POST", "/crypto", testWriteKey, "", `{"symbol":"btc"}`); rec.Code != http.StatusCreated || rec.Header().Get(tenantHeader) != "team-a" {
+		t.Fatalf("bound create: %d %s", rec.Code, rec.Body)
+	}
+	if rec := doTenant(h, "GET", "/crypto/btc", testWriteKey, "team-a", ""); rec.Code != http.StatusOK {
+		t.Errorf("bound key naming its own tenant: %d", rec.Code)
+	}
+	if rec := doTenant(h, "DELETE", "/crypto/btc", testWriteKey, "team-b", ""); rec.Code != http.StatusForbidden || errCode(rec) != CodeForbidden {
+		t.Errorf("bound key naming another tenant: %d %s", rec.Code, rec.Body)
+	}
+	if rec := doTenant(h, "GET", "/crypto/btc", testAdminKey, "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unbound key sees the default tenant: %d, want 404", rec.Code)
+	}
+	if rec := doTenant(h, "GET", "/crypto/btc", testAdminKey, "team-a", ""); rec.Code != http.StatusOK {
+		t.Errorf("unbound key picking team-a: %d", rec.Code)
+	}
+
+	rec := doTenant(h, "POST", "/admin/keys", "a-admin-key-0123456789", "", `{"name":"a-ci","scope":"read"}`)
+	if rec.Code != http.StatusCreated || !strings.Contains(rec.Body.String(), `"tenant":"team-a"`) {
+		t.Errorf("bound admin creating a key: %d %s, want it bound to team-a", rec.Code, rec.Body)
+	}
+	rec = doTenant(h, "POST", "/admin/keys", "a-admin-key-0123456789", "", `{"name":"b-ci","scope":"read","tenant":"team-b"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("bound admin creating a key for another tenant: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = doTenant(h, "GET", "/admin/keys", "a-admin-key-0123456789", "", "")
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, `"a-ci"`) || strings.Contains(body, `"ops"`) || strings.Contains(body, `"b-reader"`) {
+		t.Errorf("bound admin listing keys: %d %s, want team-a's only", rec.Code, body)
+	}
+	if rec := doTenant(h, "GET", "/admin/keys", testAdminKey, "", ""); !strings.Contains(rec.Body.String(), `"a-ci"`) || !strings.Contains(rec.Body.String(), `"ops"`) {
+		t.Errorf("unbound admin listing keys: %s", rec.Body)
+	}
+	for _, name := range []string{"ops", "b-reader"} {
+		rec := doTenant(h, "DELETE", "/admin/keys/"+name, "a-admin-key-0123456789", "", "")
+		if rec.Code != http.StatusNotFound || errCode(rec) != CodeKeyNotFound {
+			t.Errorf("bound admin revoking %s: %d %s", name, rec.Code, rec.Body)
+		}
+	}
+	if rec := doTenant(h, "GET", "/admin/keys", testAdminKey, "", ""); !strings.Contains(rec.Body.String(), `"ops"`) {
+		t.Errorf("global key revoked by a bound admin: %s", rec.Body)
+	}
+	if rec := doTenant(h, "DELETE", "/admin/keys/a-ci", "a-admin-key-0123456789", "", ""); rec.Code != http.StatusOK {
+		t.Errorf("bound admin revoking its own tenant's key: %d %s", rec.Code, rec.Body)
+	}
+	if rec := doTenant(h, "GET", "/metrics", "a-admin-key-0123456789", "", ""); rec.Code != http.StatusForbidden || strings.Contains(rec.Body.String(), "team-b") {
+		t.Errorf("bound admin scraping every tenant's metrics: %d", rec.Code)
+	}
+}
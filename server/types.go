@@ -1,12 +1,110 @@
 package server
 
-import "cryptoserver/repository"
+import (
+    "net/http"
+    "sync/atomic"
+    "time"
+
+    "cryptoserver/audit"
+    "cryptoserver/auth"
+    "cryptoserver/config"
+    "cryptoserver/gecko/geckoclient"
+    "cryptoserver/pricecache"
+    "cryptoserver/repository"
+)
 
 type Server struct {
-    repo repository.CryptoRepository
+    repo         repository.CryptoRepository
+    upstream     Upstream
+    readyTimeout time.Duration
+    mux          *http.ServeMux
+    // scopes maps route patterns to the scope callers need.
+    scopes       map[string]auth.Scope
+    metrics      *serverMetrics
+    draining     atomic.Bool
+
+    cache PriceCache
+    keys    *auth.KeyStore
+    jwt     *auth.JWTVerifier
+    tenants *repository.Tenants
+
+    rateLimit config.RateLimitConfig
+    limiter   *rateLimiter
+
+    audit audit.Store
+}
+
+// PriceCache is what GET /admin/cache reports on; *pricecache.Cache
+// implements it.
+type PriceCache interface {
+    Stats() pricecache.Stats
+}
+
+// Option configures optional Server dependencies.
+type Option func(*Server)
+
+// WithPriceCache exposes the stats of the price cache in front of the
+// upstream at GET /admin/cache.
+func WithPriceCache(c PriceCache) Option {
+    return func(s *Server) { s.cache = c }
+}
+
+// WithKeyStore requires callers to present one of the keys in ks when it
+// is enabled, and manages ks at /admin/keys.
+func WithKeyStore(ks *auth.KeyStore) Option {
+    return func(s *Server) { s.keys = ks }
 }
 
+// WithJWTVerifier also accepts "Authorization: Bearer" tokens checked by
+// v when authentication is enabled; nil v accepts none.
+func WithJWTVerifier(v *auth.JWTVerifier) Option {
+    return func(s *Server) { s.jwt = v }
+}
+
+// WithTenants serves each tenant its own coins from t; see ResolveTenant.
+// The repo given to NewWithConfig should be t's default tenant.
+func WithTenants(t *repository.Tenants) Option {
+    return func(s *Server) { s.tenants = t }
+}
+
+// WithRateLimit limits requests per client as cfg says, when cfg.Enabled;
+// see RateLimit.
+func WithRateLimit(cfg config.RateLimitConfig) Option {
+    return func(s *Server) { s.rateLimit = cfg }
+}
+
+// WithAuditLog serves GET /audit from log. Entries are written by the
+// repository (see repository.Audited), not by the server.
+func WithAuditLog(log audit.Store) Option {
+    return func(s *Server) { s.audit = log }
+}
+
+// New serves repo with default settings and the default CoinGecko client.
 func New(repo repository.CryptoRepository) *Server {
-    return &Server{repo: repo}
+    return NewWithConfig(config.Default().Server, repo, geckoclient.Default())
 }
 
+// NewWithConfig serves repo; upstream backs the health and status endpoints.
+func NewWithConfig(cfg config.ServerConfig, repo repository.CryptoRepository, upstream Upstream, opts ...Option) *Server {
+    s := &Server{
+        repo:         repo,
+        upstream:     upstream,
+        readyTimeout: time.Duration(cfg.ReadyTimeout),
+        keys:         auth.NewKeyStore(config.AuthConfig{}),
+    }
+    for _, opt := range opts {
+        opt(s)
+    }
+    s.mux = s.buildMux()
+    if s.rateLimit.Enabled {
+        s.limiter = newRateLimiter(s.rateLimit, s.routes())
+    }
+    s.metrics = s.newMetrics()
+    return s
+}
+
+// Drain marks the server as shutting down: /readyz starts failing so load
+// balancers stop sending traffic while in-flight requests finish.
+func (s *Server) Drain() {
+    s.draining.Store(true)
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"cryptoserver/repository"
+)
+
+// updateRequest is the PATCH /crypto/{symbol} body. Absent fields are
+// kept; an empty string or list clears one.
+type updateRequest struct {
+	DisplayName *string   `json:"display_name"`
+	Tags        *[]string `json:"tags"`
+	Notes       *string   `json:"notes"`
+	// RefreshPolicy replaces the coin's whole policy.
+	RefreshPolicy *repository.RefreshPolicy `json:"refresh_policy"`
+}
+
+// PATCH /crypto/{symbol} — edit the coin's metadata and refresh policy;
+// with If-Match, only while the coin still has that ETag.
+func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	sym, ok := symbolParam(w, r)
+	if !ok {
+		return
+	}
+	var req updateRequest
+	dec := json.NewDecoder(r.Body)
+	// A misspelt field would otherwise be a silent no-op.
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeErr(w, errInvalidJSON)
+		return
+	}
+	me, ok := s.repoFor(r).(repository.MetadataEditor)
+	if !ok {
+		writeErr(w, symbolError(repository.ErrNotFound, sym))
+		return
+	}
+	c, err := me.UpdateMetadata(sym, repository.MetadataPatch{
+		DisplayName:   req.DisplayName,
+		Tags:          req.Tags,
+		Notes:         req.Notes,
+		RefreshPolicy: req.RefreshPolicy,
+	}, ifMatch(r))
+	if errors.Is(err, repository.ErrInvalidMetadata) {
+		// The repository's reason names the field and is safe to show.
+		writeErr(w, symbolError(err, sym).WithDetail("reason", err.Error()))
+		return
+	}
+	if err != nil {
+		writeErr(w, symbolError(err, sym))
+		return
+	}
+	w.Header().Set("ETag", etagOf(c))
+	writeCrypto(w, http.StatusOK, toCryptoView(c))
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cryptoserver/config"
+	"cryptoserver/repository"
+)
+
+func TestUpdateMetadata(t *testing.T) {
+	srv := newTestServer(repository.NewMemoryCryptoRepoWithConfig(config.Default().Repository, stubSource{price: 100}))
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	do("POST", "/crypto", `{"symbol":"btc"}`)
+	do("POST", "/crypto", `{"symbol":"eth"}`)
+	etag := do("GET", "/crypto/btc", "").Header().Get("ETag")
+	rec := do("PATCH", "/crypto/btc", `{"display_name":"Cold BTC","tags":["DeFi"]}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"tags":["defi"]`) || rec.Header().Get("ETag") == etag {
+		t.Fatalf("patch: %d %s, ETag %q", rec.Code, rec.Body, rec.Header().Get("ETag"))
+	}
+	if rec := do("PATCH", "/crypto/btc", `{"notes":"ledger"}`); !strings.Contains(rec.Body.String(), `"display_name":"Cold BTC"`) {
+		t.Errorf("partial patch dropped display_name: %s", rec.Body)
+	}
+	if rec := do("GET", "/crypto?tag=defi", ""); !strings.Contains(rec.Body.String(), "btc") || strings.Contains(rec.Body.String(), "eth") {
+		t.Errorf("tag filter: %s", rec.Body)
+	}
+	rec = do("PATCH", "/crypto/btc", `{"tags":["a b"]}`)
+	if rec.Code != http.StatusBadRequest || errCode(rec) != CodeInvalidMetadata || !strings.Contains(rec.Body.String(), `"reason"`) {
+		t.Errorf("bad tag: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestUpdateRefreshPolicy(t *testing.T) {
+	srv := newTestServer(repository.NewMemoryCryptoRepoWithConfig(config.Default().Repository, stubSource{price: 100}))
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	do("POST", "/crypto", `{"symbol":"btc"}`)
+	if rec := do("GET", "/crypto/btc", ""); strings.Contains(rec.Body.String(), "refresh") {
+		t.Errorf("coin without a policy: %s", rec.Body)
+	}
+	rec := do("PATCH", "/crypto/btc", `{"refresh_policy":{"interval":"5m","quiet_hours":{"start":"22:00","end":"06:00"}}}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"interval":"5m0s"`) || !strings.Contains(rec.Body.String(), `"next_refresh_at"`) {
+		t.Fatalf("set policy: %d %s", rec.Code, rec.Body)
+	}
+	rec = do("PATCH", "/crypto/btc", `{"refresh_policy":{"interval":"5m","paused":true}}`)
+	if !strings.Contains(rec.Body.String(), `"paused":true`) || strings.Contains(rec.Body.String(), "next_refresh_at") || strings.Contains(rec.Body.String(), "quiet_hours") {
+		t.Errorf("pause replaces the policy and has no next refresh: %s", rec.Body)
+	}
+	for _, body := range []string{
+		`{"refresh_policy":{"interval":"1s"}}`,
+		`{"refresh_policy":{"quiet_hours":{"start":"9am","end":"10am"}}}`,
+		`{"refresh_policy":{"interval":"soon"}}`,
+	} {
+		if rec := do("PATCH", "/crypto/btc", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: %d %s", body, rec.Code, rec.Body)
+		}
+	}
+}